@@ -14,7 +14,9 @@ func main() {
 	go stop(interp)
 
 	// you should use interp in the same goroutine where it was created,
-	// otherwise interp.Interrupt() may not work
+	// otherwise interp.Interrupt() may not work.
+	// To interrupt also goroutines started by interpreted code, or to set a timeout,
+	// use interp.EvalContext() instead
 	run(interp)
 }
 
@@ -37,6 +37,7 @@ type Package = struct {
 	Proxies  map[string]r.Type
 	Untypeds map[string]string
 	Wrappers map[string][]string
+	Generics map[string]string
 }
 
 var Packages = make(map[string]Package)
@@ -17,11 +17,21 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
 	"go/ast"
 	"go/constant"
 	"go/token"
+	"io"
+	"math"
 	"math/big"
+	"os"
+	"path/filepath"
 	r "reflect"
+	"runtime"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -31,9 +41,12 @@ import (
 	"github.com/WilliamNHarvey/gomacro/base/reflect"
 	"github.com/WilliamNHarvey/gomacro/base/untyped"
 	"github.com/WilliamNHarvey/gomacro/classic"
+	"github.com/WilliamNHarvey/gomacro/cmd"
 	"github.com/WilliamNHarvey/gomacro/fast"
+	"github.com/WilliamNHarvey/gomacro/fast/debug"
 	"github.com/WilliamNHarvey/gomacro/go/etoken"
 	"github.com/WilliamNHarvey/gomacro/go/parser"
+	"github.com/WilliamNHarvey/gomacro/imports"
 	xr "github.com/WilliamNHarvey/gomacro/xreflect"
 )
 
@@ -153,6 +166,1152 @@ func TestFast(t *testing.T) {
 	}
 }
 
+// breakpointRecorder is a debugger that records the source lines of breakpoints it stops at
+// and the changes of watched variables
+type breakpointRecorder struct {
+	lines   []int
+	changes []string
+}
+
+func (d *breakpointRecorder) Breakpoint(ir *fast.Interp, env *fast.Env) fast.DebugOp {
+	if w := env.Run.Watch; w != nil {
+		line := ir.Comp.Fileset.Position(w.Pos).Line
+		d.changes = append(d.changes, fmt.Sprintf("%d: %s %s -> %s", line, w.Name, w.Old, w.Value))
+		return fast.DebugOpContinue
+	}
+	d.lines = append(d.lines, ir.Comp.Fileset.Position(env.DebugPos[env.IP]).Line)
+	return fast.DebugOpContinue
+}
+
+func (d *breakpointRecorder) At(ir *fast.Interp, env *fast.Env) fast.DebugOp {
+	return fast.DebugOpContinue
+}
+
+func TestBreakpoints(t *testing.T) {
+	ir := fast.New()
+	ir.Comp.Options |= OptDebugger
+	d := &breakpointRecorder{}
+	ir.SetDebugger(d)
+
+	expectLines := func(expected ...int) {
+		t.Helper()
+		if len(d.lines) != len(expected) {
+			t.Fatalf("expecting breakpoints at lines %v, found %v", expected, d.lines)
+		}
+		for i := range expected {
+			if d.lines[i] != expected[i] {
+				t.Fatalf("expecting breakpoints at lines %v, found %v", expected, d.lines)
+			}
+		}
+		d.lines = nil
+	}
+
+	// pending breakpoint, set when the function is compiled
+	bp1 := ir.SetFuncBreakpoint("add")
+	if bp1.Locations != 0 {
+		t.Errorf("expecting a pending breakpoint, found %d locations", bp1.Locations)
+	}
+	ir.Eval("func add(a, b int) int {\n\tc := a + b\n\treturn c\n}")
+	ir.Eval("add(1, 2)")
+	expectLines(2)
+
+	file := filepath.Join(t.TempDir(), "breakpoints.gomacro")
+	src := "package main\n\nfunc mul(a, b int) int {\n\tc := a * b\n\treturn c\n}\n\ntype T int\n\nfunc (t T) Twice() T {\n\treturn t * 2\n}\n"
+	if err := os.WriteFile(file, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ir.EvalFile(file); err != nil {
+		t.Fatal(err)
+	}
+	// breakpoints in code already compiled
+	bp2 := ir.SetBreakpoint("breakpoints.gomacro", 5)
+	bp3 := ir.SetFuncBreakpoint("T.Twice")
+	if bp2.Locations != 1 || bp3.Locations != 1 {
+		t.Errorf("expecting breakpoints with 1 location, found %d and %d", bp2.Locations, bp3.Locations)
+	}
+	ir.Eval("mul(3, 4) + int(T(3).Twice())")
+	expectLines(5, 11)
+
+	ir.EnableBreakpoint(bp2.ID, false)
+	ir.Eval("mul(3, 4)")
+	expectLines()
+
+	ir.EnableBreakpoint(bp2.ID, true)
+	ir.DeleteBreakpoint(bp3.ID)
+	vals, _ := ir.Eval("mul(3, 4) + int(T(3).Twice()) + add(1, 2)")
+	expectLines(5, 2)
+	if len(vals) != 1 || vals[0].Interface() != 21 {
+		t.Errorf("expecting 21, found %v", vals)
+	}
+	if n := len(ir.Breakpoints()); n != 2 {
+		t.Errorf("expecting 2 breakpoints, found %d", n)
+	}
+}
+
+func TestBreakpointConditions(t *testing.T) {
+	ir := fast.New()
+	ir.Comp.Options |= OptDebugger
+	d := &breakpointRecorder{}
+	ir.SetDebugger(d)
+
+	file := filepath.Join(t.TempDir(), "conditions.gomacro")
+	src := "package main\n\nfunc sum(n int) int {\n\ttotal := 0\n\tfor i := 0; i < n; i++ {\n\t\ttotal += i\n\t}\n\treturn total\n}\n"
+	if err := os.WriteFile(file, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ir.EvalFile(file); err != nil {
+		t.Fatal(err)
+	}
+	bp := ir.SetBreakpoint("conditions.gomacro", 6)
+	ir.SetBreakpointCondition(bp.ID, "i % 3 == 0")
+	ir.Eval("sum(10)")
+	if bps := ir.Breakpoints(); len(d.lines) != 4 || bps[0].Hits != 4 {
+		t.Errorf("expecting 4 stops and hits, found %d stops and %d hits", len(d.lines), bps[0].Hits)
+	}
+
+	d.lines = nil
+	ir.SetBreakpointIgnore(bp.ID, 3)
+	ir.Eval("sum(10)")
+	if bps := ir.Breakpoints(); len(d.lines) != 1 || bps[0].Hits != 8 || bps[0].Ignore != 0 {
+		t.Errorf("expecting 1 stop, 8 hits and 0 ignore, found %d stops, %d hits and %d ignore", len(d.lines), bps[0].Hits, bps[0].Ignore)
+	}
+
+	// conditions that cannot be compiled always stop
+	d.lines = nil
+	ir.SetBreakpointCondition(bp.ID, "undefined_var > 0")
+	ir.Comp.Stderr = io.Discard
+	vals, _ := ir.Eval("sum(3)")
+	if len(d.lines) != 3 || len(vals) != 1 || vals[0].Interface() != 3 {
+		t.Errorf("expecting 3 stops and result 3, found %d stops and %v", len(d.lines), vals)
+	}
+}
+
+func TestBreakpointsRedefined(t *testing.T) {
+	ir := fast.New()
+	ir.Comp.Options |= OptDebugger
+	d := &breakpointRecorder{}
+	ir.SetDebugger(d)
+
+	bp := ir.SetFuncBreakpoint("twice")
+	for i := 0; i < 3; i++ {
+		ir.Eval("func twice(a int) int {\n\tf := func() int { return a * 2 }\n\treturn f()\n}")
+	}
+	if bps := ir.Breakpoints(); bps[0].Locations != 1 {
+		t.Errorf("expecting 1 location after redefining the function, found %d", bps[0].Locations)
+	}
+	ir.Eval("twice(1)")
+	if len(d.lines) != 1 {
+		t.Errorf("expecting 1 stop, found %d", len(d.lines))
+	}
+	ir.DeleteBreakpoint(bp.ID)
+}
+
+func TestBreakpointsFuncLit(t *testing.T) {
+	ir := fast.New()
+	ir.Comp.Options |= OptDebugger
+	d := &breakpointRecorder{}
+	ir.SetDebugger(d)
+
+	file := filepath.Join(t.TempDir(), "handler.gomacro")
+	src := "package main\n\nvar handler = func(a int) int {\n\tb := a * 2\n\treturn b\n}\n"
+	if err := os.WriteFile(file, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := ir.EvalFile(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bp := ir.SetBreakpoint("handler.gomacro", 5)
+	if bp.Locations != 1 {
+		t.Errorf("expecting 1 location in a top-level function literal, found %d", bp.Locations)
+	}
+	ir.Eval("handler(1)")
+	if len(d.lines) != 1 || d.lines[0] != 5 {
+		t.Errorf("expecting a stop at line 5, found %v", d.lines)
+	}
+	ir.DeleteBreakpoint(bp.ID)
+}
+
+func TestBreakpointsConcurrent(t *testing.T) {
+	ir := fast.New()
+	ir.Comp.Options |= OptDebugger
+	d := &breakpointRecorder{}
+	ir.SetDebugger(d)
+
+	file := filepath.Join(t.TempDir(), "concurrent.gomacro")
+	src := "package main\n\nfunc spin(n int) int {\n\ttotal := 0\n\tfor i := 0; i < n; i++ {\n\t\ttotal += func() int { return i }()\n\t}\n\treturn total\n}\n"
+	if err := os.WriteFile(file, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ir.EvalFile(file); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan []xr.Value)
+	go func() {
+		vals, _ := ir.Eval("spin(20000)")
+		done <- vals
+	}()
+	// set and delete breakpoints while spin() executes
+	for i := 0; i < 100; i++ {
+		bp := ir.AddBreakpoint(fast.Breakpoint{File: "concurrent.gomacro", Line: 6, Cond: "false"})
+		ir.DeleteBreakpoint(bp.ID)
+	}
+	if vals := <-done; len(vals) != 1 || vals[0].Interface() != 20000*19999/2 {
+		t.Errorf("expecting %d, found %v", 20000*19999/2, vals)
+	}
+	// breakpoints added with a false condition never stop
+	if len(d.lines) != 0 {
+		t.Errorf("expecting no stops, found %d", len(d.lines))
+	}
+}
+
+func TestWatchpoints(t *testing.T) {
+	ir := fast.New()
+	ir.Comp.Options |= OptDebugger
+	d := &breakpointRecorder{}
+	ir.SetDebugger(d)
+
+	ir.Eval("var x, y int")
+	w, err := ir.SetWatchpoint("x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ir.SetWatchpoint("nosuchvar"); err == nil {
+		t.Errorf("expecting an error watching an undefined variable")
+	}
+	vals, _ := ir.Eval("func incr() {\n\tx++\n}\ny = 7\nx = 3\nincr()\ny = x\nx")
+	expected := []string{"5: x 0 -> 3", "2: x 3 -> 4"}
+	if fmt.Sprint(d.changes) != fmt.Sprint(expected) {
+		t.Errorf("expecting watchpoint changes %v, found %v", expected, d.changes)
+	}
+	if len(vals) != 1 || vals[0].Interface() != 4 {
+		t.Errorf("expecting 4, found %v", vals)
+	}
+
+	d.changes = nil
+	ir.EnableBreakpoint(w.ID, false)
+	ir.Eval("x = 5")
+	ir.EnableBreakpoint(w.ID, true)
+	ir.Eval("x = 6")
+	if expected := []string{"1: x 5 -> 6"}; fmt.Sprint(d.changes) != fmt.Sprint(expected) {
+		t.Errorf("expecting watchpoint changes %v, found %v", expected, d.changes)
+	}
+
+	// modifying the elements of slices and maps
+	d.changes = nil
+	ir.Eval("s := []int{1, 2}; m := map[string]int{}")
+	ws, _ := ir.SetWatchpoint("s")
+	wm, _ := ir.SetWatchpoint("m")
+	ir.Eval("s[0] = 3")
+	ir.Eval(`m["a"] = 4`)
+	if expected := []string{"1: s [1 2] -> [3 2]", "1: m map[] -> map[a:4]"}; fmt.Sprint(d.changes) != fmt.Sprint(expected) {
+		t.Errorf("expecting watchpoint changes %v, found %v", expected, d.changes)
+	}
+	ir.DeleteBreakpoint(ws.ID)
+	ir.DeleteBreakpoint(wm.ID)
+
+	d.changes = nil
+	ir.DeleteBreakpoint(w.ID)
+	ir.Eval("x = 7")
+	if len(d.changes) != 0 || len(ir.Watchpoints()) != 0 {
+		t.Errorf("expecting no watchpoints, found changes %v", d.changes)
+	}
+}
+
+func TestDebuggerFrames(t *testing.T) {
+	ir := fast.New()
+	ir.Comp.Options |= OptDebugger | OptShowEval | OptShowEvalType
+	ir.SetDebugger(&debug.Debugger{})
+
+	var out bytes.Buffer
+	g := &ir.Comp.Globals
+	g.Stdout, g.Stderr = &out, &out
+	cmds := "print x + 1\nup\nprint y\nvars\nframe 0\nprint x\ndown\nbacktrace\ncontinue\n"
+	g.Readline = MakeBufReadline(bufio.NewReader(strings.NewReader(cmds)))
+
+	ir.Eval("func inner(x int) int {\n\t_ = \"break\"\n\treturn x * 2\n}")
+	ir.Eval("func outer(y int) int {\n\tz := y + 1\n\treturn inner(z)\n}")
+	vals, _ := ir.Eval("outer(4)")
+	if len(vals) != 1 || vals[0].Interface() != 10 {
+		t.Errorf("expecting 10, found %v", vals)
+	}
+	// print x + 1 in inner, print y in outer, vars shows z in outer, print x in inner again
+	for _, expected := range []string{
+		"6\t// int\n",
+		"// frame 1 at ",
+		"4\t// int\n",
+		"z\t= 5\t// int\n",
+		"5\t// int\n",
+		"// innermost frame selected, cannot go down\n",
+		"*#0\t",
+	} {
+		if i := strings.Index(out.String(), expected); i < 0 {
+			t.Fatalf("expecting debugger output to contain %q, found:\n%s", expected, out.String())
+		} else {
+			out.Next(i + len(expected))
+		}
+	}
+}
+
+func TestRunGoFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, src := range map[string]string{
+		"a.go":      "package main\n\nvar x = y + 1\n\nfunc init() { trace = append(trace, \"a.init1\") }\nfunc init() { trace = append(trace, \"a.init2\") }\n\nfunc main() { trace = append(trace, \"main\") }\n",
+		"b.go":      "package main\n\nvar trace = []string{\"vars\"}\n\nvar y = twice(3)\n\nfunc twice(n int) int { return n * 2 }\n\nfunc init() { trace = append(trace, \"b.init\") }\n",
+		"b_test.go": "package main\n\nfunc init() { panic(\"test files must be excluded\") }\n",
+		"c.go":      "//go:build ignore\n\npackage main\n\nfunc init() { panic(\"ignored files must be excluded\") }\n",
+		"panic.go":  "//go:build ignore\n\npackage main\n\nfunc main() { panic(\"boom\") }\n",
+		"error.go":  "//go:build ignore\n\npackage main\n\nfunc main() { undefined_func() }\n",
+		"const.go":  "//go:build ignore\n\npackage main\n\nfunc main() {\n\tvar x int = \"x\"\n\t_ = x\n}\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := fast.GoFiles(dir)
+	if err != nil || len(files) != 2 || filepath.Base(files[0]) != "a.go" || filepath.Base(files[1]) != "b.go" {
+		t.Fatalf("expecting files a.go and b.go, found %v, error %v", files, err)
+	}
+	ir := fast.New()
+	if code, err := ir.RunGoFiles(files...); code != 0 || err != nil {
+		t.Fatalf("expecting exit code 0, found %d, error %v", code, err)
+	}
+	trace := ir.ValueOf("trace").Interface()
+	if expected := []string{"vars", "a.init1", "a.init2", "b.init", "main"}; !r.DeepEqual(trace, expected) {
+		t.Errorf("expecting %v, found %v", expected, trace)
+	}
+	if x := ir.ValueOf("x").Interface(); x != 7 {
+		t.Errorf("expecting x = 7, found %v", x)
+	}
+
+	code, err := fast.New().RunGoFiles(filepath.Join(dir, "panic.go"))
+	if code != 2 || err == nil || err.Error() != "panic: boom" {
+		t.Errorf("expecting exit code 2 and error \"panic: boom\", found %d, error %v", code, err)
+	}
+	code, err = fast.New().RunGoFiles(filepath.Join(dir, "error.go"))
+	if code != 1 || err == nil || !strings.Contains(err.Error(), "undefined_func") {
+		t.Errorf("expecting exit code 1 and a compile error, found %d, error %v", code, err)
+	}
+	// compile errors report the file, line and column
+	code, err = fast.New().RunGoFiles(filepath.Join(dir, "error.go"), filepath.Join(dir, "const.go"))
+	if code != 1 || err == nil || !strings.HasPrefix(err.Error(), filepath.Join(dir, "error.go")+":5:15: ") {
+		t.Errorf("expecting exit code 1 and an error at error.go:5:15, found %d, error %v", code, err)
+	}
+	code, err = fast.New().RunGoFiles(filepath.Join(dir, "const.go"))
+	if code != 1 || err == nil || !strings.HasPrefix(err.Error(), filepath.Join(dir, "const.go")+":6:14: ") {
+		t.Errorf("expecting exit code 1 and an error at const.go:6:14, found %d, error %v", code, err)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	ir := fast.New()
+	ir.Comp.Options |= OptDebugger // to show function names in stack traces
+	checkError := func(err error, kind fast.ErrorKind, line int, column int, msg string) *fast.EvalError {
+		t.Helper()
+		e, ok := err.(*fast.EvalError)
+		if !ok {
+			t.Fatalf("expecting *fast.EvalError, found %v <%T>", err, err)
+		}
+		if e.Kind != kind || e.Pos.Line != line || (column != 0 && e.Pos.Column != column) || !strings.Contains(e.Msg, msg) {
+			t.Errorf("expecting %v at %d:%d containing %q, found %v at %v: %q", kind, line, column, msg, e.Kind, e.Pos, e.Msg)
+		}
+		return e
+	}
+	_, _, err := ir.EvalE("x := )")
+	checkError(err, fast.ParseError, 1, 6, "expected operand")
+
+	_, _, err = ir.EvalE("var s string\ns = true")
+	checkError(err, fast.CompileError, 2, 1, "cannot convert")
+
+	_, _, err = ir.EvalE("func inner(n int) int {\n\tif n > 2 {\n\t\tpanic(\"boom\")\n\t}\n\treturn n\n}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = ir.EvalE("func outer(n int) int {\n\tdefer func() {}()\n\treturn inner(n + 1)\n}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = ir.EvalE("outer(2)")
+	e := checkError(err, fast.RuntimePanic, 3, 0, "boom")
+	if e.Panic != "boom" || len(e.Stack) != 3 || e.Stack[0].Func != "inner" || e.Stack[1].Func != "outer" || e.Stack[2].Func != "" {
+		t.Errorf("expecting panic boom with stack inner, outer, <toplevel>, found %v with stack:\n%s", e.Panic, e.StackTrace())
+	}
+	if e.Stack[1].Pos.Line != 3 {
+		t.Errorf("expecting outer at line 3, found %v", e.Stack[1].Pos)
+	}
+
+	_, _, err = ir.EvalE("func div(a, b int) int {\n\treturn a / b\n}\ndiv(1, 0)")
+	if e := checkError(err, fast.RuntimePanic, 2, 0, "divide by zero"); e.Err == nil {
+		t.Errorf("expecting an underlying error, found %v", e)
+	}
+
+	// the interpreter is still usable after errors
+	if v, _, err := ir.Eval1E("outer(0)"); err != nil || v.Interface() != 1 {
+		t.Errorf("expecting 1, found %v, error %v", v, err)
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	ir := fast.New()
+	ir.Eval("func spin() {\n\tfor {\n\t}\n}")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, _, err := ir.EvalContext(ctx, "spin()"); err != context.DeadlineExceeded {
+		t.Errorf("expecting error %v, found %v", context.DeadlineExceeded, err)
+	}
+
+	// goroutines started by the evaluation are interrupted too, and execute their defers
+	ir.Eval("done := make(chan bool)")
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if _, _, err := ir.EvalContext(ctx, "go func() {\n\tdefer func() { close(done) }()\n\tspin()\n}()\nspin()"); err != context.Canceled {
+		t.Errorf("expecting error %v, found %v", context.Canceled, err)
+	}
+	select {
+	case <-ir.ValueOf("done").Interface().(chan bool):
+	case <-time.After(5 * time.Second):
+		t.Errorf("goroutine started by interpreted code was not interrupted")
+	}
+
+	// an already cancelled context does not execute anything
+	if _, _, err := ir.EvalContext(ctx, "panic(\"should not run\")"); err != context.Canceled {
+		t.Errorf("expecting error %v, found %v", context.Canceled, err)
+	}
+	// the interpreter is still usable
+	if v, _, err := ir.Eval1E("1 + 2"); err != nil || v.Interface() != 3 {
+		t.Errorf("expecting 3, found %v, error %v", v, err)
+	}
+	vals, _, err := ir.EvalContext(context.Background(), "7 * 6")
+	if err != nil || len(vals) != 1 || vals[0].Interface() != 42 {
+		t.Errorf("expecting 42, found %v, error %v", vals, err)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	ir := fast.New()
+	ir.Eval("func fib(n int) int {\n\tif n < 2 {\n\t\treturn n\n\t}\n\treturn fib(n-1) + fib(n-2)\n}")
+	ir.Eval("func spin() (n int) {\n\tdefer func() { recover() }()\n\tfor {\n\t\tn++\n\t}\n}")
+	ir.SetBudget(fast.Budget{Statements: 10000, Goroutines: 2, AllocBytes: 1000})
+
+	for _, test := range []struct {
+		src, resource string
+	}{
+		{"fib(30)", "statements"},
+		{"spin()", "statements"}, // recover() cannot resume execution
+		{"go spin()\nfor {\n}", "statements"},
+		{"for i := 0; i < 3; i++ {\n\tgo func() {}()\n}", "goroutines"},
+		{"make([]byte, 2000)", "bytes"},
+		{"new([200]int)", "bytes"},
+		{"[]int{199: 0}", "bytes"},
+		{"var s []int\nfor i := 0; i < 1000; i++ {\n\ts = append(s, i)\n}", "bytes"},
+	} {
+		_, _, err := ir.EvalE(test.src)
+		if e, ok := err.(*fast.BudgetError); !ok || e.Resource != test.resource {
+			t.Errorf("%q: expecting budget exceeded for %s, found %v", test.src, test.resource, err)
+		}
+	}
+	// the budget applies to each evaluation
+	for i := 0; i < 3; i++ {
+		if v, _, err := ir.Eval1E("fib(10)"); err != nil || v.Interface() != 55 {
+			t.Errorf("expecting 55, found %v, error %v", v, err)
+		}
+	}
+	func() {
+		defer func() {
+			if e, ok := recover().(*fast.BudgetError); !ok || e.Resource != "statements" {
+				t.Errorf("Eval: expecting panic with budget exceeded for statements, found %v", e)
+			}
+		}()
+		ir.Eval("fib(30)")
+	}()
+	ir.SetBudget(fast.Budget{})
+	if v, _, err := ir.Eval1E("fib(20)"); err != nil || v.Interface() != 6765 {
+		t.Errorf("expecting 6765, found %v, error %v", v, err)
+	}
+}
+
+func TestProgram(t *testing.T) {
+	ir := fast.New()
+	ir.Eval(`import "strings"`)
+	prog, err := ir.CompileProgram(`
+func fib(n int) int {
+	if n < 2 {
+		return n
+	}
+	return fib(n-1) + fib(n-2)
+}
+var total int
+for i := 0; i < n; i++ {
+	total += fib(i)
+}
+strings.Repeat(name, 2)`, map[string]xr.Type{"n": ir.TypeOf(0), "name": ir.TypeOf("")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// executions are independent, also when concurrent
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for n := 0; n < 20; n++ {
+				name := fmt.Sprint(g)
+				res, err := prog.Run(map[string]interface{}{"n": n, "name": name})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if total := res.ValueOf("total"); total.Int() != int64(fib(n+1)-1) {
+					t.Errorf("n = %d: expecting total = %d, found %v", n, fib(n+1)-1, total)
+				}
+				if len(res.Values) != 1 || res.Values[0].String() != name+name {
+					t.Errorf("expecting result %q, found %v", name+name, res.Values)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// declarations of the program do not leak into the interpreter
+	if v := ir.ValueOf("total"); v.IsValid() {
+		t.Errorf("expecting no variable total in the interpreter, found %v", v)
+	}
+	if _, err = prog.Run(map[string]interface{}{"m": 1}); err == nil {
+		t.Errorf("expecting error for unknown input m")
+	}
+	prog, err = ir.CompileProgram("var a []int\na[3] = 1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = prog.Run(nil); err == nil || err.(*fast.EvalError).Kind != fast.RuntimePanic {
+		t.Errorf("expecting runtime panic, found %v", err)
+	}
+	if _, err = ir.CompileProgram("x := ", nil); err == nil || err.(*fast.EvalError).Kind != fast.ParseError {
+		t.Errorf("expecting parse error, found %v", err)
+	}
+}
+
+func fib(n int) int {
+	if n < 2 {
+		return n
+	}
+	return fib(n-1) + fib(n-2)
+}
+
+func TestSandbox(t *testing.T) {
+	ir := fast.New()
+	ir.SetSandbox(&fast.Sandbox{
+		AllowImports: []string{"fmt", "os", "strings", "golang.org/x/..."},
+		AllowSymbols: []string{"fmt.Sprint"},
+		DenySymbols:  []string{"os.Remove", "os.File"},
+		NoPlugins:    true,
+	})
+	for _, src := range []string{
+		`import "strings"`,
+		`strings.ToUpper("a")`,
+		`import "os"`,
+		`os.Getpid()`,
+		`import "fmt"`,
+		`fmt.Sprint(1)`,
+	} {
+		if _, _, err := ir.EvalE(src); err != nil {
+			t.Errorf("%q: unexpected error %v", src, err)
+		}
+	}
+	for _, test := range []struct {
+		src, err string
+	}{
+		{`import "os/exec"`, `import "os/exec" is not allowed by the sandbox`},
+		{`os.Remove("x")`, `use of os.Remove is not allowed by the sandbox`},
+		{`f := os.Remove`, `use of os.Remove is not allowed by the sandbox`},
+		{`var f *os.File`, `use of os.File is not allowed by the sandbox`},
+		{`fmt.Println(1)`, `use of fmt.Println is not allowed by the sandbox`},
+		{`import "golang.org/x/nonexistent"`, `sandbox does not allow compiling plugins`},
+	} {
+		_, _, err := ir.EvalE(test.src)
+		if e, ok := err.(*fast.EvalError); !ok || e.Kind != fast.CompileError || !strings.Contains(e.Msg, test.err) {
+			t.Errorf("%q: expecting compile error %q, found %v", test.src, test.err, err)
+		}
+	}
+	// dot imports omit the symbols that cannot be used
+	ir.Eval(`import . "os"`)
+	if _, _, err := ir.EvalE(`Remove("x")`); err == nil || !strings.Contains(err.Error(), "undefined identifier: Remove") {
+		t.Errorf("expecting undefined identifier Remove, found %v", err)
+	}
+	// removing the sandbox allows everything again
+	ir.SetSandbox(nil)
+	if _, _, err := ir.EvalE(`fmt.Println != nil`); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	ir := fast.New()
+	ir.Eval(`type node struct { val int; next *node; tags map[string]int }`)
+	ir.Eval(`n := 3; p := &n; s := []int{1, 2, 3}; head := &node{1, nil, map[string]int{"x": 1}}; head.next = head`)
+	ir.Eval(`func get() int { return n }`)
+	snap := ir.Snapshot()
+
+	ir.Eval(`n = 100; s[0] = 42; s = append(s, 4); head.val = 7; head.tags["y"] = 2`)
+	ir.Eval(`import "strings"; var extra = 1; func get() int { return -1 }`)
+	for round := 0; round < 2; round++ {
+		if err := ir.Restore(snap); err != nil {
+			t.Fatal(err)
+		}
+		for _, test := range []struct {
+			src    string
+			result interface{}
+		}{
+			{`n`, 3},
+			{`get()`, 3},
+			{`p == &n`, true},
+			{`len(s)`, 3},
+			{`s[0]`, 1},
+			{`head.val`, 1},
+			{`head.next == head`, true},
+			{`len(head.tags)`, 1},
+		} {
+			if v, _, err := ir.Eval1E(test.src); err != nil || v.Interface() != test.result {
+				t.Errorf("round %d: %s: expecting %v, found %v %v", round, test.src, test.result, v, err)
+			}
+		}
+		for _, src := range []string{`extra`, `strings.ToUpper("a")`} {
+			if _, _, err := ir.EvalE(src); err == nil {
+				t.Errorf("round %d: %s: expecting undefined identifier", round, src)
+			}
+		}
+		ir.Eval(`n = 9; head.val = 9`)
+	}
+	if err := fast.New().Restore(snap); err == nil {
+		t.Errorf("expecting error restoring a snapshot of a different interpreter")
+	}
+}
+
+func TestSnapshotCompiledTypes(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "snapshot.txt")
+	if err := os.WriteFile(file, []byte("snapshot"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ir := fast.New()
+	ir.DeclVar("file", nil, file)
+	ir.Eval(`import ("fmt"; "io"; "os"; "time")`)
+	ir.Eval(`f, _ := os.Open(file); out := os.Stdout; tm := time.Now()`)
+	ir.Restore(ir.Snapshot())
+	// a copy of *os.File would close the file descriptor when garbage collected
+	runtime.GC()
+	runtime.GC()
+	for _, test := range []struct {
+		src    string
+		result interface{}
+	}{
+		{`out == os.Stdout`, true},
+		{`tm.Location() == time.Local`, true},
+		{`data, err := io.ReadAll(f); string(data) + fmt.Sprint(err)`, "snapshot<nil>"},
+	} {
+		if v, _, err := ir.Eval1E(test.src); err != nil || v.Interface() != test.result {
+			t.Errorf("%s: expecting %v, found %v %v", test.src, test.result, v, err)
+		}
+	}
+	ir.Eval(`f.Close()`)
+}
+
+type builderUser struct {
+	Name string
+}
+
+var builderCounter int
+
+func TestPackageBuilder(t *testing.T) {
+	err := imports.NewPackageBuilder("example.com/app/api").
+		Func("Describe", func(s fmt.Stringer) string { return "<" + s.String() + ">" }).
+		Var("Counter", &builderCounter).
+		Const("Max", 10).
+		UntypedConst("Big", constant.MakeFromLiteral("1000000000000000000000", token.INT, 0)).
+		Type("User", r.TypeOf(builderUser{})).
+		Type("Stringer", r.TypeOf((*fmt.Stringer)(nil)).Elem()).
+		Register()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ir := fast.New()
+	ir.Eval(`import "example.com/app/api"`)
+	ir.Eval(`api.Counter = 5`)
+	if builderCounter != 5 {
+		t.Errorf("expecting Counter = 5, found %d", builderCounter)
+	}
+	// the proxy of fmt.Stringer allows interpreted types to implement api.Stringer
+	ir.Eval(`type T int; func (t T) String() string { return "T" }`)
+	ir.Eval(`x := T(1); var s api.Stringer = x`)
+	for _, test := range []struct {
+		src    string
+		result interface{}
+	}{
+		{`api.Max`, 10},
+		{`api.Big / 1000000000000`, 1000000000},
+		{`api.User{Name: "x"}.Name`, "x"},
+		{`api.Describe(s)`, "<T>"},
+	} {
+		if v, _, err := ir.Eval1E(test.src); err != nil || v.Interface() != test.result {
+			t.Errorf("%s: expecting %v, found %v %v", test.src, test.result, v, err)
+		}
+	}
+	for _, test := range []struct {
+		b   *imports.PackageBuilder
+		err string
+	}{
+		{imports.NewPackageBuilder("x").Func("f", fmt.Sprint), `invalid name "f"`},
+		{imports.NewPackageBuilder("x").Func("F", 3), `expecting a non-nil function`},
+		{imports.NewPackageBuilder("x").Var("V", builderCounter), `expecting a non-nil pointer`},
+		{imports.NewPackageBuilder("x").Const("C", 1).Var("C", &builderCounter), `C redeclared`},
+		{imports.NewPackageBuilder("x").Type("S", r.TypeOf((*fmt.Stringer)(nil)).Elem()).
+			Proxy("S", r.TypeOf(builderUser{})), `does not implement the interface`},
+	} {
+		if err := test.b.Register(); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("expecting error %q, found %v", test.err, err)
+		}
+	}
+}
+
+func TestMethodProxy(t *testing.T) {
+	ir := fast.New()
+	ir.Eval(`import ("encoding/json"; "fmt"; "sort")`)
+	ir.Eval(`type T int; func (t T) String() string { return fmt.Sprint("T", int(t)) }`)
+	ir.Eval(`type E struct{ msg string }; func (e *E) Error() string { return "E:" + e.msg }`)
+	ir.Eval(`type S []int; func (s S) Len() int { return len(s) }; func (s S) Less(i, j int) bool { return s[i] > s[j] }; func (s S) Swap(i, j int) { s[i], s[j] = s[j], s[i] }`)
+	ir.Eval(`type P struct { X int }; func (p P) MarshalJSON() ([]byte, error) { return []byte(fmt.Sprint(p.X * 10)), nil }`)
+	ir.Eval(`func (p *P) UnmarshalJSON(b []byte) error { p.X = len(b); return nil }`)
+	ir.Eval(`x := T(1); var s fmt.Stringer = x`)
+	for _, test := range []struct {
+		src    string
+		result interface{}
+	}{
+		{`fmt.Sprint(x, &x)`, "T1 T1"},
+		{`fmt.Sprintf("%v|%d|%4s|%q", x, x, x, x)`, `T1|1|  T1|"T1"`},
+		{`fmt.Sprintf("%v|%d", s, s)`, "T1|1"},
+		{`fmt.Sprint(&E{"boom"})`, "E:boom"},
+		{`v := S{1, 3, 2}; sort.Sort(v); fmt.Sprint(v)`, "[3 2 1]"},
+		{`b, _ := json.Marshal(P{4}); string(b)`, "40"},
+		{`var p P; json.Unmarshal([]byte("[1,2]"), &p); p.X`, 5},
+		{`b2, _ := json.Marshal(x); string(b2)`, "1"},
+		// typed constants
+		{`fmt.Sprint(T(2))`, "T2"},
+		{`const k T = 3; fmt.Sprintf("%v|%d", k, k)`, "T3|3"},
+		{`fmt.Sprint(1, k)`, "1 T3"},
+		// compiled pointers to non-struct types
+		{`import "time"; var sd fmt.Stringer = new(time.Duration); fmt.Sprint(sd)`, "0s"},
+	} {
+		if v, _, err := ir.Eval1E(test.src); err != nil || v.Interface() != test.result {
+			t.Errorf("%s: expecting %v, found %v %v", test.src, test.result, v, err)
+		}
+	}
+	// interpreted functions receive the values unchanged
+	if v, _, err := ir.Eval1E(`func ident(a interface{}) interface{} { return a }; ident(x) == ident(x)`); err != nil || v.Interface() != true {
+		t.Errorf("expecting true, found %v %v", v, err)
+	}
+	if err := ir.AddMethodProxy("strings", r.TypeOf((*fmt.Stringer)(nil)).Elem(), nil); err != nil {
+		t.Error(err)
+	}
+	if err := ir.AddMethodProxy("strings", r.TypeOf(0), nil); err == nil {
+		t.Errorf("expecting error for non-interface type")
+	}
+}
+
+type exportNode struct {
+	Val  int
+	name string
+	Next *exportNode
+	Kids []*exportNode
+	M    map[string]*exportNode
+	S    fmt.Stringer
+}
+
+func TestExportAs(t *testing.T) {
+	ir := fast.New()
+	ir.Eval(`import "fmt"`)
+	ir.Eval(`type T int`)
+	ir.Eval(`func (t T) String() string { return fmt.Sprint("T", int(t)) }`)
+	ir.Eval(`type Stringer interface { String() string }`)
+	ir.Eval(`type Node struct { Val int; name string; Next *Node; Kids []*Node; M map[string]*Node; S Stringer }`)
+	v, _ := ir.Eval1(`x := T(7); var s Stringer = x; n := &Node{Val: 1, name: "a", S: s}; n.Next = &Node{Val: 2, Next: n}; n.Kids = []*Node{n.Next}; n.M = map[string]*Node{"self": n}; n`)
+
+	out, err := ir.ExportAs(v, r.TypeOf((*exportNode)(nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := out.Interface().(*exportNode)
+	if n.Val != 1 || n.name != "a" || n.Next.Val != 2 || n.Next.Next != n || n.Kids[0] != n.Next || n.M["self"] != n || n.Next.M != nil {
+		t.Errorf("ExportAs: wrong result %+v", n)
+	}
+	if n.S == nil || n.S.String() != "T7" {
+		t.Errorf("ExportAs: expecting interpreted String() method, found %v", n.S)
+	}
+
+	n.Val, n.Next.name = 10, "b"
+	tnode := ir.Comp.Universe.PtrTo(ir.Comp.ResolveType("Node"))
+	in, err := ir.ImportAs(n, tnode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ir.DeclVar("m", tnode, in.Interface())
+	if v, _, err := ir.Eval1E(`fmt.Sprintf("%v %v %v %v %v %v", m.Val, m.Next.name, m.Next.Next == m, m.Kids[0] == m.Next, m.M["self"] == m, m.S.String())`); err != nil || v.Interface() != "10 b true true true T7" {
+		t.Errorf("ImportAs: wrong result %v %v", v, err)
+	}
+
+	if _, err := ir.ExportAs(v, r.TypeOf(exportNode{})); err == nil {
+		t.Errorf("ExportAs: expecting error converting a pointer to a struct")
+	}
+	if _, err := ir.ExportAs(v, r.TypeOf((*struct{ Val int })(nil))); err == nil {
+		t.Errorf("ExportAs: expecting error for mismatched struct fields")
+	}
+}
+
+var recoverCaught interface{}
+
+func TestRecoverMixed(t *testing.T) {
+	err := imports.NewPackageBuilder("example.com/app/safe").
+		// compiled defer helper, deferred by interpreted code
+		Func("Catch", func() { recoverCaught = recover() }).
+		Func("Caught", func() interface{} { return recoverCaught }).
+		// compiled defer helpers with arguments
+		Func("Recover", func(err *error) {
+			if rec := recover(); rec != nil {
+				*err = fmt.Errorf("recovered: %v", rec)
+			}
+		}).
+		Func("CatchAs", func(name string) { recoverCaught = name + ": " + fmt.Sprint(recover()) }).
+		// compiled middleware, recovering panics of interpreted code
+		Func("Protect", func(f func()) (rec interface{}) {
+			defer func() { rec = recover() }()
+			f()
+			return nil
+		}).
+		// compiled code deferring interpreted code
+		Func("Panic", func(f func()) {
+			defer f()
+			panic("compiled")
+		}).
+		Func("Defer", func(f func()) {
+			defer f()
+		}).
+		Register()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ir := fast.New()
+	ir.Eval(`import ("example.com/app/safe"; "fmt")`)
+	for _, test := range []struct {
+		src    string
+		result interface{}
+	}{
+		{`func f1() (x int) { defer safe.Catch(); x = 1; panic("boom") }; fmt.Sprint(f1(), " ", safe.Caught())`, "1 boom"},
+		{`func f2() (r interface{}) { defer func() { r = recover() }(); defer safe.Catch(); panic("twice") }; fmt.Sprint(f2(), " ", safe.Caught())`, "<nil> twice"},
+		{`fmt.Sprint(safe.Protect(func() { panic("handler") }))`, "handler"},
+		{`func f3() (s string) { s = fmt.Sprint(safe.Protect(func() { panic("p") })); for i := 0; i < 100; i++ { s += "." }; return s[:3] }; f3()`, "p.."},
+		{`var r1 interface{}; safe.Panic(func() { r1 = recover() }); fmt.Sprint(r1)`, "compiled"},
+		{`func f4() (r interface{}) { defer func() { r = recover() }(); safe.Panic(func() {}); return }; fmt.Sprint(f4())`, "compiled"},
+		{`func f5() (r interface{}) { r = "none"; safe.Defer(func() { r = recover() }); return }; fmt.Sprint(f5())`, "<nil>"},
+		{`func f6() interface{} { ch := make(chan interface{}); go func() { var r interface{}; safe.Panic(func() { r = recover() }); ch <- r }(); return <-ch }; fmt.Sprint(f6())`, "compiled"},
+		{`func g1() (err error) { defer safe.Recover(&err); panic("args") }; fmt.Sprint(g1())`, "recovered: args"},
+		{`func g2() { defer safe.CatchAs("g2"); panic("name") }; g2(); fmt.Sprint(safe.Caught())`, "g2: name"},
+		{`func g3() { catch := safe.Catch; defer catch(); panic("var") }; g3(); fmt.Sprint(safe.Caught())`, "var"},
+		{`func g4() (r interface{}) { h := func() { r = recover() }; defer h(); panic("interp") }; fmt.Sprint(g4())`, "interp"},
+		{`func g5() (r interface{}) { h := func(s string) { r = s + fmt.Sprint(recover()) }; defer h("x"); panic("y") }; fmt.Sprint(g5())`, "xy"},
+		{`func f7() interface{} { ch := make(chan interface{}); go func() { defer func() { ch <- recover() }(); safe.Protect(func() { go func() {}(); panic("nested") }); panic("after") }(); return <-ch }; fmt.Sprint(f7())`, "after"},
+	} {
+		if v, _, err := ir.Eval1E(test.src); err != nil || v.Interface() != test.result {
+			t.Errorf("%s: expecting %v, found %v %v", test.src, test.result, v, err)
+		}
+	}
+}
+
+func TestAutoImport(t *testing.T) {
+	ir := fast.New()
+	if _, _, err := ir.Eval1E(`strings.ToUpper("x")`); err == nil {
+		t.Errorf("expecting undefined identifier strings without option Import.Auto")
+	}
+	ir.Cmd(":options Import.Auto")
+	ir.Comp.Options |= OptCollectDeclarations
+	ir.SetAutoImport("str", "strings")
+	for _, test := range []struct {
+		src    string
+		result interface{}
+	}{
+		{`strings.ToUpper("abc")`, "ABC"},
+		{`func join() string { var b bytes.Buffer; b.WriteString("x"); return b.String() }; join()`, "x"},
+		{`rand.Intn(1)`, 0},
+		{`str.Repeat("a", 2)`, "aa"},
+		{`filepath := "f"; filepath + "."`, "f."},
+	} {
+		if v, _, err := ir.Eval1E(test.src); err != nil || v.Interface() != test.result {
+			t.Errorf("%s: expecting %v, found %v %v", test.src, test.result, v, err)
+		}
+	}
+	if _, _, err := ir.Eval1E(`nosuchpackage.Foo`); err == nil {
+		t.Errorf("expecting undefined identifier nosuchpackage")
+	}
+	var buf bytes.Buffer
+	ir.Comp.WriteDeclsToStream(&buf)
+	for _, imp := range []string{`import "strings"`, `import "bytes"`, `import "math/rand"`, `import str "strings"`} {
+		if !strings.Contains(buf.String(), imp+"\n") {
+			t.Errorf("expecting %s in written declarations, found:\n%s", imp, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "path/filepath") {
+		t.Errorf("unexpected import of path/filepath, found:\n%s", buf.String())
+	}
+}
+
+func TestComplete(t *testing.T) {
+	ir := fast.New()
+	ir.Eval(`import ("net/http"; "strings")`)
+	ir.Eval(`type In struct { A, B int }; func (i In) Get() int { return i.A }; type Out struct { F In; G *In; In }`)
+	ir.Eval(`func (o *Out) Sum() int { return 0 }`)
+	ir.Eval(`var req *http.Request; var x Out; var s []Out; var calls int; func count() Out { calls++; return x }`)
+	for _, test := range []struct {
+		line  string
+		head  string
+		names []string
+	}{
+		{"req.Hea", "req.", []string{"Header"}},
+		{"req.Clo", "req.", []string{"Clone", "Close"}},
+		{"x.", "x.", []string{"A", "B", "F", "G", "Get", "In", "Sum"}},
+		{"x.G.", "x.G.", []string{"A", "B", "Get"}},
+		{"y := s[0].F.G", "y := s[0].F.", []string{"Get"}},
+		{"count().S", "count().", []string{"Sum"}},
+		{`strings.Fields("a")[0].L`, `strings.Fields("a")[0].`, []string{"Len", "Less"}}, // CTI basic methods
+		{"fmt.Println(strings.Rep", "fmt.Println(strings.", []string{"Repeat", "Replace", "ReplaceAll", "Replacer"}},
+		{"http.Header.G", "http.Header.", []string{"Get"}},
+		{"stri", "", []string{"string", "strings"}},
+		{`import "net/http/httpt`, `import "`, []string{"net/http/httptest", "net/http/httptrace"}},
+		{`import ( h "net/http/httpt`, `import ( h "`, []string{"net/http/httptest", "net/http/httptrace"}},
+	} {
+		head, completions, tail := ir.CompleteWords(test.line, len(test.line))
+		if head != test.head || tail != "" || !r.DeepEqual(completions, test.names) {
+			t.Errorf("complete %q: expecting %q %q, found %q %q %q", test.line, test.head, test.names, head, completions, tail)
+		}
+	}
+	if v := ir.ValueOf("calls"); v.Int() != 0 {
+		t.Errorf("completion executed code: calls = %v", v)
+	}
+	line := "n := strings.Repeat("
+	if _, completions, _ := ir.Complete(line, len(line)); len(completions) != 1 ||
+		completions[0].Name != "" || completions[0].Hint != "func(string, int) string" {
+		t.Errorf("complete %q: expecting signature hint, found %v", line, completions)
+	}
+}
+
+func TestCompleteModCache(t *testing.T) {
+	modcache := t.TempDir()
+	t.Setenv("GOMODCACHE", modcache)
+	for _, dir := range []string{"example.com/!lib@v1.9.0/old", "example.com/!lib@v1.10.0/new", "example.com/!lib@v1.10.0-rc.1/rc"} {
+		if err := os.MkdirAll(filepath.Join(modcache, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ir := fast.New()
+	line := `import "example.com/Lib/`
+	// the latest version is v1.10.0, although v1.9.0 sorts after it
+	if head, completions, _ := ir.CompleteWords(line, len(line)); head != `import "` || !r.DeepEqual(completions, []string{"example.com/Lib/new"}) {
+		t.Errorf("complete %q: expecting %q, found %q %q", line, "example.com/Lib/new", head, completions)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	home, root := t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	sub := filepath.Join(root, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(filename string, src string) {
+		if err := os.WriteFile(filename, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rcfile, profile := filepath.Join(home, cmd.RcFile), filepath.Join(root, cmd.ProfileFile)
+	write(rcfile, "import \"strings\"\nfunc shout(s string) string { return strings.ToUpper(s) + \"!\" }\n")
+	write(filepath.Join(root, "go.mod"), "module example.com/app\n")
+	write(profile, ":options Import.Auto\nvar greeting = shout(\"hi\")\n")
+
+	files := cmd.ProfileFiles(sub)
+	if expected := []string{rcfile, profile}; !r.DeepEqual(files, expected) {
+		t.Fatalf("expecting startup files %v, found %v", expected, files)
+	}
+	ir := fast.New()
+	if err := ir.LoadProfile(files...); err != nil {
+		t.Fatal(err)
+	}
+	if v := ir.ValueOf("greeting"); !v.IsValid() || v.Interface() != "HI!" {
+		t.Errorf("expecting greeting = \"HI!\", found %v", v)
+	}
+	if ir.Comp.Options&OptImportAuto == 0 {
+		t.Errorf("expecting option Import.Auto set by the profile")
+	}
+	write(profile, ":options Import.Auto\nvar greeting = shout(\"bye\")\n")
+	ir.ParseEvalPrint(":reload-profile")
+	if v := ir.ValueOf("greeting"); !v.IsValid() || v.Interface() != "BYE!" {
+		t.Errorf("expecting greeting = \"BYE!\" after :reload-profile, found %v", v)
+	}
+	if ir.Comp.Options&OptImportAuto == 0 {
+		t.Errorf("expecting option Import.Auto still set after :reload-profile")
+	}
+
+	// a profile in the current directory has precedence over the one in the module root
+	local := filepath.Join(sub, cmd.ProfileFile)
+	write(local, "var local = true\n")
+	if files, expected := cmd.ProfileFiles(sub), []string{rcfile, local}; !r.DeepEqual(files, expected) {
+		t.Errorf("expecting startup files %v, found %v", expected, files)
+	}
+}
+
+func TestResults(t *testing.T) {
+	ir := fast.New()
+	var out bytes.Buffer
+	ir.Comp.Stdout, ir.Comp.Stderr = &out, &out
+	ir.Comp.Options |= OptKeepUntyped | OptShowEval | OptShowEvalType
+	for _, line := range []string{
+		`import "strconv"`, `type Pair struct { A, B int }`, `var x = 5`,
+		`1 << 100`, `strconv.Atoi("12")`, `Pair{1, 2}`, `x`, `x = 9`,
+	} {
+		ir.ParseEvalPrint(line)
+	}
+	for _, test := range []struct {
+		src    string
+		result interface{}
+	}{
+		{`_1`, 5},
+		{`_2.B`, 2},
+		{`_3_1 + 1`, 13},
+		{`_3_2 == nil`, true},
+		{`int(_4 >> 98)`, 4}, // untyped constants stay exact
+	} {
+		if v, _, err := ir.Eval1E(test.src); err != nil || v.Interface() != test.result {
+			t.Errorf("%s: expecting %v, found %v %v", test.src, test.result, v, err)
+		}
+	}
+	// results shift after each evaluation
+	ir.ParseEvalPrint(`"new"`)
+	if v, _, err := ir.Eval1E(`_2`); err != nil || v.Interface() != 5 {
+		t.Errorf("_2: expecting 5, found %v %v", v, err)
+	}
+	out.Reset()
+	ir.ParseEvalPrint(":results")
+	for _, expected := range []string{"_2 = 5\t// int\n", "_3 = {A:1 B:2}\t// main.Pair\n", "_4_1 = 12\t// int\n", "_4_2 = <nil>\t// error\n"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf(":results: expecting %q, found:\n%s", expected, out.String())
+		}
+	}
+
+	if err := ir.SetResultHistory("out", 2); err != nil {
+		t.Fatal(err)
+	}
+	if v, _, err := ir.Eval1E(`out2`); err != nil || v.Interface() != 5 {
+		t.Errorf("out2: expecting 5, found %v %v", v, err)
+	}
+	for _, name := range []string{"_1", "out3"} {
+		if _, _, err := ir.Eval1E(name); err == nil {
+			t.Errorf("%s: expecting undefined identifier", name)
+		}
+	}
+	if err := ir.SetResultHistory("1", 2); err == nil {
+		t.Errorf("expecting error for invalid result prefix")
+	}
+
+	// the variables of the history are reused, instead of declaring new ones for each result
+	ir.SetResultHistory("_", 10)
+	eval := func(n int) int {
+		for i := 0; i < n; i++ {
+			ir.ParseEvalPrint(`x`)
+			ir.ParseEvalPrint(`"s"`)
+		}
+		return ir.Comp.BindNum + ir.Comp.IntBindNum
+	}
+	if before, after := eval(10), eval(100); after != before {
+		t.Errorf("expecting %d variables after 200 more results, found %d", before, after)
+	}
+	// identifiers declared by the user are not overwritten nor removed by the history
+	ir.Eval(`var _1 = "mine"`)
+	ir.ParseEvalPrint(`x`)
+	ir.SetResultHistory("out", 2)
+	if v, _, err := ir.Eval1E(`_1`); err != nil || v.Interface() != "mine" {
+		t.Errorf("_1: expecting \"mine\", found %v %v", v, err)
+	}
+}
+
+func TestCmdTypeAstMacroExpand(t *testing.T) {
+	ir := fast.New()
+	var out bytes.Buffer
+	ir.Comp.Stdout, ir.Comp.Stderr = &out, &out
+	ir.Comp.Options |= OptKeepUntyped | OptTrapPanic
+	for _, line := range []string{
+		`import "strconv"`, `var calls int`, `func count() int { calls++; return calls }`,
+		`~macro second_arg(a, b, c interface{}) interface{} { return b }`,
+		`~macro twice(a interface{}) interface{} { return ~"{second_arg; 0; ~,a; 0} }`,
+	} {
+		ir.ParseEvalPrint(line)
+	}
+	for _, test := range []struct {
+		cmd, expected string
+	}{
+		{`:type count()`, "int\n"},
+		{`:type strconv.Atoi("1")`, "(int, error)\n"},
+		{`:type 1 << 100`, "untyped int\n"},
+		{`:type []string`, "[]string\t// type\n"},
+		{`:type map[string]int{}`, "map[string]int\n"},
+		{`:type struct{ A int }`, "struct{A int}\t// type\n"},
+		{`:type println()`, "// no value\n"},
+		{`:ast f(x, "y")`, "CallExpr " + etoken.String(etoken.E_CALL) + "\n  Ident f\n  ExprSlice\n    Ident x\n    BasicLit \"y\"\n"},
+		{`:macroexpand1 twice; 7`, "second_arg\n0\n7\n0\n"},
+		{`:macroexpand second_arg; 1; 2; 3`, "2\n"},
+		{`:macroexpand f(x)`, "f(x)\n// not a macro call\n"},
+	} {
+		out.Reset()
+		ir.ParseEvalPrint(test.cmd)
+		if out.String() != test.expected {
+			t.Errorf("%s: expecting %q, found %q", test.cmd, test.expected, out.String())
+		}
+	}
+	out.Reset()
+	ir.ParseEvalPrint(`:type x := 1`)
+	if expected := "expecting an expression or a type, found: x := 1\n"; !strings.HasSuffix(out.String(), expected) {
+		t.Errorf(":type x := 1: expecting error %q, found %q", expected, out.String())
+	}
+	// :type must not evaluate its argument
+	if v, _, err := ir.Eval1E(`calls`); err != nil || v.Interface() != 0 {
+		t.Errorf(":type count(): expecting calls == 0, found %v %v", v, err)
+	}
+	// exact names win over longer commands with the same prefix
+	if cmd, err := fast.Commands.Lookup("macroexpand"); err != nil || cmd.Name != "macroexpand" {
+		t.Errorf("Commands.Lookup(%q): found %q %v", "macroexpand", cmd.Name, err)
+	}
+}
+
+func TestEvalScriptGoFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, src := range map[string]string{
+		"broken.go": "package main\n\nfunc main() { undefined_func() }\n",
+		"script.go": "package main\n\nvar trace = []string{\"script\"}\n\ntrace = append(trace, \"statement\")\n",
+		"prog.go":   "#!/usr/bin/env gomacro\npackage main\n\nfunc init() { trace = append(trace, \"init\") }\n\nfunc main() { trace = append(trace, \"main\") }\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := cmd.New()
+	c.Interp.Comp.Stdout, c.Interp.Comp.Stderr = io.Discard, io.Discard
+	// script.go has top-level statements: it is evaluated sequentially.
+	// errors in broken.go do not prevent executing the other files
+	err := c.Main([]string{filepath.Join(dir, "broken.go"), filepath.Join(dir, "script.go"), filepath.Join(dir, "prog.go")})
+	if err == nil || !strings.Contains(err.Error(), "undefined_func") {
+		t.Errorf("expecting an error from broken.go, found %v", err)
+	}
+	trace := c.Interp.ValueOf("trace").Interface()
+	if expected := []string{"script", "statement", "init", "main"}; !r.DeepEqual(trace, expected) {
+		t.Errorf("expecting %v, found %v", expected, trace)
+	}
+}
+
 type shouldpanic struct{}
 
 func (shouldpanic) String() string {
@@ -447,6 +1606,52 @@ func init() {
 	bigFloat.Mul(bigFloat, bigFloat)
 }
 
+// simulate a compiled package exporting generic functions and types,
+// as written by genimport
+func init() {
+	imports.Packages["gomacro.test/generics"] = imports.Package{
+		Name: "generics",
+		Binds: map[string]r.Value{
+			"Scale": r.ValueOf(func(x int) int { return x * 10 }),
+		},
+		Generics: map[string]string{
+			"import":  "import (\n\tstrconv \"strconv\"\n)",
+			"Box":     "type Box[T any] struct {\n\tV T\n}",
+			"Box.Get": "func (b Box[T]) Get() T {\n\treturn b.V\n}",
+			"Pair":    "func Pair[T any](a, b T) []T {\n\treturn pair(a, b)\n}",
+			"pair":    "func pair[T any](a, b T) []T {\n\treturn []T{a, b}\n}",
+			"Format":  "func Format[T ~int](x T) string {\n\treturn prefix + strconv.Itoa(Scale(int(x)))\n}",
+			"prefix":  "var prefix = \"#\"",
+		},
+	}
+}
+
+// set by the iterator in package "gomacro.test/iter" when it returns
+var iterStopped bool
+
+// simulate a compiled package exporting iterators
+func init() {
+	imports.Packages["gomacro.test/iter"] = imports.Package{
+		Name: "iter",
+		Binds: map[string]r.Value{
+			"Count": r.ValueOf(func(n int) func(func(int) bool) {
+				return func(yield func(int) bool) {
+					iterStopped = false
+					defer func() {
+						iterStopped = true
+					}()
+					for i := 0; i < n; i++ {
+						if !yield(i) {
+							return
+						}
+					}
+				}
+			}),
+			"Stopped": r.ValueOf(&iterStopped).Elem(),
+		},
+	}
+}
+
 func decl_generic_type_pair_str() string {
 	if etoken.GENERICS.V1_CXX() {
 		return "~quote{template [T1,T2] type Pair struct { First T1; Second T2 }}"
@@ -780,6 +1985,26 @@ var testcases = []TestCase{
 	TestCase{A, "continue_2", "k", 25, nil},
 	TestCase{A, "continue_3", "j=0; k=0; for i:=1; i<=7; i=i+1 { var ii = i; if ii==3 {j=ii; continue}; k=k+ii }; j", 3, nil},
 	TestCase{A, "continue_4", "k", 25, nil},
+	TestCase{F, "goto_backward", `func goto1(n int) (s int) { i := 0; loop: if i < n { s += i; i++; goto loop }; return }; goto1(5)`, 10, nil},
+	TestCase{F, "goto_forward", `func goto2(x int) string { if x > 0 { goto pos }; return "neg"; pos: return "pos" }; goto2(1) + goto2(-1)`, "posneg", nil},
+	TestCase{F, "goto_forward_loop", `func goto3() (s int) { for i := 0; ; i++ { if i == 3 { goto out }; s += i }; out: return s * 10 }; goto3()`, 30, nil},
+	TestCase{F, "goto_forward_closure", `goto4 := func() (s int) { for i := 0; i < 3; i++ { if i == 1 { goto skip }; s += 10; skip: s++ }; return }; goto4()`, 23, nil},
+	TestCase{F, "goto_state_machine", `func goto5() (s string) {
+		state := 0
+	next:
+		switch state {
+		case 0:
+			s += "a"; state = 1; goto next
+		case 1:
+			s += "b"; state = 2; goto next
+		}
+		return
+	}; goto5()`, "ab", nil},
+	TestCase{F, "goto_over_var", `func goto6() int { goto L; x := 1; L: return x }`, panics, nil},
+	TestCase{F, "goto_into_block", `func goto7() int { goto L; if true { L: return 1 }; return 2 }`, panics, nil},
+	TestCase{F, "label_duplicate", `func goto8() { L: ; L: ; goto L }`, panics, nil},
+	TestCase{F, "label_duplicate_nested", `func goto9() { L: for { if true { L: break } } }`, panics, nil},
+	TestCase{F, "label_same_name_other_func", `func goto10() (s int) { L: s++; if s < 3 { goto L }; return }; goto11 := func() int { L: return goto10() }; goto11()`, 3, nil},
 
 	TestCase{A, "for_range_array", `v0 = 0; for _, s := range [2]string{"a", "bc"} { v0 += len(s); continue }; v0`, 3, nil},
 	TestCase{A, "for_range_ptr_array", `v0 = 0; var vis string; for _, vis = range &[...]string{"999", "1234"} { v0 += len(vis); continue }; v0`, 7, nil},
@@ -788,6 +2013,73 @@ var testcases = []TestCase{
 		('x' + 'y' + 'z') * 2, nil},
 	TestCase{A, "for_range_slice", `v0 = 0; for _, s := range [ ]string{"a", "bc"} { v0 += len(s); continue }; v0`, 3, nil},
 	TestCase{A, "for_range_string", `vrune = 0; for i, r := range "abc\u00ff" { vrune += r << (uint8(i)*8); continue }; vrune`, for_range_string("abc\u00ff"), nil},
+	TestCase{F, "for_range_int", `v0 = 0; for i := range 5 { v0 += i; i += 10 }; v0`, 10, nil},
+	TestCase{F, "for_range_int_typed", `var n8 uint8 = 3; var s8 uint8; for i := range n8 { s8 = s8*10 + i }; s8`, uint8(12), nil},
+	TestCase{F, "for_range_int_assign", `var i64 int64; for i64 = range 4 { }; i64`, int64(3), nil},
+	TestCase{F, "for_range_int_novar", `v0 = 0; for range 3 { v0++ }; v0`, 3, nil},
+	TestCase{F, "for_range_int_float", `for i := range 1.5 { }`, panics, nil},
+	TestCase{F, "for_range_func_decl", `func seqn(n int) func(func(int) bool) {
+		return func(yield func(int) bool) {
+			for i := 0; i < n; i++ {
+				if !yield(i) {
+					return
+				}
+			}
+		}
+	}`, nil, none},
+	TestCase{F, "for_range_func_0", `v0 = 0; for range seqn(4) { v0++ }; v0`, 4, nil},
+	TestCase{F, "for_range_func_1", `v0 = 0; for i := range seqn(10) { if i == 2 { continue }; if i == 5 { break }; v0 += i }; v0`, 8, nil},
+	TestCase{F, "for_range_func_2", `func pairs(yield func(string, int) bool) { _ = yield("a", 1) && yield("b", 2) }
+		rfs := ""; for k, v := range pairs { rfs += k + string(rune('0'+v)) }; rfs`, "a1b2", nil},
+	TestCase{F, "for_range_func_too_many_vars", `for i, j := range seqn(3) { }`, panics, nil},
+	TestCase{F, "for_range_func_not_iterator", `for i := range func(int) {} { }`, panics, nil},
+	TestCase{F, "for_range_func_return", `func find(n int) int { for i := range seqn(100) { if i*i >= n { return i } }; return -1 }; find(50)`, 8, nil},
+	TestCase{F, "for_range_func_labels", `func rfl() int {
+		s := 0
+	outer:
+		for i := range seqn(3) {
+			for j := range seqn(3) {
+				if j == 1 { continue outer }
+				if i == 2 { break outer }
+				s += 10*i + j
+			}
+		}
+		return s
+	}; rfl()`, 10, nil},
+	TestCase{F, "for_range_func_goto", `func rfg() int { n := 0; for i := range seqn(10) { if i == 3 { goto done }; n += i }; done: return n }; rfg()`, 3, nil},
+	TestCase{F, "for_range_func_nested_return", `func rfn() int {
+		s := 0
+		for i := range seqn(4) {
+			for j := range seqn(4) {
+				if j > i { break }
+				if i == 3 { return s }
+				s++
+			}
+		}
+		return -1
+	}; rfn()`, 6, nil},
+	TestCase{F, "for_range_func_defer", `var rflog []int; func rfd() { for i := range seqn(3) { defer func(i int) { rflog = append(rflog, i) }(i) }; rflog = append(rflog, 100) }; rfd(); rflog`,
+		[]int{100, 2, 1, 0}, nil},
+	TestCase{F, "for_range_func_recover", `func rfr() (ret interface{}) {
+		defer func() { ret = recover() }()
+		for i := range seqn(3) {
+			defer func() { rflog = append(rflog, 7) }()
+			if i == 1 { panic("boom") }
+		}
+		return nil
+	}; rflog = nil; rfr()`, "boom", nil},
+	TestCase{F, "for_range_func_recover_log", `rflog`, []int{7, 7}, nil},
+	TestCase{F, "for_range_func_panic_unwinds", `var rfstop bool
+		func stoppable(yield func(int) bool) { defer func() { rfstop = true }(); yield(0) }
+		func rfp() (ret interface{}) { defer func() { ret = recover() }(); for range stoppable { panic("oops") }; return nil }
+		rfp()`, "oops", nil},
+	TestCase{F, "for_range_func_panic_unwinds_2", `rfstop`, true, nil},
+	TestCase{F, "for_range_func_continue_after_false", `func bad(yield func(int) bool) { yield(0); yield(1) }; for range bad { break }`, panics, nil},
+	TestCase{F, "for_range_func_compiled_1", `import "gomacro.test/iter"; v0 = 0; for i := range iter.Count(5) { v0 += i }; v0`, 10, nil},
+	TestCase{F, "for_range_func_compiled_2", `v0 = 0; for i := range iter.Count(100) { if i == 3 { break }; v0 += i }; v0`, 3, nil},
+	TestCase{F, "for_range_func_compiled_3", `iter.Stopped`, true, nil},
+	TestCase{F, "for_range_func_compiled_4", `func rfc() int { for i := range iter.Count(100) { if i == 4 { return i } }; return -1 }; rfc()`, 4, nil},
+	TestCase{F, "for_range_func_compiled_5", `iter.Stopped`, true, nil},
 
 	TestCase{A, "function_0", "func nop() { }; nop()", nil, none},
 	TestCase{A, "function_1", "func seven() int { return 7 }; seven()", 7, nil},
@@ -915,6 +2207,22 @@ var testcases = []TestCase{
 	TestCase{A, "builtin_imag_2", "imag(cplx)", imag(complex64(1.5 + 0.25i)), nil},
 	TestCase{A, "builtin_complex_1", "complex(0,1)", complex(0, 1), nil},
 	TestCase{A, "builtin_complex_2", "v6 = 0.1; complex(v6,-v6)", complex(float32(0.1), -float32(0.1)), nil},
+	TestCase{F, "builtin_min_1", "vmin1, vmin2 := 3, -2; min(vmin1, vmin2, 7)", -2, nil},
+	TestCase{F, "builtin_min_2", `min("b", "a", "c")`, "a", nil},
+	TestCase{F, "builtin_min_3", "v6 = 0.5; min(v6, 2)", float32(0.5), nil},
+	TestCase{F, "builtin_min_4", "vnan := 0.0; vnan /= vnan; vmin3 := min(vnan, 1.0); vmin3 != vmin3", true, nil},
+	TestCase{F, "builtin_min_5", "vnz := 0.0; vnz = -vnz; 1 / min(0.0, vnz)", math.Inf(-1), nil},
+	TestCase{F, "builtin_min_6", "min(vmin1, 2.5)", panics, nil}, // constant 2.5 truncated to int
+	TestCase{F, "builtin_min_7", "min(vmin1, v6)", panics, nil},  // mismatched types
+	TestCase{F, "builtin_max_1", "max(uint8(3), 200, 7)", uint8(200), nil},
+	TestCase{F, "builtin_max_2", "type MaxT int16; var vmax MaxT = 5; max(vmax, 3) == 5", true, nil},
+	TestCase{F, "builtin_max_3", "1 / max(vnz, 0.0)", math.Inf(1), nil},
+	TestCase{F, "builtin_max_4", `const cmax = max("x", "ab"); cmax`, "x", nil},
+	TestCase{F, "builtin_max_5", "max(true, false)", panics, nil},
+	TestCase{F, "builtin_clear_1", `mclear := map[string]int{"a": 1, "b": 2}; clear(mclear); len(mclear)`, 0, nil},
+	TestCase{F, "builtin_clear_2", "sclear := []int{1, 2, 3}; clear(sclear[1:]); sclear", []int{1, 0, 0}, nil},
+	TestCase{F, "builtin_clear_3", "clear(3)", panics, nil},
+	TestCase{F, "builtin_clear_nan", `mnan := map[float64]int{vnz / vnz: 1, 2: 2}; clear(mnan); len(mnan)`, 0, nil},
 
 	TestCase{F | U, "untyped_builtin_real_1", "real(0.5+1.75i)",
 		untyped.MakeLit(untyped.Float, constant.MakeFloat64(0.5), nil), // 0.5 is exactly representable by float64
@@ -922,6 +2230,12 @@ var testcases = []TestCase{
 	TestCase{F | U, "untyped_builtin_imag_1", "imag(1.5+0.25i)",
 		untyped.MakeLit(untyped.Float, constant.MakeFloat64(0.25), nil), // 0.25 is exactly representable by float64
 		nil},
+	TestCase{F | U, "untyped_builtin_min_1", "min(3, 1.5, 2)",
+		untyped.MakeLit(untyped.Float, constant.MakeFloat64(1.5), nil),
+		nil},
+	TestCase{F | U, "untyped_builtin_max_1", "max('a', 1)",
+		untyped.MakeLit(untyped.Rune, constant.MakeInt64('a'), nil),
+		nil},
 	TestCase{F | U, "untyped_builtin_complex_1", "complex(1, 2)",
 		untyped.MakeLit(
 			untyped.Complex,
@@ -1764,6 +3078,105 @@ var testcases = []TestCase{
 		var xg3 Eq#[UInt]
 		xg3 = xg2
 		xg2`, uint(9), nil},
+
+	TestCase{F, "typeparam_func_1", `
+		func MapT[T, U any](slice []T, trans func(T) U) []U {
+			ret := make([]U, len(slice))
+			for i, x := range slice {
+				ret[i] = trans(x)
+			}
+			return ret
+		}`, nil, none},
+	TestCase{F, "typeparam_func_2", `MapT[string, int]([]string{"abc", "xy", "z"}, stringLen)`, []int{3, 2, 1}, nil},
+	TestCase{F, "typeparam_func_3", `MapT([]string{"a", "bc"}, stringLen)`, []int{1, 2}, nil},
+	TestCase{F, "typeparam_func_4", `func IdentT[T any](x T) T { return x }; IdentT[uint8](7)`, uint8(7), nil},
+	TestCase{F, "typeparam_func_5", `IdentT("abc")`, "abc", nil},
+	TestCase{F, "typeparam_func_6", `
+		func SumT[T ~int | ~float64 | ~string](args ...T) T {
+			var sum T
+			for _, arg := range args {
+				sum += arg
+			}
+			return sum
+		}
+		SumT[float64](1.5, 2.5)`, 4.0, nil},
+	TestCase{F, "typeparam_func_7", `SumT("a", "b", "c")`, "abc", nil},
+	TestCase{F, "typeparam_func_8", `type MyInt int; SumT[MyInt](1, 2, 3) == MyInt(6)`, true, nil},
+	TestCase{F, "typeparam_func_9", `SumT[uint](1, 2)`, panics, nil}, // uint does not satisfy ~int | ~float64 | ~string
+	TestCase{F, "typeparam_constraint_1", `
+		type Number interface {
+			~int | ~int64 | ~float64
+		}
+		func MaxT[T Number](a, b T) T {
+			if a > b {
+				return a
+			}
+			return b
+		}
+		MaxT(3, 7)`, 7, nil},
+	TestCase{F, "typeparam_constraint_2", `MaxT[int64](-3, -7)`, int64(-3), nil},
+	TestCase{F, "typeparam_constraint_3", `MaxT[string]("a", "b")`, panics, nil},
+	TestCase{F, "typeparam_constraint_4", `
+		func KeysT[K comparable, V any](m map[K]V) int {
+			return len(m)
+		}
+		KeysT(map[string]bool{"a": true, "b": false})`, 2, nil},
+	TestCase{F, "typeparam_constraint_5", `KeysT[[]int, int](nil)`, panics, nil},
+	TestCase{F, "typeparam_constraint_6", `
+		type ComparableT interface{ comparable }
+		type IntT interface{ int }
+		type NumberT interface{ Number }
+		func EqT[T ComparableT](a, b T) bool { return a == b }
+		func TwiceT[T NumberT](a T) T { return a + a }
+		EqT(1, 1) && TwiceT(3) == 6`, true, nil},
+	TestCase{F, "typeparam_constraint_7", `func ZeroT[T IntT]() T { var z T; return z }; ZeroT[int]()`, 0, nil},
+	TestCase{F, "typeparam_constraint_8", `EqT(func() {}, nil)`, panics, nil},
+	TestCase{F, "typeparam_constraint_value_1", `var xcv interface{ ~int | string }`, panics, nil},
+	TestCase{F, "typeparam_constraint_value_2", `var xcv Number`, panics, nil},
+	TestCase{F, "typeparam_constraint_value_3", `var xcv []comparable`, panics, nil},
+	TestCase{F, "typeparam_constraint_value_4", `var xcv interface{ int }`, panics, nil},
+	TestCase{F, "typeparam_embedded_interface", `
+		type StringerT interface{ String() string }
+		type StringerT2 interface{ StringerT }
+		dst := time.Duration(1)
+		var xst StringerT2 = dst
+		xst.String()`, "1ns", nil},
+	TestCase{F, "typeparam_core_type", `
+		func FirstT[S ~[]E, E any](s S) E {
+			return s[0]
+		}
+		type Names []string
+		FirstT(Names{"foo", "bar"})`, "foo", nil},
+	TestCase{F, "typeparam_type_1", `
+		type PairT[T1 any, T2 any] struct { First T1; Second T2 }
+		var pt PairT[complex64, struct{}]; pt`, PairX2{}, nil},
+	TestCase{F, "typeparam_type_2", `PairT[bool, interface{}]{true, "foo"}`, PairX3{true, "foo"}, nil},
+	TestCase{F, "typeparam_type_3", `
+		type ListT[T any] struct { First T; Rest *ListT[T] }
+		ListT[interface{}]{}`, ListX3{nil, (*ListX3)(nil)}, nil},
+	TestCase{F, "typeparam_type_4", `type SetT[K comparable] map[K]struct{}; len(SetT[int]{1: {}, 2: {}})`, 2, nil},
+	TestCase{F, "typeparam_method_1", `func (s SetT[K]) Size() int { return len(s) }; nil`, nil, nil},
+	TestCase{F, "typeparam_method_2", `xset := SetT[int]{1: {}, 2: {}}; xset.Size()`, 2, nil},
+	TestCase{F, "typeparam_method_3", `
+		type StackT[T any] struct { items []T }
+		func (s *StackT[T]) Push(v T) { s.items = append(s.items, v) }
+		func (s *StackT[T]) Pop() T { v := s.items[len(s.items)-1]; s.items = s.items[:len(s.items)-1]; return v }
+		var xstk StackT[string]
+		xstk.Push("a"); xstk.Push("b"); xstk.Pop()`, "b", nil},
+	TestCase{F, "typeparam_method_4", `func (s SetT[K]) Has(k K) bool { _, ok := s[k]; return ok }; nil`, nil, nil},
+	TestCase{F, "typeparam_method_5", `xset.Has(2) && !xset.Has(3)`, true, nil},
+	TestCase{F, "typeparam_method_6", `func (s StackT[_]) Depth() int { return len(s.items) }; xstk.Depth()`, 1, nil},
+	TestCase{F, "typeparam_method_7", `func (s StackT[T]) String() string { return fmt.Sprint("stack", s.items) }; fmt.Sprint(xstk)`, "stack[a]", nil},
+	TestCase{F, "typeparam_method_8", `func (p PairT[T1]) First1() T1 { return p.First }`, panics, nil},
+	TestCase{F, "typeparam_method_9", `func (s SetT[K]) Bad() int { return "x" }; xset.Bad()`, panics, nil},
+	TestCase{F, "typeparam_array_decl", `type ArrT [2]int; var arrt ArrT; const NT = 3; var brrt [NT]int; len(arrt) + len(brrt)`, 5, nil},
+	TestCase{F, "typeparam_index_expr", `sidx := []int{4, 5, 6}; sidx[1]`, 5, nil},
+	TestCase{F, "typeparam_import_1", `import "gomacro.test/generics"; generics.Pair[int](1, 2)`, []int{1, 2}, nil},
+	TestCase{F, "typeparam_import_2", `generics.Pair("a", "b")`, []string{"a", "b"}, nil},
+	TestCase{F, "typeparam_import_3", `generics.Format(7)`, "#70", nil},
+	TestCase{F, "typeparam_import_4", `generics.Box[string]{"x"}.V`, "x", nil},
+	TestCase{F, "typeparam_import_5", `generics.Format("7")`, panics, nil},
+	TestCase{F, "typeparam_import_6", `xbox := generics.Box[string]{"y"}; xbox.Get()`, "y", nil},
 }
 
 func (c *TestCase) compareResults(t *testing.T, actual []r.Value) {
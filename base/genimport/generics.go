@@ -0,0 +1,335 @@
+package genimport
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// GenericsImportKey is the key of Package.Generics containing
+// the imports needed by the source code of generic declarations
+const GenericsImportKey = "import"
+
+// genericsCollector collects the source code of exported generic functions and types,
+// and of the unexported declarations they depend on.
+//
+// Generic declarations cannot be stored as reflect.Value or reflect.Type:
+// the interpreter instantiates them on demand, compiling their source code.
+type genericsCollector struct {
+	fset    *token.FileSet
+	decls   map[string]ast.Decl        // top-level declarations. methods are named "Type.Method"
+	files   map[ast.Decl]*ast.File     // file containing each declaration
+	methods map[string][]string        // type name -> names of its methods
+	imports map[string]*ast.ImportSpec // imports used by collected declarations, by package name
+	done    map[ast.Decl]bool          // collected declarations
+	names   []string                   // names of collected declarations, in collection order
+	byName  map[string]ast.Decl        // collected declarations, by name
+	scope   *types.Scope               // package scope
+	pkgname map[*ast.File]map[string]*ast.ImportSpec
+}
+
+// writeGenerics writes the source code of generic functions and types
+func (gen *genimport) writeGenerics() {
+	var roots []string
+	for _, name := range gen.names {
+		if obj := gen.scope.Lookup(name); obj.Exported() && isGenericObject(obj) {
+			roots = append(roots, name)
+		}
+	}
+	if len(roots) == 0 {
+		return
+	}
+	sources, err := gen.collectGenerics(roots)
+	if err != nil {
+		gen.output.Warnf("skipping import of generic functions and types from package %q: %v", gen.path, err)
+		return
+	}
+	keys := make([]string, 0, len(sources))
+	for key := range sources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	d := gen.mapdecl("Generics: map[string]string")
+	for _, key := range keys {
+		d.header()
+		fmt.Fprintf(gen.out, "\n\t\t\t%q:\t%q,", key, sources[key])
+	}
+	d.footer()
+}
+
+func isGenericObject(obj types.Object) bool {
+	switch obj := obj.(type) {
+	case *types.Func:
+		return isGenericFunc(obj)
+	case *types.TypeName:
+		return isGenericType(obj.Type())
+	}
+	return false
+}
+
+// collectGenerics parses the package source code and returns
+// the source of the declarations named in roots, and of the unexported
+// declarations they depend on
+func (gen *genimport) collectGenerics(roots []string) (map[string]string, error) {
+	files, err := gen.parsePackage()
+	if err != nil {
+		return nil, err
+	}
+	coll := newGenericsCollector(gen.fset, gen.scope, files)
+	for _, name := range roots {
+		if coll.decls[name] == nil {
+			return nil, fmt.Errorf("declaration of %s not found in package source code", name)
+		}
+		if v := coll.fork().unexportedVar(name); len(v) != 0 {
+			// the interpreter would use a copy of the variable, not the variable itself
+			gen.output.Warnf("skipping import of generic %s from package %q: it uses the unexported variable %s",
+				name, gen.path, v)
+			continue
+		}
+		coll.collect(name)
+	}
+	return coll.sources()
+}
+
+// parsePackage parses the non-test Go files of the package being imported
+func (gen *genimport) parsePackage() ([]*ast.File, error) {
+	var bpkg *build.Package
+	var err error
+	if filepath.IsAbs(gen.path) {
+		bpkg, err = build.ImportDir(gen.path, 0)
+	} else {
+		bpkg, err = build.Import(gen.gpkg.Path(), gen.dir, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if gen.fset == nil {
+		gen.fset = token.NewFileSet()
+	}
+	files := make([]*ast.File, 0, len(bpkg.GoFiles))
+	for _, name := range bpkg.GoFiles {
+		file, err := parser.ParseFile(gen.fset, filepath.Join(bpkg.Dir, name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func newGenericsCollector(fset *token.FileSet, scope *types.Scope, files []*ast.File) *genericsCollector {
+	coll := &genericsCollector{
+		fset:    fset,
+		decls:   make(map[string]ast.Decl),
+		files:   make(map[ast.Decl]*ast.File),
+		methods: make(map[string][]string),
+		imports: make(map[string]*ast.ImportSpec),
+		done:    make(map[ast.Decl]bool),
+		byName:  make(map[string]ast.Decl),
+		scope:   scope,
+		pkgname: make(map[*ast.File]map[string]*ast.ImportSpec),
+	}
+	for _, file := range files {
+		coll.pkgname[file] = fileImports(file)
+		for _, decl := range file.Decls {
+			coll.index(file, decl)
+		}
+	}
+	return coll
+}
+
+// fork returns a collector that shares the indexed declarations of coll,
+// but has not collected any of them yet
+func (coll *genericsCollector) fork() *genericsCollector {
+	return &genericsCollector{
+		fset:    coll.fset,
+		decls:   coll.decls,
+		files:   coll.files,
+		methods: coll.methods,
+		imports: make(map[string]*ast.ImportSpec),
+		done:    make(map[ast.Decl]bool),
+		byName:  make(map[string]ast.Decl),
+		scope:   coll.scope,
+		pkgname: coll.pkgname,
+	}
+}
+
+// unexportedVar collects the declaration 'name' and returns the name
+// of an unexported package variable it depends on, or "" if there is none
+func (coll *genericsCollector) unexportedVar(name string) string {
+	coll.collect(name)
+	for _, name := range coll.names {
+		if obj, ok := coll.scope.Lookup(name).(*types.Var); ok && !obj.Exported() {
+			return name
+		}
+	}
+	return ""
+}
+
+// fileImports returns the imports of a file, indexed by package name
+func fileImports(file *ast.File) map[string]*ast.ImportSpec {
+	m := make(map[string]*ast.ImportSpec)
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		var name string
+		if spec.Name != nil {
+			name = spec.Name.Name
+		} else {
+			// approximation: assume package name is the last element of its path
+			name = packageSanitizedName(path)
+		}
+		m[name] = spec
+	}
+	return m
+}
+
+// index top-level declaration by name
+func (coll *genericsCollector) index(file *ast.File, decl ast.Decl) {
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		name := decl.Name.Name
+		if decl.Recv != nil && len(decl.Recv.List) != 0 {
+			tname := recvTypeName(decl.Recv.List[0].Type)
+			name = tname + "." + name
+			coll.methods[tname] = append(coll.methods[tname], name)
+		}
+		coll.add(file, name, decl)
+	case *ast.GenDecl:
+		switch decl.Tok {
+		case token.TYPE:
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.TypeSpec)
+				// split type declarations, so we can collect them separately
+				coll.add(file, spec.Name.Name, &ast.GenDecl{Tok: token.TYPE, Specs: []ast.Spec{spec}})
+			}
+		case token.CONST, token.VAR:
+			// do not split constants: they may depend on iota and implicit repetition
+			for _, spec := range decl.Specs {
+				for _, ident := range spec.(*ast.ValueSpec).Names {
+					coll.add(file, ident.Name, decl)
+				}
+			}
+		}
+	}
+}
+
+func (coll *genericsCollector) add(file *ast.File, name string, decl ast.Decl) {
+	if name == "_" {
+		return
+	}
+	coll.decls[name] = decl
+	coll.files[decl] = file
+}
+
+// return the name of the receiver type, for example T in func (*T[K]) Foo()
+func recvTypeName(node ast.Expr) string {
+	for {
+		switch n := node.(type) {
+		case *ast.StarExpr:
+			node = n.X
+		case *ast.ParenExpr:
+			node = n.X
+		case *ast.IndexExpr:
+			node = n.X
+		case *ast.IndexListExpr:
+			node = n.X
+		case *ast.Ident:
+			return n.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// collect the declaration 'name' and, recursively, the declarations it depends on
+func (coll *genericsCollector) collect(name string) {
+	decl := coll.decls[name]
+	if decl == nil || coll.done[decl] {
+		return
+	}
+	coll.done[decl] = true
+	coll.names = append(coll.names, name)
+	coll.byName[name] = decl
+
+	file := coll.files[decl]
+	imports := coll.pkgname[file]
+	ast.Inspect(decl, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.SelectorExpr:
+			if ident, ok := node.X.(*ast.Ident); ok {
+				if spec := imports[ident.Name]; spec != nil && coll.scope.Lookup(ident.Name) == nil {
+					// qualified identifier pkg.Name
+					coll.imports[ident.Name] = spec
+					return false
+				}
+			}
+			// do not collect field and method names
+			ast.Inspect(node.X, func(node ast.Node) bool {
+				coll.visitIdent(node)
+				return true
+			})
+			return false
+		default:
+			coll.visitIdent(node)
+		}
+		return true
+	})
+	// also collect the methods of collected types
+	if _, ok := decl.(*ast.GenDecl); ok {
+		for _, method := range coll.methods[name] {
+			coll.collect(method)
+		}
+	}
+}
+
+func (coll *genericsCollector) visitIdent(node ast.Node) {
+	ident, ok := node.(*ast.Ident)
+	if !ok {
+		return
+	}
+	name := ident.Name
+	if obj := coll.scope.Lookup(name); obj != nil && (!obj.Exported() || isGenericObject(obj)) {
+		// exported non-generic declarations are available from the compiled package
+		coll.collect(name)
+	}
+}
+
+// sources returns the source code of collected declarations
+func (coll *genericsCollector) sources() (map[string]string, error) {
+	sources := make(map[string]string, len(coll.names)+1)
+	var buf bytes.Buffer
+	for _, name := range coll.names {
+		buf.Reset()
+		if err := printer.Fprint(&buf, coll.fset, coll.byName[name]); err != nil {
+			return nil, err
+		}
+		sources[name] = buf.String()
+	}
+	if len(coll.imports) != 0 {
+		names := make([]string, 0, len(coll.imports))
+		for name := range coll.imports {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		buf.Reset()
+		buf.WriteString("import (")
+		for _, name := range names {
+			fmt.Fprintf(&buf, "\n\t%s %s", name, coll.imports[name].Path.Value)
+		}
+		buf.WriteString("\n)")
+		sources[GenericsImportKey] = buf.String()
+	}
+	return sources, nil
+}
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"fmt"
 	"go/constant"
+	"go/token"
 	"go/types"
 	"io/ioutil"
 	"math"
@@ -46,6 +47,8 @@ type genimport struct {
 	name, name_ string
 	proxyprefix string
 	reflect     string
+	dir         string         // directory used to locate package source code
+	fset        *token.FileSet // used to parse package source code
 }
 
 var inceptionFileDeclarations = []byte(`
@@ -78,6 +81,7 @@ type Package = struct {
 	Proxies  map[string]r.Type
 	Untypeds map[string]string
 	Wrappers map[string][]string
+	Generics map[string]string
 }
 
 var Packages = make(map[string]Package)
@@ -95,6 +99,7 @@ type Package = struct {
 	Proxies  map[string]Type
 	Untypeds map[string]string
 	Wrappers map[string][]string
+	Generics map[string]string
 }
 
 var Packages = make(map[string]Package)
@@ -108,12 +113,13 @@ func createPluginMainFile(dir string) (string, error) {
 	return filepath, ioutil.WriteFile(filepath, pluginMainFileContent, os.FileMode(0644))
 }
 
-func createImportFile(o *Output, out *bytes.Buffer, path string, gpkg *types.Package, mode ImportMode) (isEmpty bool) {
+func createImportFile(o *Output, out *bytes.Buffer, dir string, path string, gpkg *types.Package, mode ImportMode) (isEmpty bool) {
 
 	gen := newGenImport(o, out, path, gpkg, mode)
 	if gen == nil {
 		return true
 	}
+	gen.dir = dir
 	gen.write()
 	return false
 }
@@ -159,6 +165,7 @@ func (gen *genimport) write() {
 	gen.writeProxies()
 	gen.writeUntypeds()
 	gen.writeWrappers()
+	gen.writeGenerics()
 
 	gen.out.WriteString("\n\t}\n}\n")
 	gen.writeInterfaceProxies()
@@ -294,7 +301,7 @@ func (gen *genimport) writeBinds() {
 				fmt.Fprintf(gen.out, "\n\t\t\t%q:\t%sValueOf(&%s%s).Elem(),", name, gen.reflect, gen.name_, name)
 			case *types.Func:
 				if isGenericFunc(obj) {
-					gen.output.Warnf("skipping import of %v:\timporting generic functions is not supported yet", name)
+					// written by writeGenerics()
 				} else {
 					d.header()
 					fmt.Fprintf(gen.out, "\n\t\t\t%q:\t%sValueOf(%s%s),",
@@ -314,8 +321,7 @@ func (gen *genimport) writeTypes() {
 			switch obj := obj.(type) {
 			case *types.TypeName:
 				if isGenericType(obj.Type()) {
-					gen.output.Warnf("skipping import of %s.%s:\timporting generic types is not supported yet",
-						obj.Pkg().Path(), obj.Name())
+					// written by writeGenerics()
 				} else {
 					d.header()
 					fmt.Fprintf(gen.out, "\n\t\t\t%q:\t%sTypeOf((*%s%s)(nil)).Elem(),",
@@ -242,7 +242,7 @@ func createImportFiles(o *Output, dir string, pkginfos map[string]*types.Package
 	for path, pkginfo := range pkginfos {
 		filepath := p.Subdir(dir, computeImportFilename(o, path, mode, index))
 
-		isEmpty := createImportFile(o, &buf, path, pkginfo, mode)
+		isEmpty := createImportFile(o, &buf, dir, path, pkginfo, mode)
 		if isEmpty {
 			o.Warnf("package %q exports zero constants, functions, types and variables", path)
 		} else {
@@ -0,0 +1,87 @@
+package genimport
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const genericsTestSource = `package lib
+
+var counter int
+
+type Set[K comparable] map[K]struct{}
+
+func (s Set[K]) Add(k K) { s[k] = struct{}{} }
+
+type Pair[A, B any] struct {
+	First  A
+	Second B
+}
+
+func Keys[K comparable, V any](m map[K]V) []K {
+	keys := make([]K, 0, size(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func size[K comparable, V any](m map[K]V) int { return len(m) }
+
+func Count[T any](x T) int {
+	counter++
+	return counter
+}
+
+func Plain() int { return 0 }
+`
+
+func TestWriteGenerics(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "lib.go"), []byte(genericsTestSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "lib.go", genericsTestSource, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := new(types.Config).Check("example.com/lib", fset, []*ast.File{file}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out, warnings bytes.Buffer
+	gen := &genimport{
+		output: &Output{Stdout: &warnings, Stderr: &warnings},
+		gpkg:   pkg,
+		scope:  pkg.Scope(),
+		names:  pkg.Scope().Names(),
+		out:    &out,
+		path:   dir,
+	}
+	gen.writeGenerics()
+
+	str := out.String()
+	for _, expected := range []string{`Generics: map[string]string{`, `"Keys":`, `"size":`, `"Pair":`, `"Set":`, `"Set.Add":`} {
+		if !strings.Contains(str, expected) {
+			t.Errorf("expecting %s in generated code:\n%s", expected, str)
+		}
+	}
+	// generics using unexported variables would use a copy of them,
+	// and non-generic declarations are available from the compiled package
+	for _, unexpected := range []string{`"Count":`, `"counter":`, `"Plain":`} {
+		if strings.Contains(str, unexpected) {
+			t.Errorf("unexpected %s in generated code:\n%s", unexpected, str)
+		}
+	}
+	if !strings.Contains(warnings.String(), "unexported variable counter") {
+		t.Errorf("expecting a warning about Count, found: %q", warnings.String())
+	}
+}
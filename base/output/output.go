@@ -59,17 +59,25 @@ func (st *Stringer) Copy(other *Stringer) {
 }
 
 func (err RuntimeError) Error() string {
+	msg := err.Message()
+	if prefix := err.Position().String(); prefix != "" && prefix != "-" {
+		msg = fmt.Sprintf("%s: %s", prefix, msg)
+	}
+	return msg
+}
+
+// Position returns the position where the error occurred, if known
+func (err RuntimeError) Position() token.Position {
+	return err.st.Position()
+}
+
+// Message returns the error message, without position
+func (err RuntimeError) Message() string {
 	args := err.args
-	var prefix string
 	if st := err.st; st != nil {
 		args = st.toPrintables(err.format, args)
-		prefix = st.Position().String()
 	}
-	msg := fmt.Sprintf(err.format, args...)
-	if prefix != "" && prefix != "-" {
-		msg = fmt.Sprintf("%s: %s", prefix, msg)
-	}
-	return msg
+	return fmt.Sprintf(err.format, args...)
 }
 
 func MakeRuntimeError(format string, args ...interface{}) error {
@@ -98,16 +106,12 @@ func (st *Stringer) Errorf(format string, args ...interface{}) (r.Value, []r.Val
 
 func (st *Stringer) ErrorAt(pos token.Pos, format string, args ...interface{}) (r.Value, []r.Value) {
 	if st != nil {
-		args = st.toPrintables(format, args)
-		if st.Fileset != nil {
-			position := st.Fileset.Position(pos).String()
-			if position != "" && position != "-" {
-				args = append([]interface{}{position}, args...)
-				format = "%s: " + format
-			}
-		}
+		// copy st, its Pos is modified by later errors
+		at := *st
+		at.Pos = pos
+		st = &at
 	}
-	panic(RuntimeError{nil, format, args})
+	panic(RuntimeError{st, format, args})
 }
 
 func Warnf(format string, args ...interface{}) {
@@ -52,6 +52,7 @@ const (
 	OptShowParse
 	OptShowPrompt
 	OptShowTime
+	OptImportAuto // automatically import packages used but not imported, as strings in strings.ToUpper()
 )
 
 const (
@@ -88,6 +89,7 @@ var optNames = map[Options]string{
 	OptShowParse:           "Parse.Show",
 	OptShowPrompt:          "Prompt.Show",
 	OptShowTime:            "Time.Show",
+	OptImportAuto:          "Import.Auto",
 }
 
 var optValues = map[string]Options{}
@@ -19,9 +19,12 @@ package cmd
 import (
 	"bytes"
 	"fmt"
+	"go/parser"
+	"go/token"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 
 	. "github.com/WilliamNHarvey/gomacro/base"
@@ -37,6 +40,26 @@ type Cmd struct {
 	Interp             *fast.Interp
 	WriteDeclsAndStmts bool
 	OverwriteFiles     bool
+	NoProfile          bool // do not evaluate the startup files returned by ProfileFiles()
+	profileLoaded      bool
+}
+
+// RcFile is the name of the startup file in the user's home directory,
+// and ProfileFile is the name of the per-project startup file
+const (
+	RcFile      = ".gomacrorc"
+	ProfileFile = ".gomacro"
+)
+
+// ExitError is returned by Cmd.Main when an executed Go program fails.
+// Code is the exit status that "go run" would return
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
 }
 
 func New() *Cmd {
@@ -59,6 +82,8 @@ func (cmd *Cmd) Init() {
 	cmd.Interp = ir
 	cmd.WriteDeclsAndStmts = false
 	cmd.OverwriteFiles = false
+	cmd.NoProfile = false
+	cmd.profileLoaded = false
 }
 
 func (cmd *Cmd) Main(args []string) (err error) {
@@ -77,6 +102,13 @@ func (cmd *Cmd) Main(args []string) (err error) {
 		switch args[0] {
 		case "-c", "--collect":
 			g.Options |= OptCollectDeclarations | OptCollectStatements
+		case "--dap":
+			var addr string
+			if len(args) > 1 && strings.IndexByte(args[1], ':') >= 0 {
+				addr = args[1]
+				args = args[1:]
+			}
+			return cmd.ServeDAP(addr)
 		case "-e", "--expr":
 			if len(args) > 1 {
 				repl = false
@@ -84,6 +116,7 @@ func (cmd *Cmd) Main(args []string) (err error) {
 				buf.WriteByte('\n')      // because ReadMultiLine() needs a final '\n'
 				g.Options |= OptShowEval // set by default, overridden by -s, -v and -vv
 				g.Options = (g.Options | set) &^ clear
+				cmd.loadProfile()
 				err := cmd.EvalReader(buf)
 				if err != nil {
 					return err
@@ -109,6 +142,8 @@ func (cmd *Cmd) Main(args []string) (err error) {
 		case "-m", "--macro-only":
 			set |= OptMacroExpandOnly
 			clear &^= OptMacroExpandOnly
+		case "--no-profile":
+			cmd.NoProfile = true
 		case "-n", "--no-trap":
 			set &^= OptTrapPanic | OptPanicStackTrace
 			clear |= OptTrapPanic | OptPanicStackTrace
@@ -140,7 +175,13 @@ func (cmd *Cmd) Main(args []string) (err error) {
 			}
 			g.Options &^= OptShowPrompt | OptShowEval | OptShowEvalType // cleared by default, overridden by -s, -v and -vv
 			g.Options = (g.Options | set) &^ clear
-			cmd.EvalFileOrDir(arg)
+			// continue with the next files on errors, as the interpreter does
+			if e := cmd.EvalFileOrDir(arg); e != nil {
+				if err != nil {
+					g.Fprintf(g.Stderr, "%s\n", err)
+				}
+				err = e
+			}
 
 			g.Imports, g.Declarations, g.Statements = nil, nil, nil
 		}
@@ -149,9 +190,10 @@ func (cmd *Cmd) Main(args []string) (err error) {
 	if repl || forcerepl {
 		g.Options |= OptShowPrompt | OptShowEval | OptShowEvalType // set by default, overridden by -s, -v and -vv
 		g.Options = (g.Options | set) &^ clear
+		cmd.loadProfile()
 		ir.ReplStdin()
 	}
-	return nil
+	return err
 }
 
 func (cmd *Cmd) Usage() error {
@@ -160,6 +202,8 @@ func (cmd *Cmd) Usage() error {
 
   Recognized options:
     -c,   --collect          collect declarations and statements, to print them later
+          --dap [HOST:PORT]  serve the Debug Adapter Protocol on standard input and output,
+                             or on the local TCP address HOST:PORT, then exit
     -e,   --expr EXPR        evaluate expression
     -f,   --force-overwrite  option -w will overwrite existing files
     -g,   --genimport [PATH] write x_package.go bindings for specified import path and exit.
@@ -171,6 +215,7 @@ func (cmd *Cmd) Usage() error {
     -m,   --macro-only       do not execute code, only parse and macroexpand it.
                              useful to run gomacro as a Go preprocessor
     -n,   --no-trap          do not trap panics in the interpreter
+          --no-profile       do not evaluate the startup files ~/.gomacrorc and .gomacro
     -t,   --trap             trap panics in the interpreter (default)
     -s,   --silent           silent. do NOT show startup message, prompt, and expressions results.
                              default when executing files and dirs.
@@ -184,12 +229,110 @@ func (cmd *Cmd) Usage() error {
 
     Options are processed in order, except for -i that is always processed as last.
 
+    Before the first expression or the REPL, gomacro evaluates ~/.gomacrorc
+    then .gomacro in the current directory or, if not found, in the root
+    of the current Go module. Special commands as :options are allowed in them,
+    and the REPL command :reload-profile evaluates them again.
+
+    Go files and directories containing a Go package are executed as "go run" would:
+    package-level variables are initialized, then init() functions are executed,
+    then main() if the package is "main". Other files, including Go files
+    with top-level statements, are evaluated sequentially.
+
     Collected declarations and statements can be also written to standard output
     or to a file with the REPL command :write
 `)
 	return nil
 }
 
+// ProfileFiles returns the startup files evaluated before the REPL and the expressions
+// given with -e: the rc file ~/.gomacrorc, then the profile .gomacro in dir or,
+// if not found, in the root of the Go module containing dir.
+// Only existing files are returned
+func ProfileFiles(dir string) []string {
+	var files []string
+	if home := paths.UserHomeDir(); home != "" {
+		files = appendIfFile(files, filepath.Join(home, RcFile))
+	}
+	if dir == "" {
+		return files
+	}
+	n := len(files)
+	if files = appendIfFile(files, filepath.Join(dir, ProfileFile)); len(files) == n {
+		if root := moduleRoot(dir); root != "" && root != dir {
+			files = appendIfFile(files, filepath.Join(root, ProfileFile))
+		}
+	}
+	return files
+}
+
+func appendIfFile(files []string, filename string) []string {
+	if info, err := os.Stat(filename); err == nil && info.Mode().IsRegular() {
+		files = append(files, filename)
+	}
+	return files
+}
+
+// moduleRoot returns the nearest directory containing go.mod, starting from dir
+// and walking up, or "" if there is none
+func moduleRoot(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		if info, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil && !info.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// loadProfile evaluates the startup files, at most once and unless cmd.NoProfile is set
+func (cmd *Cmd) loadProfile() {
+	if cmd.NoProfile || cmd.profileLoaded {
+		return
+	}
+	cmd.profileLoaded = true
+	dir, _ := os.Getwd()
+	files := ProfileFiles(dir)
+	if len(files) == 0 {
+		return
+	}
+	if err := cmd.Interp.LoadProfile(files...); err != nil {
+		g := &cmd.Interp.Comp.Globals
+		g.Warnf("error loading startup files: %v", err)
+	}
+}
+
+// ServeDAP serves the Debug Adapter Protocol on the local TCP address addr,
+// or on standard input and output if addr is empty
+func (cmd *Cmd) ServeDAP(addr string) error {
+	ir := cmd.Interp
+	if addr != "" {
+		return debug.ListenDAP(ir, addr)
+	}
+	// standard output is used by the protocol:
+	// send output of compiled code, as fmt.Println(), to the client instead
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	os.Stdout = w
+	defer func() {
+		os.Stdout = stdout
+		w.Close()
+	}()
+	server := debug.NewDAPServer(ir, os.Stdin, stdout)
+	go io.Copy(server.Output("stdout"), r)
+	return server.Serve()
+}
+
 func (cmd *Cmd) EvalFilesAndDirs(filesAndDirs ...string) error {
 	for _, fileOrDir := range filesAndDirs {
 		err := cmd.EvalFileOrDir(fileOrDir)
@@ -212,14 +355,35 @@ func (cmd *Cmd) EvalFileOrDir(fileOrDir string) error {
 	}
 }
 
+// EvalDir executes the Go package in dirname, if any, as "go run" would,
+// then evaluates the *.gomacro files in dirname
 func (cmd *Cmd) EvalDir(dirname string) error {
+	if cmd.runGo() {
+		gofiles, err := fast.GoFiles(dirname)
+		if err != nil {
+			return err
+		}
+		if isGoProgram(gofiles...) {
+			err = cmd.runGoFiles(gofiles...)
+		} else {
+			// script-style files: evaluate them sequentially
+			for _, filename := range gofiles {
+				if err = cmd.evalFile(filename); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
 	files, err := ioutil.ReadDir(dirname)
 	if err != nil {
 		return err
 	}
 	for _, file := range files {
 		filename := file.Name()
-		if !file.IsDir() && strings.HasSuffix(filename, ".gomacro") {
+		if !file.IsDir() && strings.HasSuffix(filename, ".gomacro") && filename != ProfileFile {
 			filename = paths.Subdir(dirname, filename)
 			err := cmd.EvalFile(filename)
 			if err != nil {
@@ -238,7 +402,19 @@ const disclaimer = `// ---------------------------------------------------------
 
 `
 
+// EvalFile executes a Go file, except _test.go files, as "go run" would
+// if it contains a package clause and only declarations.
+// Other files, including script-style Go files with top-level statements, are evaluated sequentially,
+// and optionally written to *.go files with option -w
 func (cmd *Cmd) EvalFile(filename string) error {
+	if cmd.runGo() && strings.HasSuffix(filename, ".go") && !strings.HasSuffix(filename, "_test.go") && isGoProgram(filename) {
+		return cmd.runGoFiles(filename)
+	}
+	return cmd.evalFile(filename)
+}
+
+// evalFile evaluates a file sequentially
+func (cmd *Cmd) evalFile(filename string) error {
 	g := &cmd.Interp.Comp.Globals
 	g.Declarations = nil
 	g.Statements = nil
@@ -273,6 +449,42 @@ func (cmd *Cmd) EvalFile(filename string) error {
 	return nil
 }
 
+// runGo returns true if Go files should be executed as "go run" would:
+// false when writing collected declarations or only macroexpanding
+func (cmd *Cmd) runGo() bool {
+	return !cmd.WriteDeclsAndStmts && cmd.Interp.Comp.Options&OptMacroExpandOnly == 0
+}
+
+// isGoProgram returns true if the files are valid Go source files,
+// i.e. they contain a package clause and only declarations, as "go run" requires.
+// An initial #! line is allowed
+func isGoProgram(filenames ...string) bool {
+	fset := token.NewFileSet()
+	for _, filename := range filenames {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return false
+		}
+		if bytes.HasPrefix(src, []byte("#!")) {
+			// keep line numbers unchanged
+			src[0], src[1] = '/', '/'
+		}
+		if _, err = parser.ParseFile(fset, filename, src, 0); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// runGoFiles executes the Go files of a package. see fast.Interp.RunGoFiles()
+func (cmd *Cmd) runGoFiles(filenames ...string) error {
+	exitCode, err := cmd.Interp.RunGoFiles(filenames...)
+	if err != nil {
+		return &ExitError{Code: exitCode, Err: err}
+	}
+	return nil
+}
+
 func (cmd *Cmd) EvalReader(src io.Reader) error {
 	_, err := cmd.Interp.EvalReader(src)
 	if err != nil {
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/WilliamNHarvey/gomacro/fast"
+	"github.com/WilliamNHarvey/gomacro/fast/debug"
+)
+
+// dapClient is a scripted Debug Adapter Protocol client
+type dapClient struct {
+	t      *testing.T
+	in     *bufio.Reader
+	out    io.Writer
+	seq    int
+	events []map[string]interface{}
+}
+
+// fatalf reports an error and terminates the client goroutine:
+// closing the connection makes the server terminate too
+func (c *dapClient) fatalf(format string, args ...interface{}) {
+	c.t.Helper()
+	c.t.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+func (c *dapClient) read() map[string]interface{} {
+	header, err := textproto.NewReader(c.in).ReadMIMEHeader()
+	if err != nil {
+		c.fatalf("DAP client: %v", err)
+	}
+	length, _ := strconv.Atoi(header.Get("Content-Length"))
+	buf := make([]byte, length)
+	if _, err = io.ReadFull(c.in, buf); err != nil {
+		c.fatalf("DAP client: %v", err)
+	}
+	var msg map[string]interface{}
+	if err = json.Unmarshal(buf, &msg); err != nil {
+		c.fatalf("DAP client: %v", err)
+	}
+	return msg
+}
+
+// request sends a request and returns the body of its response. Events are collected
+func (c *dapClient) request(command string, args interface{}) map[string]interface{} {
+	c.seq++
+	buf, _ := json.Marshal(map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	fmt.Fprintf(c.out, "Content-Length: %d\r\n\r\n%s", len(buf), buf)
+	for {
+		msg := c.read()
+		if msg["type"] == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+		if msg["command"] != command || msg["request_seq"] != float64(c.seq) {
+			c.fatalf("DAP client: unexpected response %v to request %q", msg, command)
+		}
+		if msg["success"] != true {
+			c.fatalf("DAP client: request %q failed: %v", command, msg["message"])
+		}
+		body, _ := msg["body"].(map[string]interface{})
+		return body
+	}
+}
+
+// waitEvent returns the body of the next event with given name, skipping other events
+func (c *dapClient) waitEvent(name string) map[string]interface{} {
+	for {
+		var msg map[string]interface{}
+		if len(c.events) != 0 {
+			msg, c.events = c.events[0], c.events[1:]
+		} else {
+			msg = c.read()
+		}
+		if msg["type"] == "event" && msg["event"] == name {
+			body, _ := msg["body"].(map[string]interface{})
+			return body
+		}
+	}
+}
+
+// variables returns the variables of a variablesReference, as name -> variable
+func (c *dapClient) variables(ref interface{}) map[string]map[string]interface{} {
+	body := c.request("variables", map[string]interface{}{"variablesReference": ref})
+	vars := make(map[string]map[string]interface{})
+	for _, v := range body["variables"].([]interface{}) {
+		v := v.(map[string]interface{})
+		vars[v["name"].(string)] = v
+	}
+	return vars
+}
+
+// scope returns the variables of the scope with given name in frame
+func (c *dapClient) scope(frame int, name string) map[string]map[string]interface{} {
+	body := c.request("scopes", map[string]interface{}{"frameId": frame})
+	for _, s := range body["scopes"].([]interface{}) {
+		s := s.(map[string]interface{})
+		if s["name"] == name {
+			return c.variables(s["variablesReference"])
+		}
+	}
+	c.fatalf("DAP client: no scope %q in frame %d", name, frame)
+	return nil
+}
+
+func (c *dapClient) expectStopped(reason string, line int) {
+	if body := c.waitEvent("stopped"); body["reason"] != reason {
+		c.fatalf("expecting stop reason %q, found %v", reason, body["reason"])
+	}
+	body := c.request("stackTrace", map[string]interface{}{"threadId": 1})
+	frame := body["stackFrames"].([]interface{})[0].(map[string]interface{})
+	if frame["line"] != float64(line) {
+		c.fatalf("expecting stop at line %d, found %v", line, frame["line"])
+	}
+}
+
+func (c *dapClient) expectValue(vars map[string]map[string]interface{}, name string, value string) {
+	c.t.Helper()
+	if v := vars[name]; v == nil || v["value"] != value {
+		c.t.Errorf("expecting variable %s = %s, found %v", name, value, v)
+	}
+}
+
+func TestDAP(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "dap.gomacro")
+	src := `package main
+
+type P struct{ X, Y int }
+
+func add(a, b int) int {
+	c := a + b
+	return c
+}
+
+func main() {
+	p := P{1, 2}
+	n := add(p.X, p.Y)
+	n = add(n, 10)
+	_ = n
+}
+`
+	if err := os.WriteFile(file, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ir := fast.New()
+	cin, sout := io.Pipe()
+	sin, cout := io.Pipe()
+	server := debug.NewDAPServer(ir, sin, sout)
+	client := &dapClient{t: t, in: bufio.NewReader(cin), out: cout}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer cout.Close()
+		client.request("initialize", map[string]interface{}{"adapterID": "gomacro"})
+		client.waitEvent("initialized")
+		client.request("launch", map[string]interface{}{"program": file})
+		body := client.request("setBreakpoints", map[string]interface{}{
+			"source":      map[string]interface{}{"path": file},
+			"breakpoints": []interface{}{map[string]interface{}{"line": 6, "condition": "a == 3"}},
+		})
+		if bps := body["breakpoints"].([]interface{}); len(bps) != 1 || bps[0].(map[string]interface{})["verified"] != true {
+			t.Errorf("expecting one verified breakpoint, found %v", bps)
+		}
+		client.request("configurationDone", nil)
+
+		// the condition skips the first call to add()
+		client.expectStopped("breakpoint", 6)
+		body = client.request("stackTrace", map[string]interface{}{"threadId": 1})
+		frames := body["stackFrames"].([]interface{})
+		if len(frames) < 2 || frames[0].(map[string]interface{})["name"] != "add" || frames[1].(map[string]interface{})["name"] != "main" {
+			t.Errorf("expecting stack frames add, main, found %v", frames)
+		}
+		locals := client.scope(0, "Locals")
+		client.expectValue(locals, "a", "3")
+		client.expectValue(locals, "b", "10")
+
+		body = client.request("evaluate", map[string]interface{}{"expression": "a * b", "frameId": 0})
+		if body["result"] != "30" {
+			t.Errorf("expecting evaluate result 30, found %v", body["result"])
+		}
+		// variables of the caller, and fields of a struct
+		locals = client.scope(1, "Locals")
+		client.expectValue(locals, "n", "3")
+		if p := locals["p"]; p == nil || p["variablesReference"] == float64(0) {
+			t.Errorf("expecting a struct variable p, found %v", p)
+		} else {
+			fields := client.variables(p["variablesReference"])
+			client.expectValue(fields, "X", "1")
+			client.expectValue(fields, "Y", "2")
+		}
+
+		client.request("next", map[string]interface{}{"threadId": 1})
+		client.expectStopped("step", 7)
+		body = client.request("evaluate", map[string]interface{}{"expression": "c", "frameId": 0})
+		if body["result"] != "13" {
+			t.Errorf("expecting evaluate result 13, found %v", body["result"])
+		}
+
+		client.request("continue", map[string]interface{}{"threadId": 1})
+		if body := client.waitEvent("exited"); body["exitCode"] != float64(0) {
+			t.Errorf("expecting exit code 0, found %v", body["exitCode"])
+		}
+		client.waitEvent("terminated")
+		client.request("disconnect", nil)
+	}()
+
+	if err := server.Serve(); err != nil {
+		t.Error(err)
+	}
+	sout.Close()
+	<-done
+}
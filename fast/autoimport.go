@@ -0,0 +1,129 @@
+package fast
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+
+	"github.com/WilliamNHarvey/gomacro/base"
+	"github.com/WilliamNHarvey/gomacro/imports"
+)
+
+// autoImportDefaults chooses among packages with the same name
+// found in imports.Packages, as math/rand and crypto/rand
+var autoImportDefaults = map[string]string{
+	"rand":     "math/rand",
+	"scanner":  "text/scanner",
+	"template": "text/template",
+	"pprof":    "runtime/pprof",
+}
+
+// SetAutoImport configures the package imported when option Import.Auto is set
+// and the code uses name.Symbol without importing name: it overrides the default,
+// which is the package named name in imports.Packages.
+// If path is empty, removes the configuration for name
+func (ir *Interp) SetAutoImport(name string, path string) {
+	cg := ir.Comp.CompGlobals
+	if path == "" {
+		delete(cg.autoImports, name)
+		return
+	}
+	if cg.autoImports == nil {
+		cg.autoImports = make(map[string]string)
+	}
+	cg.autoImports[name] = path
+}
+
+// autoImport imports the package for name.Symbol if option Import.Auto is set
+// and name is not yet defined. Returns true if it imported a package
+func (c *Comp) autoImport(name string) bool {
+	if c.Options&base.OptImportAuto == 0 || name == "_" ||
+		c.TryResolve(name) != nil || c.TryResolveType(name) != nil {
+		return false
+	}
+	path := c.autoImportPath(name)
+	if path == "" {
+		return false
+	}
+	fc := c.FileComp()
+	imp, err := fc.importPackageOrError(PackageName(name), path)
+	if err != nil {
+		c.Warnf("auto-import %q failed: %v", path, err)
+		return false
+	}
+	spec := &ast.ImportSpec{
+		Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(path)},
+	}
+	if imp.Name != name {
+		spec.Name = &ast.Ident{Name: name}
+	}
+	c.CollectNode(&ast.GenDecl{Tok: token.IMPORT, Specs: []ast.Spec{spec}})
+	if c.Options&base.OptShowPrompt != 0 {
+		if spec.Name != nil {
+			c.Fprintf(c.Stdout, "// auto-imported %s %q\n", name, path)
+		} else {
+			c.Fprintf(c.Stdout, "// auto-imported %q\n", path)
+		}
+	}
+	return true
+}
+
+// autoImportPath returns the path of the package to import for name,
+// or "" if there is none. Packages compiled into the interpreter are the only candidates:
+// the standard library is preferred, then the shortest path
+func (c *Comp) autoImportPath(name string) string {
+	sb := c.CompGlobals.sandbox
+	allow := func(path string) bool {
+		_, ok := imports.Packages[path]
+		return ok && (sb == nil || sb.allowImport(path))
+	}
+	if path, ok := c.CompGlobals.autoImports[name]; ok {
+		if !allow(path) {
+			return ""
+		}
+		return path
+	}
+	if path, ok := autoImportDefaults[name]; ok && allow(path) {
+		return path
+	}
+	var best string
+	for path, pkg := range imports.Packages {
+		if string(pkg.DefaultName(path)) != name || !allow(path) || isInternalPath(path) {
+			continue
+		}
+		if best == "" || autoImportLess(path, best) {
+			best = path
+		}
+	}
+	return best
+}
+
+// autoImportLess returns true if path is a better candidate than other:
+// standard library packages first, then shorter paths
+func autoImportLess(path, other string) bool {
+	if std, otherstd := isStdlibPath(path), isStdlibPath(other); std != otherstd {
+		return std
+	}
+	if len(path) != len(other) {
+		return len(path) < len(other)
+	}
+	return path < other
+}
+
+func isStdlibPath(path string) bool {
+	first := path
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		first = path[:i]
+	}
+	return !strings.Contains(first, ".")
+}
+
+func isInternalPath(path string) bool {
+	for _, elem := range strings.Split(path, "/") {
+		if elem == "internal" || elem == "vendor" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,584 @@
+package fast
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/WilliamNHarvey/gomacro/base"
+	xr "github.com/WilliamNHarvey/gomacro/xreflect"
+)
+
+// Breakpoint is a line or function breakpoint,
+// created by Interp.SetBreakpoint() or Interp.SetFuncBreakpoint()
+type Breakpoint struct {
+	ID      int
+	File    string // for line breakpoints: file name, or a suffix of its path
+	Line    int    // for line breakpoints
+	Func    string // for function breakpoints: function name, or Type.Method
+	Enabled bool
+	Cond    string // if not empty, the debugger stops only when this boolean expression is true
+	Hits    int    // number of times the breakpoint was reached with a true condition
+	Ignore  int    // number of hits to ignore before stopping
+	// number of statements where the breakpoint is set.
+	// zero means the breakpoint is pending: it will be set when matching code is compiled
+	Locations int
+}
+
+func (bp *Breakpoint) String() string {
+	if bp.Func != "" {
+		return "func " + bp.Func
+	}
+	return fmt.Sprintf("%s:%d", bp.File, bp.Line)
+}
+
+// breakpoints contains the breakpoints and the compiled code they can be set in.
+// Breakpoints are set in breakSites, which replace the first statement of each line
+// before the code is executed for the first time.
+// Other goroutines can thus set and remove breakpoints while the code executes:
+// a breakSite without breakpoints only costs an atomic load
+type breakpoints struct {
+	lock    sync.Mutex
+	list    []*Breakpoint
+	watches []*Watchpoint
+	nwatch  int32 // len(watches), read atomically while single-stepping
+	lastID  int
+	codes   map[string]*debugCode // key is package path + "." + name, or + "." + position for top-level function literals
+}
+
+// debugCode is the compiled code of a function, registered for breakpoints
+type debugCode struct {
+	name     string
+	decl     token.Pos // position of function declaration
+	list     []Stmt
+	pos      []token.Pos
+	entry    int         // index of the first statement of the function body, or -1
+	lines    []debugLine // first statement of each line
+	sites    map[int]*breakSite
+	children []*debugCode // function literals contained in the function
+}
+
+// debugLine is the first statement of a line, where line breakpoints are set.
+// Positions are computed at compile time: the Fileset is not safe for concurrent use
+type debugLine struct {
+	ip   int
+	file string
+	line int
+}
+
+// breakSite is a statement replaced by a breakpoint
+type breakSite struct {
+	b     *breakpoints
+	orig  Stmt
+	nbps  int32 // len(bps), read atomically by exec
+	bps   []*Breakpoint
+	conds map[*Breakpoint]*breakCond
+}
+
+// breakCond is the compiled condition of a breakpoint
+type breakCond struct {
+	id   int
+	src  string
+	once sync.Once
+	expr *Expr
+	err  interface{}
+}
+
+// execCode returns a func(*Env) that will execute the code compiled by c, then clears it.
+// If debugger support is enabled, also applies the breakpoints to the code.
+// name is the function name, or "" for function literals and top-level code,
+// and decl is the position of the function declaration.
+// If keep is true, the code is also registered for breakpoints set later:
+// functions and methods replace any previous code with the same name,
+// function literals are registered together with the function containing them,
+// and top-level function literals replace any previous code at the same position
+func (c *Comp) execCode(name string, decl token.Pos, keep bool) func(*Env) {
+	all, pos, defers := c.Code.finish()
+	if all == nil {
+		return nil
+	}
+	if c.Globals.Options&base.OptDebugger != 0 {
+		c.debugCode(&debugCode{name: name, decl: decl, list: all, pos: pos}, keep)
+	}
+	return execCode(all, pos, defers)
+}
+
+func (c *Comp) debugCode(code *debugCode, keep bool) {
+	b, g := &c.breakpoints, &c.Globals
+	code.init(g)
+	var key string
+	if keep {
+		if c.Func != nil {
+			code.children = c.Func.codes
+		}
+		if code.name != "" {
+			key = c.FileComp().Path + "." + code.name
+		} else if outer := c.Outer.enclosingFunc(); outer != nil {
+			// the function containing this literal registers it, before executing it
+			code.addSites(b)
+			outer.codes = append(outer.codes, code)
+			return
+		} else if g.Fileset != nil && code.decl.IsValid() {
+			// top-level function literals, as in var f = func() { ... }
+			key = c.FileComp().Path + "." + g.Fileset.Position(code.decl).String()
+		}
+	}
+	if key != "" {
+		code.addSites(b)
+	}
+	b.addCode(code, key)
+}
+
+// enclosingFunc returns the FuncInfo of the innermost function being compiled, or nil
+func (c *Comp) enclosingFunc() *FuncInfo {
+	for o := c; o != nil; o = o.Outer {
+		if o.Func != nil {
+			return o.Func
+		}
+	}
+	return nil
+}
+
+// init computes the statements where breakpoints can be set
+func (code *debugCode) init(g *base.Globals) {
+	type line struct {
+		file string
+		line int
+	}
+	var seen map[line]bool
+	code.entry = -1
+	for i, p := range code.pos {
+		if p == token.NoPos {
+			continue
+		}
+		// skip synthetic statements, the debugger does not stop on them,
+		// and statements compiled for the function declaration itself
+		if code.entry < 0 && p > code.decl {
+			code.entry = i
+		}
+		if g.Fileset == nil {
+			continue
+		}
+		pos := g.Fileset.Position(p)
+		key := line{pos.Filename, pos.Line}
+		if seen == nil {
+			seen = make(map[line]bool)
+		} else if seen[key] {
+			continue
+		}
+		seen[key] = true
+		code.lines = append(code.lines, debugLine{i, pos.Filename, pos.Line})
+	}
+}
+
+// addSites creates a breakSite at the first statement of the function
+// and at the first statement of each line, where breakpoints can be set later.
+// Must be called before code is executed
+func (code *debugCode) addSites(b *breakpoints) {
+	if code.entry >= 0 {
+		code.site(b, code.entry)
+	}
+	for _, l := range code.lines {
+		code.site(b, l.ip)
+	}
+}
+
+// site returns the breakSite at ip, creating it if needed.
+// Must be called before code is executed
+func (code *debugCode) site(b *breakpoints, ip int) *breakSite {
+	if code.sites == nil {
+		code.sites = make(map[int]*breakSite)
+	}
+	site := code.sites[ip]
+	if site == nil {
+		site = &breakSite{b: b, orig: code.list[ip]}
+		code.sites[ip] = site
+		code.list[ip] = site.exec
+	}
+	return site
+}
+
+// addCode sets the existing breakpoints in code and the function literals it contains.
+// If key is not empty, also registers code for breakpoints set later,
+// replacing the code previously registered with the same key.
+// Code not registered must not be executed yet, because breakSites are created as needed
+func (b *breakpoints) addCode(code *debugCode, key string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, bp := range b.list {
+		code.resolve(b, bp, key == "")
+	}
+	if key == "" {
+		return
+	}
+	if b.codes == nil {
+		b.codes = make(map[string]*debugCode)
+	} else if old := b.codes[key]; old != nil {
+		old.clear()
+	}
+	b.codes[key] = code
+}
+
+func (b *breakpoints) add(bp *Breakpoint) *Breakpoint {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.lastID++
+	bp.ID = b.lastID
+	bp.Enabled = true
+	b.list = append(b.list, bp)
+	for _, code := range b.codes {
+		code.resolve(b, bp, false)
+	}
+	return bp
+}
+
+func (b *breakpoints) remove(id int) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for i, bp := range b.list {
+		if bp.ID == id {
+			bp.Enabled = false
+			for _, code := range b.codes {
+				code.remove(bp)
+			}
+			b.list = append(b.list[:i], b.list[i+1:]...)
+			return true
+		}
+	}
+	for i, w := range b.watches {
+		if w.ID == id {
+			w.Enabled = false
+			b.watches = append(b.watches[:i], b.watches[i+1:]...)
+			atomic.StoreInt32(&b.nwatch, int32(len(b.watches)))
+			return true
+		}
+	}
+	return false
+}
+
+// find returns the breakpoint or watchpoint with given ID. must be called with b.lock held
+func (b *breakpoints) find(id int) (*Breakpoint, *Watchpoint) {
+	for _, bp := range b.list {
+		if bp.ID == id {
+			return bp, nil
+		}
+	}
+	for _, w := range b.watches {
+		if w.ID == id {
+			return nil, w
+		}
+	}
+	return nil, nil
+}
+
+func (b *breakpoints) enable(id int, enabled bool) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	bp, w := b.find(id)
+	if bp != nil {
+		bp.Enabled = enabled
+	} else if w != nil {
+		w.Enabled = enabled
+		if enabled {
+			// do not report changes that happened while disabled
+			w.update()
+		}
+	} else {
+		return false
+	}
+	return true
+}
+
+// setCond sets the condition of breakpoint with given ID
+func (b *breakpoints) setCond(id int, cond string) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	bp, _ := b.find(id)
+	if bp == nil {
+		return false
+	}
+	bp.Cond = strings.TrimSpace(cond)
+	return true
+}
+
+// setIgnore sets the number of hits to ignore for the breakpoint or watchpoint with given ID
+func (b *breakpoints) setIgnore(id int, count int) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	bp, w := b.find(id)
+	if bp != nil {
+		bp.Ignore = count
+	} else if w != nil {
+		w.Ignore = count
+	} else {
+		return false
+	}
+	return true
+}
+
+func (b *breakpoints) copy() []Breakpoint {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	ret := make([]Breakpoint, len(b.list))
+	for i, bp := range b.list {
+		ret[i] = *bp
+	}
+	return ret
+}
+
+// resolve sets breakpoint bp in the first statement of code matching its position,
+// and in the function literals contained in code.
+// If create is true, creates the needed breakSite: code must not be executed yet.
+// Must be called with b.lock held
+func (code *debugCode) resolve(b *breakpoints, bp *Breakpoint, create bool) {
+	for _, child := range code.children {
+		child.resolve(b, bp, create)
+	}
+	ip := -1
+	if bp.Func != "" {
+		if bp.Func == code.name {
+			ip = code.entry
+		}
+	} else {
+		for _, l := range code.lines {
+			if l.line == bp.Line && matchFile(l.file, bp.File) {
+				ip = l.ip
+				break
+			}
+		}
+	}
+	if ip < 0 {
+		return
+	}
+	site := code.sites[ip]
+	if site == nil {
+		if !create {
+			return
+		}
+		site = code.site(b, ip)
+	}
+	site.bps = append(site.bps, bp)
+	atomic.StoreInt32(&site.nbps, int32(len(site.bps)))
+	bp.Locations++
+}
+
+// remove deletes breakpoint bp from code and from the function literals it contains.
+// Must be called with b.lock held
+func (code *debugCode) remove(bp *Breakpoint) {
+	for _, child := range code.children {
+		child.remove(bp)
+	}
+	for _, site := range code.sites {
+		for i, x := range site.bps {
+			if x == bp {
+				site.bps = append(site.bps[:i], site.bps[i+1:]...)
+				atomic.StoreInt32(&site.nbps, int32(len(site.bps)))
+				break
+			}
+		}
+	}
+}
+
+// clear deletes all breakpoints from code, which was replaced by newer code with the same name.
+// Must be called with b.lock held
+func (code *debugCode) clear() {
+	for _, child := range code.children {
+		child.clear()
+	}
+	for _, site := range code.sites {
+		for _, bp := range site.bps {
+			bp.Locations--
+		}
+		site.bps = nil
+		atomic.StoreInt32(&site.nbps, 0)
+	}
+}
+
+// matchFile returns true if filename is file, or ends with /file
+func matchFile(filename string, file string) bool {
+	filename = filepath.ToSlash(filename)
+	file = filepath.ToSlash(file)
+	return filename == file || strings.HasSuffix(filename, "/"+file)
+}
+
+// stop evaluates the conditions of the enabled breakpoints at this site
+// and updates their hit and ignore counts.
+// returns true if the debugger should stop
+func (site *breakSite) stop(c *Comp, env *Env) bool {
+	b := site.b
+	b.lock.Lock()
+	bps := make([]*Breakpoint, 0, len(site.bps))
+	conds := make([]*breakCond, 0, len(site.bps))
+	for _, bp := range site.bps {
+		if bp.Enabled {
+			bps = append(bps, bp)
+			conds = append(conds, site.cond(bp))
+		}
+	}
+	b.lock.Unlock()
+
+	stop := false
+	for i, bp := range bps {
+		// conditions can execute arbitrary code: evaluate them without holding the lock
+		if cond := conds[i]; cond != nil && !cond.eval(c, env) {
+			continue
+		}
+		b.lock.Lock()
+		bp.Hits++
+		if bp.Ignore > 0 {
+			bp.Ignore--
+		} else {
+			stop = true
+		}
+		b.lock.Unlock()
+	}
+	return stop
+}
+
+// cond returns the condition of breakpoint bp, or nil if it has none.
+// Must be called with b.lock held
+func (site *breakSite) cond(bp *Breakpoint) *breakCond {
+	src := bp.Cond
+	if src == "" {
+		return nil
+	}
+	cond := site.conds[bp]
+	if cond == nil || cond.src != src {
+		cond = &breakCond{id: bp.ID, src: src}
+		if site.conds == nil {
+			site.conds = make(map[*Breakpoint]*breakCond)
+		}
+		site.conds[bp] = cond
+	}
+	return cond
+}
+
+// eval evaluates the condition of a breakpoint, compiling it on first use.
+// The condition is compiled with an inner Interp, thus it can access the local variables.
+// On errors, shows them and returns true, i.e. the debugger stops
+func (cond *breakCond) eval(c *Comp, env *Env) (ret bool) {
+	run := env.Run
+	// do not single-step or stop at breakpoints while evaluating the condition
+	debug, flags := run.Signals.Debug, run.ExecFlags
+	run.Signals.Debug = base.SigNone
+	run.ExecFlags.SetDebug(false)
+	defer func() {
+		run.Signals.Debug, run.ExecFlags = debug, flags
+		if rec := recover(); rec != nil {
+			c.Warnf("breakpoint %d: error evaluating condition %q: %v", cond.id, cond.src, rec)
+			ret = true
+		}
+	}()
+	ir := NewInnerInterp(&Interp{c, env}, "debug", "debug")
+	cond.once.Do(func() {
+		cond.compile(ir)
+	})
+	if cond.err != nil {
+		panic(cond.err)
+	}
+	return cond.expr.AsX1()(ir.env).Bool()
+}
+
+// compile compiles the condition of a breakpoint
+func (cond *breakCond) compile(ir *Interp) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			cond.err = rec
+		}
+	}()
+	expr := ir.Compile(cond.src)
+	if expr == nil || expr.NumOut() != 1 || expr.Type == nil || expr.Type.Kind() != xr.Bool {
+		panic(errors.New("condition must be a boolean expression"))
+	}
+	cond.expr = expr
+}
+
+// exec enters the debugger if a breakpoint is set at this site,
+// then executes the original statement
+func (site *breakSite) exec(env *Env) (Stmt, *Env) {
+	if atomic.LoadInt32(&site.nbps) == 0 {
+		return site.orig(env)
+	}
+	run := env.Run
+	c := env.DebugComp
+	// if single-stepping, the debugger already stopped at this statement
+	stepping := run.Signals.Debug != base.SigNone && env.CallDepth < run.DebugDepth
+	if c == nil || stepping || !site.stop(c, env) {
+		return site.orig(env)
+	}
+	ir := Interp{c, env}
+	sig := ir.debug(true)
+	stmt, env := site.orig(env)
+	if sig != base.SigNone && stmt != nil {
+		stmt = run.Interrupt
+	}
+	return stmt, env
+}
+
+// SetBreakpoint sets a breakpoint at the first statement of file:line.
+// file can be a file name or a suffix of its path, as "main.go" or "pkg/main.go".
+// The breakpoint also applies to code compiled later.
+// Requires debugger support, i.e. base.OptDebugger
+func (ir *Interp) SetBreakpoint(file string, line int) *Breakpoint {
+	return ir.Comp.breakpoints.add(&Breakpoint{File: file, Line: line})
+}
+
+// SetFuncBreakpoint sets a breakpoint at the first statement of the function or method
+// with given name. Methods are named Type.Method.
+// The breakpoint also applies to code compiled later.
+// Requires debugger support, i.e. base.OptDebugger
+func (ir *Interp) SetFuncBreakpoint(name string) *Breakpoint {
+	return ir.Comp.breakpoints.add(&Breakpoint{Func: name})
+}
+
+// AddBreakpoint sets a line or function breakpoint with the File and Line, or Func,
+// Cond and Ignore of bp. Other fields are ignored.
+// Unlike SetBreakpoint() followed by SetBreakpointCondition(), code executing
+// in other goroutines never sees the breakpoint without its condition.
+// Requires debugger support, i.e. base.OptDebugger
+func (ir *Interp) AddBreakpoint(bp Breakpoint) *Breakpoint {
+	return ir.Comp.breakpoints.add(&Breakpoint{
+		File:   bp.File,
+		Line:   bp.Line,
+		Func:   bp.Func,
+		Cond:   strings.TrimSpace(bp.Cond),
+		Ignore: bp.Ignore,
+	})
+}
+
+// DeleteBreakpoint deletes the breakpoint with given ID.
+// returns false if not found
+func (ir *Interp) DeleteBreakpoint(id int) bool {
+	return ir.Comp.breakpoints.remove(id)
+}
+
+// EnableBreakpoint enables or disables the breakpoint with given ID.
+// returns false if not found
+func (ir *Interp) EnableBreakpoint(id int, enabled bool) bool {
+	return ir.Comp.breakpoints.enable(id, enabled)
+}
+
+// SetBreakpointCondition sets the condition of the breakpoint with given ID:
+// the debugger will stop only when cond evaluates to true.
+// cond is compiled on first use, in the scope of the statement where the breakpoint is set.
+// An empty cond removes the condition.
+// returns false if not found
+func (ir *Interp) SetBreakpointCondition(id int, cond string) bool {
+	return ir.Comp.breakpoints.setCond(id, cond)
+}
+
+// SetBreakpointIgnore sets the number of hits to ignore
+// for the breakpoint or watchpoint with given ID.
+// returns false if not found
+func (ir *Interp) SetBreakpointIgnore(id int, count int) bool {
+	return ir.Comp.breakpoints.setIgnore(id, count)
+}
+
+// Breakpoints returns a copy of the current breakpoints, sorted by ID
+func (ir *Interp) Breakpoints() []Breakpoint {
+	return ir.Comp.breakpoints.copy()
+}
@@ -0,0 +1,169 @@
+package fast
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+
+	"github.com/WilliamNHarvey/gomacro/base"
+	xr "github.com/WilliamNHarvey/gomacro/xreflect"
+)
+
+// Budget limits the resources that each evaluation can use,
+// including the goroutines it starts with "go" statements.
+// Zero means unlimited
+type Budget struct {
+	Statements int64 // executed statements
+	Goroutines int64 // goroutines started with "go" statements
+	AllocBytes int64 // bytes allocated by make(), new(), append() and composite literals
+}
+
+// BudgetError is the error returned by an evaluation that exceeds its Budget
+type BudgetError struct {
+	Resource string // "statements", "goroutines" or "bytes"
+	Limit    int64
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("evaluation budget exceeded: more than %d %s", e.Limit, e.Resource)
+}
+
+// SetBudget sets the Budget of subsequent evaluations.
+//
+// An evaluation that exceeds its Budget is interrupted: Interp.RunE(), Interp.EvalE()
+// and their variants return a *BudgetError, while Interp.RunExpr(), Interp.Eval()
+// and their variants panic with it. The same limitations of Interp.RunExprContext() apply:
+// goroutines are interrupted only while they execute interpreted statements.
+//
+// Statements are counted only while executing code with a Budget,
+// which is slower than executing code without one
+func (ir *Interp) SetBudget(budget Budget) {
+	ir.env.Run.budget = budget
+}
+
+// Budget returns the Budget of evaluations, as set by Interp.SetBudget()
+func (ir *Interp) Budget() Budget {
+	return ir.env.Run.budget
+}
+
+// budgetState contains the resources still available to an evaluation.
+// It is shared by all the Runs of a runGroup, thus it is updated atomically
+type budgetState struct {
+	limits     Budget
+	statements int64
+	goroutines int64
+	bytes      int64
+}
+
+// each Run reserves statements in chunks, to reduce contention among goroutines
+const statementChunk = 256
+
+func newBudgetState(limits Budget) *budgetState {
+	return &budgetState{
+		limits:     limits,
+		statements: available(limits.Statements),
+		goroutines: available(limits.Goroutines),
+		bytes:      available(limits.AllocBytes),
+	}
+}
+
+func available(limit int64) int64 {
+	if limit <= 0 {
+		return math.MaxInt64
+	}
+	return limit
+}
+
+// take removes n from *avail and returns n.
+// If less than n is available, removes and returns what is available if partial is true,
+// otherwise removes nothing and returns zero
+func take(avail *int64, n int64, partial bool) int64 {
+	for {
+		a := atomic.LoadInt64(avail)
+		if a < n {
+			if !partial || a <= 0 {
+				return 0
+			}
+			n = a
+		}
+		if atomic.CompareAndSwapInt64(avail, a, a-n) {
+			return n
+		}
+	}
+}
+
+// spendStatement charges a statement to the budget of run.
+// Returns false and interrupts the evaluation if the budget is exhausted,
+// or if the evaluation was already interrupted
+func (run *Run) spendStatement() bool {
+	if run.stmtQuota == 0 {
+		group := run.group
+		if group.isCancelled() {
+			// interpreted code recovered from the interruption
+			group.cancel(nil)
+			return false
+		}
+		state := group.budget
+		if run.stmtQuota = take(&state.statements, statementChunk, true); run.stmtQuota == 0 {
+			group.cancel(&BudgetError{Resource: "statements", Limit: state.limits.Statements})
+			return false
+		}
+	}
+	run.stmtQuota--
+	return true
+}
+
+// spendGoroutine charges a goroutine to the budget of run, if any.
+// Interrupts the evaluation if the budget is exhausted
+func (run *Run) spendGoroutine() {
+	if run.ExecFlags.IsBudget() {
+		state := run.group.budget
+		if take(&state.goroutines, 1, false) == 0 {
+			run.group.exceed(&BudgetError{Resource: "goroutines", Limit: state.limits.Goroutines})
+		}
+	}
+}
+
+// allocate charges n elements of type t to the budget of run, if any.
+// Interrupts the evaluation if the budget is exhausted
+func (run *Run) allocate(t xr.Type, n int) {
+	if run.ExecFlags.IsBudget() && n > 0 {
+		size := int64(t.Size())
+		if size != 0 && int64(n) > math.MaxInt64/size {
+			size = math.MaxInt64
+		} else {
+			size *= int64(n)
+		}
+		state := run.group.budget
+		if size != 0 && take(&state.bytes, size, false) == 0 {
+			run.group.exceed(&BudgetError{Resource: "bytes", Limit: state.limits.AllocBytes})
+		}
+	}
+}
+
+// allocateMake charges to the budget of run, if any, the buffer created by make(t, n)
+func (run *Run) allocateMake(t xr.Type, n int) {
+	if run.ExecFlags.IsBudget() {
+		switch t.Kind() {
+		case xr.Chan, xr.Slice:
+			run.allocate(t.Elem(), n)
+		case xr.Map:
+			run.allocate(t.Key(), n)
+			run.allocate(t.Elem(), n)
+		}
+	}
+}
+
+// allocateAppend charges to the budget of run, if any, the buffer allocated
+// by append() to grow slice into result
+func (run *Run) allocateAppend(telem xr.Type, slice xr.Value, result xr.Value) {
+	if run.ExecFlags.IsBudget() && result.Cap() != slice.Cap() {
+		run.allocate(telem, result.Cap())
+	}
+}
+
+// exceed interrupts the evaluation of group because its budget is exhausted
+func (group *runGroup) exceed(err *BudgetError) {
+	group.cancel(err)
+	panic(base.SigInterrupt)
+}
@@ -87,6 +87,12 @@ func (ir *Interp) addBuiltins() {
 	ir.DeclType(c.TypeOfError())
 	c.loadProxy("error", r.TypeOf((*proxy_error)(nil)).Elem(), c.TypeOfError())
 
+	// predeclared type constraint, added in Go 1.18
+	tcomparable := c.Universe.NamedOf("comparable", "")
+	tcomparable.SetUnderlying(c.TypeOfInterface())
+	ir.DeclType(tcomparable)
+	c.constraints[xr.MakeKey(tcomparable)] = &typeConstraint{comparable: true}
+
 	// https://golang.org/ref/spec#Constants
 	// "Literal constants, true, false, iota, and certain constant expressions containing only untyped constant operands are untyped."
 	ir.DeclConst("false", nil, untyped.MakeLit(untyped.Bool, constant.MakeBool(false), basicTypes))
@@ -97,6 +103,7 @@ func (ir *Interp) addBuiltins() {
 
 	ir.DeclBuiltin("append", Builtin{compileAppend, 1, base.MaxUint16})
 	ir.DeclBuiltin("cap", Builtin{compileCap, 1, 1})
+	ir.DeclBuiltin("clear", Builtin{compileClear, 1, 1})
 	ir.DeclBuiltin("close", Builtin{compileClose, 1, 1})
 	ir.DeclBuiltin("copy", Builtin{compileCopy, 2, 2})
 	ir.DeclBuiltin("complex", Builtin{compileComplex, 2, 2})
@@ -104,6 +111,8 @@ func (ir *Interp) addBuiltins() {
 	ir.DeclBuiltin("imag", Builtin{compileRealImag, 1, 1})
 	ir.DeclBuiltin("len", Builtin{compileLen, 1, 1})
 	ir.DeclBuiltin("make", Builtin{compileMake, 1, 3})
+	ir.DeclBuiltin("max", Builtin{compileMinMax, 1, base.MaxUint16})
+	ir.DeclBuiltin("min", Builtin{compileMinMax, 1, base.MaxUint16})
 	ir.DeclBuiltin("new", Builtin{compileNew, 1, 1})
 	ir.DeclBuiltin("panic", Builtin{compilePanic, 1, 1})
 	ir.DeclBuiltin("print", Builtin{compilePrint, 0, base.MaxUint16})
@@ -217,6 +226,38 @@ func compileCap(c *Comp, sym Symbol, node *ast.CallExpr) *Call {
 	return newCall1(fun, arg, arg.Const(), tout)
 }
 
+// --- clear() ---
+
+func callClear(val xr.Value) {
+	switch val.Kind() {
+	case r.Map:
+		clearMap(val.ReflectValue())
+	case r.Slice:
+		zero := xr.ZeroR(val.Type().Elem())
+		for i, n := 0, val.Len(); i < n; i++ {
+			val.Index(i).Set(zero)
+		}
+	}
+}
+
+func compileClear(c *Comp, sym Symbol, node *ast.CallExpr) *Call {
+	arg := c.expr1(node.Args[0], nil)
+	tin := arg.Type
+	if tin == nil {
+		return c.badBuiltinCallArgType(sym.Name, node.Args[0], tin, "map or slice")
+	}
+	switch tin.Kind() {
+	case r.Map, r.Slice:
+		// ok
+	default:
+		return c.badBuiltinCallArgType(sym.Name, node.Args[0], tin, "map or slice")
+	}
+	t := c.Universe.FuncOf([]xr.Type{tin}, zeroTypes, false)
+	sym.Type = t
+	fun := exprLit(Lit{Type: t, Value: callClear}, &sym)
+	return newCall1(fun, arg, false)
+}
+
 // --- close() ---
 
 func callClose(val xr.Value) {
@@ -847,6 +888,7 @@ func callRecover(v xr.Value) xr.Value {
 	// consume the current panic
 	run.Panic = nil
 	run.PanicFun = nil
+	run.PanicEnv = nil
 	return v
 }
 
@@ -855,6 +897,13 @@ func argEnv(env *Env) xr.Value {
 }
 
 func compileRecover(c *Comp, sym Symbol, node *ast.CallExpr) *Call {
+	// mark the enclosing function: if compiled code defers it, it must recover() the panic itself
+	for o := c; o != nil; o = o.Outer {
+		if o.Func != nil {
+			o.Func.Recovers = true
+			break
+		}
+	}
 	ti := c.TypeOfInterface()
 	t := c.Universe.FuncOf([]xr.Type{ti}, []xr.Type{ti}, false)
 	sym.Type = t
@@ -1135,6 +1184,7 @@ func (c *Comp) call_builtin(call *Call) I {
 		}
 	case func(xr.Value, ...xr.Value) xr.Value: // append()
 		argfunsX1 := call.MakeArgfunsX1()
+		telem := call.OutTypes[0].Elem()
 		if call.Ellipsis {
 			argfuns := [2]func(*Env) xr.Value{
 				argfunsX1[0],
@@ -1145,7 +1195,9 @@ func (c *Comp) call_builtin(call *Call) I {
 					arg0 := argfuns[0](env)
 					arg1 := argfuns[1](env)
 					argslice := unwrapSlice(arg1)
-					return xr.Append(arg0, argslice...)
+					ret := xr.Append(arg0, argslice...)
+					env.Run.allocateAppend(telem, arg0, ret)
+					return ret
 				}
 			} else {
 				ret = func(env *Env) xr.Value {
@@ -1162,7 +1214,9 @@ func (c *Comp) call_builtin(call *Call) I {
 					for i, argfun := range argfunsX1 {
 						args[i] = argfun(env)
 					}
-					return xr.Append(args[0], args[1:]...)
+					ret := xr.Append(args[0], args[1:]...)
+					env.Run.allocateAppend(telem, args[0], ret)
+					return ret
 				}
 			} else {
 				ret = func(env *Env) xr.Value {
@@ -1178,6 +1232,7 @@ func (c *Comp) call_builtin(call *Call) I {
 		arg0 := args[0].Value.(xr.Type)
 		if name == "new" {
 			ret = func(env *Env) xr.Value {
+				env.Run.allocate(arg0, 1)
 				return xr.New(arg0)
 			}
 		} else {
@@ -1190,8 +1245,11 @@ func (c *Comp) call_builtin(call *Call) I {
 		arg1fun := argfuns[1].(func(*Env) int)
 		ret = func(env *Env) xr.Value {
 			arg1 := arg1fun(env)
+			env.Run.allocateMake(arg0, arg1)
 			return fun(arg0, arg1)
 		}
+	case func(*Call) I: // min(), max()
+		ret = fun(call)
 	case func(xr.Type, int, int) xr.Value: // make()
 		arg0 := args[0].Value.(xr.Type)
 		arg1fun := argfuns[1].(func(*Env) int)
@@ -1199,6 +1257,7 @@ func (c *Comp) call_builtin(call *Call) I {
 		ret = func(env *Env) xr.Value {
 			arg1 := arg1fun(env)
 			arg2 := arg2fun(env)
+			env.Run.allocateMake(arg0, arg2)
 			return fun(arg0, arg1, arg2)
 		}
 	default:
@@ -0,0 +1,28 @@
+//go:build go1.21
+
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2026 agent
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * builtin_clear.go
+ *
+ *  Created on: Oct 18, 2026
+ *      Author: agent
+ */
+
+package fast
+
+import (
+	r "reflect"
+)
+
+// clearMap deletes all the entries of a map, including NaN keys
+func clearMap(val r.Value) {
+	val.Clear()
+}
@@ -0,0 +1,593 @@
+package fast
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"math"
+	r "reflect"
+
+	"github.com/WilliamNHarvey/gomacro/base/output"
+	"github.com/WilliamNHarvey/gomacro/base/reflect"
+	"github.com/WilliamNHarvey/gomacro/base/untyped"
+	xr "github.com/WilliamNHarvey/gomacro/xreflect"
+)
+
+// --- min() and max() ---
+
+func compileMinMax(c *Comp, sym Symbol, node *ast.CallExpr) *Call {
+	n := len(node.Args)
+	args := make([]*Expr, n)
+	var t xr.Type
+	for i, node := range node.Args {
+		arg := c.expr1(node, nil)
+		if !arg.Untyped() && t == nil {
+			t = arg.Type
+		}
+		args[i] = arg
+	}
+	if t == nil {
+		// all arguments are untyped constants: result is an untyped constant
+		return compileMinMaxUntyped(c, sym, node, args)
+	}
+	allconst := true
+	for i, arg := range args {
+		if arg.Untyped() {
+			arg.ConstTo(t)
+		} else if !arg.Type.IdenticalTo(t) {
+			c.Errorf("invalid argument: mismatched types <%v> and <%v> in builtin %s(): %v", t, arg.Type, sym.Name, node.Args[i])
+		}
+		allconst = allconst && arg.Const()
+	}
+	if !reflect.IsCategory(t.Kind(), r.Int, r.Uint, r.Float64, r.String) {
+		return c.badBuiltinCallArgType(sym.Name, node.Args[0], t, "integer, floating point or string")
+	}
+	tins := make([]xr.Type, n)
+	for i := range tins {
+		tins[i] = t
+	}
+	touts := []xr.Type{t}
+	tfun := c.Universe.FuncOf(tins, touts, false)
+	sym.Type = tfun
+	var call I = callMin
+	if sym.Name == "max" {
+		call = callMax
+	}
+	fun := exprLit(Lit{Type: tfun, Value: call}, &sym)
+	// min() and max() of constants are constants: they can be computed at compile time
+	return &Call{Fun: fun, Args: args, OutTypes: touts, Const: allconst}
+}
+
+func compileMinMaxUntyped(c *Comp, sym Symbol, node *ast.CallExpr, args []*Expr) *Call {
+	op := token.LSS
+	if sym.Name == "max" {
+		op = token.GTR
+	}
+	var result UntypedLit
+	for i, arg := range args {
+		lit := arg.Value.(UntypedLit)
+		switch lit.Kind {
+		case untyped.Int, untyped.Rune, untyped.Float, untyped.String:
+		default:
+			c.Errorf("invalid argument: %v (untyped %v constant) cannot be ordered in builtin %s()", node.Args[i], lit.Kind, sym.Name)
+		}
+		if i == 0 {
+			result = lit
+			continue
+		}
+		if (lit.Kind == untyped.String) != (result.Kind == untyped.String) {
+			c.Errorf("invalid argument: mismatched types untyped %v and untyped %v in builtin %s(): %v", result.Kind, lit.Kind, sym.Name, node.Args[i])
+		}
+		// the kind of the result is the "largest" kind among the arguments, i.e. int < rune < float
+		kind := result.Kind
+		if untypedMinMaxRank(lit.Kind) > untypedMinMaxRank(kind) {
+			kind = lit.Kind
+		}
+		if constant.Compare(lit.Val, op, result.Val) {
+			result = lit
+		}
+		result = untyped.MakeLit(kind, result.Val, &c.Universe.BasicTypes)
+	}
+	touts := []xr.Type{c.TypeOfUntypedLit()}
+	tfun := c.Universe.FuncOf(nil, touts, false)
+	sym.Type = tfun
+	fun := exprLit(Lit{Type: tfun, Value: result}, &sym)
+	// min() and max() of untyped constants are both untyped and constant: they can be computed at compile time
+	return &Call{Fun: fun, Args: nil, OutTypes: touts, Const: true}
+}
+
+func untypedMinMaxRank(kind untyped.Kind) int {
+	switch kind {
+	case untyped.Rune:
+		return 1
+	case untyped.Float:
+		return 2
+	}
+	return 0
+}
+
+// we can use whatever signature we want, as long as call_builtin supports it
+func callMin(call *Call) I {
+	return callMinMax(call, false)
+}
+
+func callMax(call *Call) I {
+	return callMinMax(call, true)
+}
+
+// callMinMax returns a specialized closure that computes min() or max() of call.Args
+func callMinMax(call *Call, max bool) I {
+	args := call.Args
+	argfuns := make([]I, len(args))
+	for i, arg := range args {
+		argfuns[i] = arg.WithFun()
+	}
+	var ret I
+	switch call.OutTypes[0].Kind() {
+	case xr.Int:
+		ret = minMaxInt(argfuns, max)
+	case xr.Int8:
+		ret = minMaxInt8(argfuns, max)
+	case xr.Int16:
+		ret = minMaxInt16(argfuns, max)
+	case xr.Int32:
+		ret = minMaxInt32(argfuns, max)
+	case xr.Int64:
+		ret = minMaxInt64(argfuns, max)
+	case xr.Uint:
+		ret = minMaxUint(argfuns, max)
+	case xr.Uint8:
+		ret = minMaxUint8(argfuns, max)
+	case xr.Uint16:
+		ret = minMaxUint16(argfuns, max)
+	case xr.Uint32:
+		ret = minMaxUint32(argfuns, max)
+	case xr.Uint64:
+		ret = minMaxUint64(argfuns, max)
+	case xr.Uintptr:
+		ret = minMaxUintptr(argfuns, max)
+	case xr.Float32:
+		ret = minMaxFloat32(argfuns, max)
+	case xr.Float64:
+		ret = minMaxFloat64(argfuns, max)
+	case xr.String:
+		ret = minMaxString(argfuns, max)
+	default:
+		output.Errorf("unimplemented min() or max() for type %v", call.OutTypes[0])
+	}
+	return ret
+}
+
+func minMaxInt(argfuns []I, max bool) I {
+	funs := make([]func(*Env) int, len(argfuns))
+	for i, argfun := range argfuns {
+		funs[i] = argfun.(func(*Env) int)
+	}
+	if max {
+		return func(env *Env) int {
+			x := funs[0](env)
+			for _, fun := range funs[1:] {
+				if y := fun(env); y > x {
+					x = y
+				}
+			}
+			return x
+		}
+	}
+	return func(env *Env) int {
+		x := funs[0](env)
+		for _, fun := range funs[1:] {
+			if y := fun(env); y < x {
+				x = y
+			}
+		}
+		return x
+	}
+}
+
+func minMaxInt8(argfuns []I, max bool) I {
+	funs := make([]func(*Env) int8, len(argfuns))
+	for i, argfun := range argfuns {
+		funs[i] = argfun.(func(*Env) int8)
+	}
+	if max {
+		return func(env *Env) int8 {
+			x := funs[0](env)
+			for _, fun := range funs[1:] {
+				if y := fun(env); y > x {
+					x = y
+				}
+			}
+			return x
+		}
+	}
+	return func(env *Env) int8 {
+		x := funs[0](env)
+		for _, fun := range funs[1:] {
+			if y := fun(env); y < x {
+				x = y
+			}
+		}
+		return x
+	}
+}
+
+func minMaxInt16(argfuns []I, max bool) I {
+	funs := make([]func(*Env) int16, len(argfuns))
+	for i, argfun := range argfuns {
+		funs[i] = argfun.(func(*Env) int16)
+	}
+	if max {
+		return func(env *Env) int16 {
+			x := funs[0](env)
+			for _, fun := range funs[1:] {
+				if y := fun(env); y > x {
+					x = y
+				}
+			}
+			return x
+		}
+	}
+	return func(env *Env) int16 {
+		x := funs[0](env)
+		for _, fun := range funs[1:] {
+			if y := fun(env); y < x {
+				x = y
+			}
+		}
+		return x
+	}
+}
+
+func minMaxInt32(argfuns []I, max bool) I {
+	funs := make([]func(*Env) int32, len(argfuns))
+	for i, argfun := range argfuns {
+		funs[i] = argfun.(func(*Env) int32)
+	}
+	if max {
+		return func(env *Env) int32 {
+			x := funs[0](env)
+			for _, fun := range funs[1:] {
+				if y := fun(env); y > x {
+					x = y
+				}
+			}
+			return x
+		}
+	}
+	return func(env *Env) int32 {
+		x := funs[0](env)
+		for _, fun := range funs[1:] {
+			if y := fun(env); y < x {
+				x = y
+			}
+		}
+		return x
+	}
+}
+
+func minMaxInt64(argfuns []I, max bool) I {
+	funs := make([]func(*Env) int64, len(argfuns))
+	for i, argfun := range argfuns {
+		funs[i] = argfun.(func(*Env) int64)
+	}
+	if max {
+		return func(env *Env) int64 {
+			x := funs[0](env)
+			for _, fun := range funs[1:] {
+				if y := fun(env); y > x {
+					x = y
+				}
+			}
+			return x
+		}
+	}
+	return func(env *Env) int64 {
+		x := funs[0](env)
+		for _, fun := range funs[1:] {
+			if y := fun(env); y < x {
+				x = y
+			}
+		}
+		return x
+	}
+}
+
+func minMaxUint(argfuns []I, max bool) I {
+	funs := make([]func(*Env) uint, len(argfuns))
+	for i, argfun := range argfuns {
+		funs[i] = argfun.(func(*Env) uint)
+	}
+	if max {
+		return func(env *Env) uint {
+			x := funs[0](env)
+			for _, fun := range funs[1:] {
+				if y := fun(env); y > x {
+					x = y
+				}
+			}
+			return x
+		}
+	}
+	return func(env *Env) uint {
+		x := funs[0](env)
+		for _, fun := range funs[1:] {
+			if y := fun(env); y < x {
+				x = y
+			}
+		}
+		return x
+	}
+}
+
+func minMaxUint8(argfuns []I, max bool) I {
+	funs := make([]func(*Env) uint8, len(argfuns))
+	for i, argfun := range argfuns {
+		funs[i] = argfun.(func(*Env) uint8)
+	}
+	if max {
+		return func(env *Env) uint8 {
+			x := funs[0](env)
+			for _, fun := range funs[1:] {
+				if y := fun(env); y > x {
+					x = y
+				}
+			}
+			return x
+		}
+	}
+	return func(env *Env) uint8 {
+		x := funs[0](env)
+		for _, fun := range funs[1:] {
+			if y := fun(env); y < x {
+				x = y
+			}
+		}
+		return x
+	}
+}
+
+func minMaxUint16(argfuns []I, max bool) I {
+	funs := make([]func(*Env) uint16, len(argfuns))
+	for i, argfun := range argfuns {
+		funs[i] = argfun.(func(*Env) uint16)
+	}
+	if max {
+		return func(env *Env) uint16 {
+			x := funs[0](env)
+			for _, fun := range funs[1:] {
+				if y := fun(env); y > x {
+					x = y
+				}
+			}
+			return x
+		}
+	}
+	return func(env *Env) uint16 {
+		x := funs[0](env)
+		for _, fun := range funs[1:] {
+			if y := fun(env); y < x {
+				x = y
+			}
+		}
+		return x
+	}
+}
+
+func minMaxUint32(argfuns []I, max bool) I {
+	funs := make([]func(*Env) uint32, len(argfuns))
+	for i, argfun := range argfuns {
+		funs[i] = argfun.(func(*Env) uint32)
+	}
+	if max {
+		return func(env *Env) uint32 {
+			x := funs[0](env)
+			for _, fun := range funs[1:] {
+				if y := fun(env); y > x {
+					x = y
+				}
+			}
+			return x
+		}
+	}
+	return func(env *Env) uint32 {
+		x := funs[0](env)
+		for _, fun := range funs[1:] {
+			if y := fun(env); y < x {
+				x = y
+			}
+		}
+		return x
+	}
+}
+
+func minMaxUint64(argfuns []I, max bool) I {
+	funs := make([]func(*Env) uint64, len(argfuns))
+	for i, argfun := range argfuns {
+		funs[i] = argfun.(func(*Env) uint64)
+	}
+	if max {
+		return func(env *Env) uint64 {
+			x := funs[0](env)
+			for _, fun := range funs[1:] {
+				if y := fun(env); y > x {
+					x = y
+				}
+			}
+			return x
+		}
+	}
+	return func(env *Env) uint64 {
+		x := funs[0](env)
+		for _, fun := range funs[1:] {
+			if y := fun(env); y < x {
+				x = y
+			}
+		}
+		return x
+	}
+}
+
+func minMaxUintptr(argfuns []I, max bool) I {
+	funs := make([]func(*Env) uintptr, len(argfuns))
+	for i, argfun := range argfuns {
+		funs[i] = argfun.(func(*Env) uintptr)
+	}
+	if max {
+		return func(env *Env) uintptr {
+			x := funs[0](env)
+			for _, fun := range funs[1:] {
+				if y := fun(env); y > x {
+					x = y
+				}
+			}
+			return x
+		}
+	}
+	return func(env *Env) uintptr {
+		x := funs[0](env)
+		for _, fun := range funs[1:] {
+			if y := fun(env); y < x {
+				x = y
+			}
+		}
+		return x
+	}
+}
+
+func minMaxFloat32(argfuns []I, max bool) I {
+	funs := make([]func(*Env) float32, len(argfuns))
+	for i, argfun := range argfuns {
+		funs[i] = argfun.(func(*Env) float32)
+	}
+	if max {
+		return func(env *Env) float32 {
+			x := funs[0](env)
+			for _, fun := range funs[1:] {
+				x = maxFloat32(x, fun(env))
+			}
+			return x
+		}
+	}
+	return func(env *Env) float32 {
+		x := funs[0](env)
+		for _, fun := range funs[1:] {
+			x = minFloat32(x, fun(env))
+		}
+		return x
+	}
+}
+
+func minMaxFloat64(argfuns []I, max bool) I {
+	funs := make([]func(*Env) float64, len(argfuns))
+	for i, argfun := range argfuns {
+		funs[i] = argfun.(func(*Env) float64)
+	}
+	if max {
+		return func(env *Env) float64 {
+			x := funs[0](env)
+			for _, fun := range funs[1:] {
+				x = maxFloat64(x, fun(env))
+			}
+			return x
+		}
+	}
+	return func(env *Env) float64 {
+		x := funs[0](env)
+		for _, fun := range funs[1:] {
+			x = minFloat64(x, fun(env))
+		}
+		return x
+	}
+}
+
+func minMaxString(argfuns []I, max bool) I {
+	funs := make([]func(*Env) string, len(argfuns))
+	for i, argfun := range argfuns {
+		funs[i] = argfun.(func(*Env) string)
+	}
+	if max {
+		return func(env *Env) string {
+			x := funs[0](env)
+			for _, fun := range funs[1:] {
+				if y := fun(env); y > x {
+					x = y
+				}
+			}
+			return x
+		}
+	}
+	return func(env *Env) string {
+		x := funs[0](env)
+		for _, fun := range funs[1:] {
+			if y := fun(env); y < x {
+				x = y
+			}
+		}
+		return x
+	}
+}
+
+// minFloat32 follows Go semantics: if any argument is a NaN, the result is a NaN,
+// and negative zero is less than positive zero
+func minFloat32(x, y float32) float32 {
+	switch {
+	case x != x || y != y:
+		return float32(math.NaN())
+	case x < y:
+		return x
+	case y < x:
+		return y
+	case math.Signbit(float64(x)):
+		return x
+	}
+	return y
+}
+
+// maxFloat32 follows Go semantics: if any argument is a NaN, the result is a NaN,
+// and positive zero is greater than negative zero
+func maxFloat32(x, y float32) float32 {
+	switch {
+	case x != x || y != y:
+		return float32(math.NaN())
+	case x > y:
+		return x
+	case y > x:
+		return y
+	case math.Signbit(float64(x)):
+		return y
+	}
+	return x
+}
+
+// minFloat64 follows Go semantics: if any argument is a NaN, the result is a NaN,
+// and negative zero is less than positive zero
+func minFloat64(x, y float64) float64 {
+	switch {
+	case x != x || y != y:
+		return float64(math.NaN())
+	case x < y:
+		return x
+	case y < x:
+		return y
+	case math.Signbit(x):
+		return x
+	}
+	return y
+}
+
+// maxFloat64 follows Go semantics: if any argument is a NaN, the result is a NaN,
+// and positive zero is greater than negative zero
+func maxFloat64(x, y float64) float64 {
+	switch {
+	case x != x || y != y:
+		return float64(math.NaN())
+	case x > y:
+		return x
+	case y > x:
+		return y
+	case math.Signbit(x):
+		return y
+	}
+	return x
+}
@@ -107,7 +107,7 @@ func (c *Comp) prepareCall(node *ast.CallExpr, fun *Expr) *Call {
 	switch t.Kind() {
 	case xr.Func:
 	case xr.Ptr:
-		if (GENERICS_V1_CXX() || GENERICS_V2_CTI()) && t.ReflectType() == rtypeOfPtrGenericFunc {
+		if t.ReflectType() == rtypeOfPtrGenericFunc {
 			fun = c.inferGenericFunc(node, fun, args)
 			t = fun.Type
 			break
@@ -118,6 +118,9 @@ func (c *Comp) prepareCall(node *ast.CallExpr, fun *Expr) *Call {
 		return nil
 	}
 	ellipsis := node.Ellipsis != token.NoPos
+	if fun.compiledPkg != "" {
+		c.methodProxyCallArgs(fun.compiledPkg, t, args, ellipsis)
+	}
 	c.checkCallArgs(node, t, args, ellipsis)
 
 	outn := t.NumOut()
@@ -18,14 +18,20 @@ package fast
 
 import (
 	"errors"
+	"go/ast"
+	"go/token"
 	"io"
+	r "reflect"
 	"sort"
 	"strings"
 
 	"github.com/WilliamNHarvey/gomacro/base/paths"
 
+	"github.com/WilliamNHarvey/gomacro/ast2"
 	"github.com/WilliamNHarvey/gomacro/base"
 	bstrings "github.com/WilliamNHarvey/gomacro/base/strings"
+	"github.com/WilliamNHarvey/gomacro/go/etoken"
+	xr "github.com/WilliamNHarvey/gomacro/xreflect"
 )
 
 // ====================== Cmd ==============================
@@ -37,7 +43,7 @@ import (
 // note that Interp.Eval() does **not** look for special commands!
 //
 // Cmd.Name is the command name **without** the initial ':'
-//   it must be a valid Go identifier and must not be empty.
+//   it must be a valid Go identifier, optionally with '-' between words, and must not be empty.
 //   Using a reserved Go keyword (const, for, func, if, package, return, switch, type, var...)
 //   or predefined identifier (bool, int, rune, true, false, nil...)
 //   is a bad idea because it interferes with gomacro preprocessor mode.
@@ -105,11 +111,14 @@ type Cmds struct {
 
 // search for a Cmd whose name starts with prefix.
 // return (zero value, io.EOF) if no match.
-// return (cmd, nil) if exactly one match.
+// return (cmd, nil) if exactly one match, or if prefix is exactly the name of a Cmd.
 // return (zero value, list of match names) if more than one match
 func (cmds Cmds) Lookup(prefix string) (Cmd, error) {
 	if len(prefix) != 0 {
 		if vec, ok := cmds.m[prefix[0]]; ok {
+			if i, ok := binarySearch(vec, prefix); ok {
+				return vec[i], nil
+			}
 			i, err := prefixSearch(vec, prefix)
 			if err != nil {
 				return Cmd{}, err
@@ -270,15 +279,25 @@ var Commands Cmds
 
 func init() {
 	Commands.m = map[byte][]Cmd{
+		'a': []Cmd{{"ast", (*Interp).cmdAst, `ast EXPR          show the syntax tree of EXPR, without expanding macros`}},
 		'c': []Cmd{{"copyright", (*Interp).cmdCopyright, `copyright         show copyright and license`}},
 		'd': []Cmd{{"debug", (*Interp).cmdDebug, `debug EXPR        debug expression or statement interactively`}},
 		'e': []Cmd{{"env", (*Interp).cmdEnv, `env [NAME]        show available functions, variables and constants
                    in current package, or from imported package NAME`}},
 		'h': []Cmd{{"help", (*Interp).cmdHelp, `help              show this help`}},
 		'i': []Cmd{{"inspect", (*Interp).cmdInspect, `inspect EXPR|TYPE inspect expression or type interactively`}},
+		'm': []Cmd{
+			{"macroexpand", (*Interp).cmdMacroExpand, `macroexpand FORM  expand the macro call FORM repeatedly, until it is no longer a macro call`},
+			{"macroexpand1", (*Interp).cmdMacroExpand1, `macroexpand1 FORM expand the macro call FORM once`},
+		},
 		'o': []Cmd{{"options", (*Interp).cmdOptions, `options [OPTS]    show or toggle interpreter options`}},
 		'p': []Cmd{{"package", (*Interp).cmdPackage, `package "PKGPATH" switch to package PKGPATH, importing it if possible`}},
 		'q': []Cmd{{"quit", (*Interp).cmdQuit, `quit              quit the interpreter`}},
+		'r': []Cmd{
+			{"reload-profile", (*Interp).cmdReloadProfile, `reload-profile    evaluate again the startup files ~/.gomacrorc and .gomacro`},
+			{"results", (*Interp).cmdResults, `results           show the last results, bound to _1 (the most recent), _2 ...`},
+		},
+		't': []Cmd{{"type", (*Interp).cmdType, `type EXPR|TYPE    compile EXPR without evaluating it and show its type`}},
 		'u': []Cmd{{"unload", (*Interp).cmdUnload, `unload "PKGPATH"  remove package PKGPATH from the list of known packages.
                    later attempts to import it will trigger a recompile`}},
 		'w': []Cmd{{"write", (*Interp).cmdWrite, `write [FILE]      write collected declarations and/or statements to standard output or to FILE
@@ -318,6 +337,54 @@ func (ir *Interp) Cmd(src string) (string, base.CmdOpt) {
 	return src, opt
 }
 
+// show the syntax tree of arg, without expanding macros
+func (ir *Interp) cmdAst(arg string, opt base.CmdOpt) (string, base.CmdOpt) {
+	c := ir.Comp
+	g := &c.Globals
+	if len(strings.TrimSpace(arg)) == 0 {
+		g.Fprintf(g.Stdout, "// ast: missing argument\n")
+		return "", opt
+	}
+	var buf strings.Builder
+	writeAst(&buf, c.parseForms(arg), 0)
+	g.Fprintf(g.Stdout, "%s", buf.String())
+	return "", opt
+}
+
+// parseForms parses src without expanding macros.
+// Returns a single Ast if src contains exactly one declaration, statement or expression
+func (c *Comp) parseForms(src string) ast2.Ast {
+	nodes := c.ParseBytes([]byte(src))
+	if len(nodes) == 1 {
+		return ast2.ToAst(nodes[0])
+	}
+	return ast2.NodeSlice{X: nodes}
+}
+
+// writeAst writes form and its children to out, one per line, indented by depth
+func writeAst(out *strings.Builder, form ast2.Ast, depth int) {
+	out.WriteString(strings.Repeat("  ", depth))
+	if form == nil || form.Interface() == nil {
+		out.WriteString("nil\n")
+		return
+	}
+	out.WriteString(r.TypeOf(form).Name())
+	switch node := form.Interface().(type) {
+	case *ast.Ident:
+		out.WriteString(" " + node.Name)
+	case *ast.BasicLit:
+		out.WriteString(" " + node.Value)
+	case ast.Node:
+		if op := form.Op(); op != token.ILLEGAL {
+			out.WriteString(" " + etoken.String(op))
+		}
+	}
+	out.WriteByte('\n')
+	for i, n := 0, form.Size(); i < n; i++ {
+		writeAst(out, form.Get(i), depth+1)
+	}
+}
+
 func (ir *Interp) cmdDebug(arg string, opt base.CmdOpt) (string, base.CmdOpt) {
 	g := &ir.Comp.Globals
 	if len(arg) == 0 {
@@ -357,6 +424,45 @@ func (ir *Interp) cmdInspect(arg string, opt base.CmdOpt) (string, base.CmdOpt)
 	return "", opt
 }
 
+func (ir *Interp) cmdMacroExpand(arg string, opt base.CmdOpt) (string, base.CmdOpt) {
+	ir.macroExpandCmd("macroexpand", arg, false)
+	return "", opt
+}
+
+func (ir *Interp) cmdMacroExpand1(arg string, opt base.CmdOpt) (string, base.CmdOpt) {
+	ir.macroExpandCmd("macroexpand1", arg, true)
+	return "", opt
+}
+
+// show the macroexpansion of arg: once if onlyOnce is true, otherwise
+// repeatedly until it is no longer a macro call.
+// Macro calls nested inside arg are not expanded
+func (ir *Interp) macroExpandCmd(name string, arg string, onlyOnce bool) {
+	c := ir.Comp
+	g := &c.Globals
+	if len(strings.TrimSpace(arg)) == 0 {
+		g.Fprintf(g.Stdout, "// %s: missing argument\n", name)
+		return
+	}
+	form := c.parseForms(arg)
+	var expanded bool
+	if onlyOnce {
+		form, expanded = c.MacroExpand1(form)
+	} else {
+		form, expanded = c.MacroExpand(form)
+	}
+	if list, ok := form.(ast2.AstWithSlice); ok {
+		for i, n := 0, list.Size(); i < n; i++ {
+			g.Fprintf(g.Stdout, "%v\n", list.Get(i).Interface())
+		}
+	} else if form != nil {
+		g.Fprintf(g.Stdout, "%v\n", form.Interface())
+	}
+	if !expanded {
+		g.Fprintf(g.Stdout, "// not a macro call\n")
+	}
+}
+
 func (ir *Interp) cmdOptions(arg string, opt base.CmdOpt) (string, base.CmdOpt) {
 	c := ir.Comp
 	g := &c.Globals
@@ -389,7 +495,7 @@ func (ir *Interp) cmdPackage(path string, cmdopt base.CmdOpt) (string, base.CmdO
 	n := len(path)
 	if len(path) == 0 {
 		g.Fprintf(g.Stdout, "// current package: %s %q\n", c.Name, c.Path)
-	} else if n > 2 && path[0] == '"' && path[n-1] == '"' {
+	} else if n > 2 && path[0] == '"' && path[n-1] == '"' && ir.allowPackageCommands() {
 		path = path[1 : n-1]
 		ir.ChangePackage(PackageName(paths.FileName(path)), path)
 	} else if g.Options&base.OptShowPrompt != 0 {
@@ -402,9 +508,116 @@ func (ir *Interp) cmdQuit(_ string, opt base.CmdOpt) (string, base.CmdOpt) {
 	return "", opt | base.CmdOptQuit
 }
 
+// evaluate again the files loaded by Interp.LoadProfile()
+func (ir *Interp) cmdReloadProfile(_ string, opt base.CmdOpt) (string, base.CmdOpt) {
+	g := &ir.Comp.Globals
+	files := ir.Profile()
+	if len(files) == 0 {
+		g.Fprintf(g.Stdout, "// reload-profile: no profile loaded\n")
+	} else if err := ir.loadProfile(false); err != nil {
+		g.Warnf("reload-profile: %v", err)
+	} else if g.Options&base.OptShowPrompt != 0 {
+		g.Fprintf(g.Stdout, "// reloaded %s\n", strings.Join(files, " "))
+	}
+	return "", opt
+}
+
+// compile arg without evaluating it, and show its type
+func (ir *Interp) cmdType(arg string, opt base.CmdOpt) (string, base.CmdOpt) {
+	c := ir.Comp
+	g := &c.Globals
+	if len(strings.TrimSpace(arg)) == 0 {
+		g.Fprintf(g.Stdout, "// type: missing argument\n")
+		return "", opt
+	}
+	expr := c.parseTypeOrExpr(arg)
+	e, t := c.compileOnly(expr, true)
+	g.Fprintf(g.Stdout, "%s\n", describeType(e, t))
+	return "", opt
+}
+
+// parseTypeOrExpr parses and macroexpands src, which must be an expression or a type.
+// Types as []T, map[K]V or struct{...} are not valid statements:
+// if parsing src fails, retry parsing it as the type of a variable declaration
+func (c *Comp) parseTypeOrExpr(src string) ast.Expr {
+	expr, err := c.tryParseExpr(src)
+	if err != nil {
+		if expr, _ = c.tryParseExpr("var _ " + src); expr != nil {
+			return expr
+		}
+		panic(err)
+	} else if expr == nil {
+		c.Errorf("expecting an expression or a type, found: %s", strings.TrimSpace(src))
+	}
+	return expr
+}
+
+// tryParseExpr parses and macroexpands src, and returns the expression it contains,
+// or the type of the variable it declares. Returns the parse error, if any
+func (c *Comp) tryParseExpr(src string) (expr ast.Expr, err interface{}) {
+	defer func() {
+		if err = recover(); err != nil {
+			expr = nil
+		}
+	}()
+	form := c.Parse(src)
+	if list, ok := form.(ast2.AstWithSlice); ok && list.Size() == 1 {
+		form = list.Get(0)
+	}
+	node, ok := form.(ast2.AstWithNode)
+	if !ok {
+		return nil, nil
+	}
+	switch node := node.Node().(type) {
+	case ast.Expr:
+		expr = node
+	case *ast.ExprStmt:
+		expr = node.X
+	case *ast.DeclStmt:
+		expr = declaredType(node.Decl)
+	case ast.Decl:
+		expr = declaredType(node)
+	}
+	return expr, nil
+}
+
+// declaredType returns T if decl is 'var _ T', otherwise nil
+func declaredType(decl ast.Decl) ast.Expr {
+	if decl, ok := decl.(*ast.GenDecl); ok && decl.Tok == token.VAR && len(decl.Specs) == 1 {
+		if spec, ok := decl.Specs[0].(*ast.ValueSpec); ok && len(spec.Names) == 1 && spec.Names[0].Name == "_" && len(spec.Values) == 0 {
+			return spec.Type
+		}
+	}
+	return nil
+}
+
+// describeType returns the description of a compiled expression or type, as shown by :type
+func describeType(e *Expr, t xr.Type) string {
+	switch {
+	case e == nil:
+		return t.String() + "\t// type"
+	case e.IsNil():
+		return "untyped nil"
+	case e.Untyped():
+		return "untyped " + e.UntypedKind().String()
+	}
+	switch n := e.NumOut(); n {
+	case 0:
+		return "// no value"
+	case 1:
+		return e.Out(0).String()
+	default:
+		types := make([]string, n)
+		for i := range types {
+			types[i] = e.Out(i).String()
+		}
+		return "(" + strings.Join(types, ", ") + ")"
+	}
+}
+
 // remove package 'path' from the list of known packages
 func (ir *Interp) cmdUnload(path string, opt base.CmdOpt) (string, base.CmdOpt) {
-	if len(path) != 0 {
+	if len(path) != 0 && ir.allowPackageCommands() {
 		ir.Comp.UnloadPackage(path)
 	}
 	return "", opt
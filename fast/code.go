@@ -97,10 +97,34 @@ func popDefer(run *Run, deferOf *Env, isDefer bool) {
 	run.ExecFlags.SetDefer(isDefer)
 }
 
-func restore(run *Run, isDefer bool, interrupt Stmt, caller *Env) {
+// enterCompiledDefer prepares to execute the body of an interpreted function
+// deferred by compiled code, which recovered the panic rec:
+// the interpreted recover() will return rec
+func enterCompiledDefer(env *Env, rec interface{}) (run *Run, deferOf *Env, isDefer bool, rec_ interface{}) {
+	run = env.Run
+	deferOf, isDefer = run.DeferOfFun, run.ExecFlags.IsDefer()
+	run.Panic, run.PanicFun, run.DeferOfFun = rec, env, env
+	run.ExecFlags.SetStartDefer(true)
+	return run, deferOf, isDefer, rec
+}
+
+// exitCompiledDefer is the counterpart of enterCompiledDefer:
+// it panics again with rec, unless the interpreted recover() consumed it
+func exitCompiledDefer(run *Run, deferOf *Env, isDefer bool, rec interface{}) {
+	rec2 := recover() // a new panic raised by the function body, if any
+	recovered := run.PanicFun == nil
+	popDefer(run, deferOf, isDefer)
+	if rec2 != nil {
+		panic(rec2)
+	} else if !recovered {
+		panic(rec)
+	}
+}
+
+func restore(run *Run, isDefer bool, interrupt Stmt, caller *Env, panicking *bool) {
 	run.ExecFlags.SetDefer(isDefer)
 	run.Interrupt = interrupt
-	run.CurrEnv = caller
+	run.restoreCurrEnv(caller, panicking)
 	run.Signals.Sync = base.SigNone
 	if sig := run.Signals.Async; sig == base.SigInterrupt {
 		// do NOT handle async SigDebug here
@@ -129,16 +153,28 @@ func (run *Run) interrupt() {
 
 // Exec returns a func(*Env) that will execute the compiled code
 func (code *Code) Exec() func(*Env) {
+	all, pos, defers := code.finish()
+	if all == nil {
+		return nil
+	}
+	return execCode(all, pos, defers)
+}
+
+// finish returns the compiled code, terminated by spinInterrupt, then clears it
+func (code *Code) finish() ([]Stmt, []token.Pos, bool) {
 	all := code.List
 	pos := code.DebugPos
 	defers := code.WithDefers
 
 	code.Clear()
 	if len(all) == 0 {
-		return nil
+		return nil, nil, false
 	}
-	all = append(all, spinInterrupt)
+	return append(all, spinInterrupt), pos, defers
+}
 
+// execCode returns a function that will execute the given compiled code
+func execCode(all []Stmt, pos []token.Pos, defers bool) func(*Env) {
 	if defers {
 		// code to support defer is slower... isolate it in a separate function
 		return execWithFlags(all, pos)
@@ -257,8 +293,9 @@ func reExecWithFlags(env *Env, all []Stmt, pos []token.Pos, stmt Stmt, ip int) {
 		run.applyAsyncSignal(sig)
 	}
 	caller := run.CurrEnv
+	panicking, panicking2 := true, false
 	// restore g.IsDefer, g.Signal, g.DebugCallDepth, g.Interrupt and g.Caller on return
-	defer restore(run, run.ExecFlags.IsDefer(), run.Interrupt, caller)
+	defer restore(run, run.ExecFlags.IsDefer(), run.Interrupt, caller, &panicking)
 	ef.SetDefer(ef.StartDefer())
 	ef.SetStartDefer(false)
 	ef.SetDebug(run.Signals.Debug != base.SigNone)
@@ -268,7 +305,6 @@ func reExecWithFlags(env *Env, all []Stmt, pos []token.Pos, stmt Stmt, ip int) {
 	env.Code = all
 	env.DebugPos = pos
 
-	panicking, panicking2 := true, false
 	rundefer := func(fun func()) {
 		if panicking || panicking2 {
 			panicking = true
@@ -283,12 +319,62 @@ func reExecWithFlags(env *Env, all []Stmt, pos []token.Pos, stmt Stmt, ip int) {
 			panicking = maybeRepanic(run)
 		}
 	}
+	// directdefer runs after a compiled function deferred directly, which may have called recover()
+	directdefer := func() {
+		if rec := recover(); rec != nil {
+			// still panicking, or the compiled function panicked
+			panicking, panicking2 = true, false
+			panic(rec)
+		}
+		if panicking {
+			// the compiled function recovered the panic
+			panicking = false
+			run.Panic, run.PanicFun, run.PanicEnv = nil, nil, nil
+		}
+		panicking2 = false
+	}
 
 	if stmt == nil || !run.Signals.IsEmpty() {
 		goto signal
 	}
 again:
 	run.Interrupt = nil
+	if ef.IsBudget() {
+		// charge each statement to the Budget: slower than the unrolled loops below
+		for {
+			for stmt != nil && run.Signals.IsEmpty() {
+				if !run.spendStatement() {
+					break
+				}
+				stmt, env = stmt(env)
+			}
+			for run.Signals.Sync == base.SigDefer {
+				run.Signals.Sync = base.SigNone
+				fun, direct, arg := run.InstallDefer, run.DirectDefer, run.DeferArg
+				run.InstallDefer, run.DirectDefer, run.DeferArg = nil, nil, nil
+				if direct != nil {
+					defer directdefer()
+					// the deferred function must be the compiled one, see directDeferTypes
+					switch direct := direct.(type) {
+					case func(*error):
+						defer direct(arg.(*error))
+					case func(string):
+						defer direct(arg.(string))
+					case func(interface{}):
+						defer direct(arg)
+					default:
+						defer fun()
+					}
+				} else {
+					defer rundefer(fun)
+				}
+				stmt = env.Code[env.IP]
+			}
+			if stmt == nil || !run.Signals.IsEmpty() {
+				goto signal
+			}
+		}
+	}
 	for j := 0; j < 5; j++ {
 		if stmt, env = stmt(env); stmt != nil {
 			if stmt, env = stmt(env); stmt != nil {
@@ -323,9 +409,24 @@ again:
 		}
 		for run.Signals.Sync == base.SigDefer {
 			run.Signals.Sync = base.SigNone
-			fun := run.InstallDefer
-			run.InstallDefer = nil
-			defer rundefer(fun)
+			fun, direct, arg := run.InstallDefer, run.DirectDefer, run.DeferArg
+			run.InstallDefer, run.DirectDefer, run.DeferArg = nil, nil, nil
+			if direct != nil {
+				defer directdefer()
+				// the deferred function must be the compiled one, see directDeferTypes
+				switch direct := direct.(type) {
+				case func(*error):
+					defer direct(arg.(*error))
+				case func(string):
+					defer direct(arg.(string))
+				case func(interface{}):
+					defer direct(arg)
+				default:
+					defer fun()
+				}
+			} else {
+				defer rundefer(fun)
+			}
 			stmt = env.Code[env.IP]
 			if stmt == nil {
 				goto signal
@@ -357,9 +458,24 @@ again:
 
 		for run.Signals.Sync == base.SigDefer {
 			run.Signals.Sync = base.SigNone
-			fun := run.InstallDefer
-			run.InstallDefer = nil
-			defer rundefer(fun)
+			fun, direct, arg := run.InstallDefer, run.DirectDefer, run.DeferArg
+			run.InstallDefer, run.DirectDefer, run.DeferArg = nil, nil, nil
+			if direct != nil {
+				defer directdefer()
+				// the deferred function must be the compiled one, see directDeferTypes
+				switch direct := direct.(type) {
+				case func(*error):
+					defer direct(arg.(*error))
+				case func(string):
+					defer direct(arg.(string))
+				case func(interface{}):
+					defer direct(arg)
+				default:
+					defer fun()
+				}
+			} else {
+				defer rundefer(fun)
+			}
 			// single step
 			stmt = env.Code[env.IP]
 			stmt, env = stmt(env)
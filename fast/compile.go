@@ -442,6 +442,7 @@ func (c *Comp) compileNode(node ast.Node, kind dep.Kind) *Expr {
 	c.Loop = nil
 	c.Func = nil
 	c.Labels = nil
+	c.Gotos = nil
 	c.FuncMaker = nil
 	c.Pos = node.Pos()
 	switch node := node.(type) {
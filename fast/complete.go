@@ -0,0 +1,484 @@
+package fast
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"os"
+	"path/filepath"
+	r "reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/mod/semver"
+
+	"github.com/WilliamNHarvey/gomacro/base"
+	"github.com/WilliamNHarvey/gomacro/imports"
+	xr "github.com/WilliamNHarvey/gomacro/xreflect"
+)
+
+// Completion is a possible completion returned by Interp.Complete
+type Completion struct {
+	Name string // text to insert after head. Empty for hints that insert nothing, as function signatures
+	Hint string // type of the completed symbol, field or method, or name of the completed package
+}
+
+// Complete is the type-aware variant of CompleteWords: it returns the possible completions
+// of the text at position pos of line, each with a hint.
+//
+// After "expr." it compiles expr without executing it, and completes on the fields and methods
+// of its type, including the promoted ones, or on the contents of the package expr.
+// After "expr(" it returns the signature of the function expr as a single hint with empty Name.
+// Inside the path of an import declaration, it completes on the packages in imports.Packages
+// and in the Go module cache
+func (ir *Interp) Complete(line string, pos int) (head string, completions []Completion, tail string) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(ir.Comp.Stdout, "\npanic in Interp.Complete: %v\n", r)
+			head = ""
+			completions = nil
+			tail = ""
+		}
+	}()
+	if pos > len(line) {
+		pos = len(line)
+	}
+	head = line[:pos]
+	tail = line[pos:]
+	c := ir.Comp
+
+	if prefix, ok := importPathPrefix(head); ok {
+		return head[:len(head)-len(prefix)], c.completeImportPath(prefix), tail
+	}
+	if src := strings.TrimRightFunc(head, unicode.IsSpace); strings.HasSuffix(src, "(") {
+		src = src[:len(src)-1]
+		if hint := c.completeSignature(src[exprStart(src):]); hint != "" {
+			completions = []Completion{{Hint: hint}}
+		}
+		return head, completions, tail
+	}
+	word := TailIdentifier(head)
+	head = head[:len(head)-len(word)]
+	if src := strings.TrimRightFunc(head, unicode.IsSpace); strings.HasSuffix(src, ".") {
+		src = src[:len(src)-1]
+		completions = c.completeMembers(c.completeExpr(src[exprStart(src):]), word)
+	} else if len(word) != 0 {
+		completions = c.completeIdent(word)
+	}
+	return head, completions, tail
+}
+
+// completeType wraps a type name followed by '.' i.e. a method expression
+type completeType struct {
+	xr.Type
+}
+
+// completeExpr compiles src without executing it and returns its type,
+// or completeType if src is a type, or *Import if src is an imported package.
+// Returns nil if src does not compile
+func (c *Comp) completeExpr(src string) (node interface{}) {
+	expr := c.parseCompleteExpr(src)
+	if expr == nil {
+		return nil
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		if sym := c.TryResolve(ident.Name); sym != nil && sym.Const() {
+			if imp, ok := sym.Value.(*Import); ok {
+				return imp
+			}
+		}
+	}
+	defer func() {
+		if recover() != nil {
+			node = nil
+		}
+	}()
+	e, t := c.compileOnly(expr, false)
+	if t != nil {
+		return completeType{t}
+	} else if e == nil {
+		return nil
+	} else if e.Untyped() {
+		return e.DefaultType()
+	} else if e.Type != nil {
+		return e.Type
+	}
+	return nil
+}
+
+// compileOnly compiles an expression or a type in a new scope,
+// without importing packages, collecting declarations or printing the result.
+// If multi is false, the expression must be single-valued.
+// The returned expression must not be executed
+func (c *Comp) compileOnly(expr ast.Expr, multi bool) (e *Expr, t xr.Type) {
+	g := c.CompGlobals
+	const todisable = base.OptImportAuto | base.OptCollectDeclarations | base.OptCollectStatements | base.OptShowCompile
+	saved := g.Options
+	g.Options &^= todisable
+	defer func() {
+		g.Options = saved
+	}()
+	c = NewComp(c, nil)
+	if !multi {
+		return c.Expr1OrType(expr)
+	} else if t = c.tryType(expr); t != nil {
+		return nil, t
+	}
+	return c.Expr(expr, nil), nil
+}
+
+// tryType compiles a type. Returns nil if expr is not a type
+func (c *Comp) tryType(expr ast.Expr) (t xr.Type) {
+	defer func() {
+		if recover() != nil {
+			t = nil
+		}
+	}()
+	return c.Type(expr)
+}
+
+// parseCompleteExpr parses src, which must be a single expression. Macros are not expanded.
+// Returns nil on errors
+func (c *Comp) parseCompleteExpr(src string) (expr ast.Expr) {
+	if strings.TrimSpace(src) == "" {
+		return nil
+	}
+	defer func() {
+		if recover() != nil {
+			expr = nil
+		}
+	}()
+	nodes := c.ParseBytes([]byte(src))
+	if len(nodes) != 1 {
+		return nil
+	}
+	switch node := nodes[0].(type) {
+	case ast.Expr:
+		expr = node
+	case *ast.ExprStmt:
+		expr = node.X
+	}
+	return expr
+}
+
+// completeSignature returns the type of function src, or "" if src is not a function
+func (c *Comp) completeSignature(src string) string {
+	if t, ok := c.completeExpr(src).(xr.Type); ok && t.Kind() == r.Func {
+		return t.String()
+	}
+	return ""
+}
+
+// completeMembers returns the contents of package node, or the fields and methods
+// of type node, that start with prefix
+func (c *Comp) completeMembers(node interface{}, prefix string) []Completion {
+	switch obj := node.(type) {
+	case *Import:
+		var completions []Completion
+		other := obj.Path != c.FileComp().Path
+		for name, bind := range obj.Binds {
+			if strings.HasPrefix(name, prefix) && (!other || token.IsExported(name)) {
+				completions = append(completions, Completion{name, typeHint(bind.Type)})
+			}
+		}
+		for name := range obj.Types {
+			if strings.HasPrefix(name, prefix) && (!other || token.IsExported(name)) {
+				completions = append(completions, Completion{name, "type"})
+			}
+		}
+		return sortCompletions(completions)
+	case completeType:
+		return c.completeFieldsAndMethods(obj.Type, prefix, false)
+	case xr.Type:
+		return c.completeFieldsAndMethods(obj, prefix, true)
+	}
+	return nil
+}
+
+// completeIdent returns the symbols, types and keywords that start with word
+func (c *Comp) completeIdent(word string) []Completion {
+	var completions []Completion
+	for co := c; co != nil; co = co.Outer {
+		for name, bind := range co.Binds {
+			if !strings.HasPrefix(name, word) {
+				continue
+			}
+			hint := typeHint(bind.Type)
+			if imp, ok := bind.Value.(*Import); ok && bind.Const() {
+				hint = imp.Path
+			}
+			completions = append(completions, Completion{name, hint})
+		}
+		for name := range co.Types {
+			if strings.HasPrefix(name, word) {
+				completions = append(completions, Completion{name, "type"})
+			}
+		}
+	}
+	for _, name := range keywords {
+		if strings.HasPrefix(name, word) {
+			completions = append(completions, Completion{name, "keyword"})
+		}
+	}
+	return sortCompletions(completions)
+}
+
+// completeFieldsAndMethods returns the fields (if withFields) and methods of t
+// that start with prefix, including the promoted ones, and excluding
+// the unexported fields and methods of other packages
+func (c *Comp) completeFieldsAndMethods(t xr.Type, prefix string, withFields bool) []Completion {
+	if t.Kind() == r.Ptr && t.Elem().Kind() == r.Interface {
+		// pointer-to-interface has no methods
+		return nil
+	}
+	pkgpath := c.FileComp().Path
+	visible := func(name string, pkg *xr.Package) bool {
+		return strings.HasPrefix(name, prefix) &&
+			(token.IsExported(name) || pkg == nil || pkg.Path() == pkgpath)
+	}
+	seen := make(map[string]bool)
+	var completions []Completion
+
+	addMethods := func(typ xr.Type) {
+		if typ.Kind() == r.Ptr && typ.Elem().Kind() != r.Interface {
+			typ = typ.Elem()
+		}
+		for i, n := 0, typ.NumMethod(); i < n; i++ {
+			mtd := typ.Method(i)
+			if seen[mtd.Name] || !visible(mtd.Name, mtd.Pkg) {
+				continue
+			}
+			seen[mtd.Name] = true
+			// ambiguous selectors do not compile
+			if mtd, count := c.LookupMethod(t, mtd.Name); count == 1 {
+				tmtd := mtd.Type
+				if withFields && tmtd.IsMethod() {
+					// show the type of the method value, without receiver
+					tmtd = c.removeFirstParam(tmtd)
+				}
+				completions = append(completions, Completion{mtd.Name, typeHint(tmtd)})
+			}
+		}
+	}
+	addMethods(t)
+	tstruct := t
+	if tstruct.Kind() == r.Ptr {
+		tstruct = tstruct.Elem()
+	}
+	c.Universe.VisitFields(tstruct, func(field xr.StructField) {
+		if field.Anonymous {
+			addMethods(field.Type)
+		}
+		if !withFields || seen[field.Name] || !visible(field.Name, field.Pkg) {
+			return
+		}
+		seen[field.Name] = true
+		if field, count := c.LookupField(tstruct, field.Name); count == 1 {
+			completions = append(completions, Completion{field.Name, typeHint(field.Type)})
+		}
+	})
+	return sortCompletions(completions)
+}
+
+func typeHint(t xr.Type) string {
+	if t == nil {
+		return ""
+	}
+	return t.String()
+}
+
+// importPathRe matches an import declaration up to a partial, quoted path
+var importPathRe = regexp.MustCompile(`(?:^|[^\w.])import\s*(?:\(\s*)?(?:[\pL_][\pL\pN_]*\s+|\.\s*)?"([^"\s]*)$`)
+
+// importPathPrefix returns the partial path at the end of head,
+// if head ends inside the path of an import declaration
+func importPathPrefix(head string) (string, bool) {
+	match := importPathRe.FindStringSubmatch(head)
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// completeImportPath returns the packages in imports.Packages and the directories
+// in the Go module cache whose path starts with prefix
+func (c *Comp) completeImportPath(prefix string) []Completion {
+	sb := c.CompGlobals.sandbox
+	var completions []Completion
+	for path, pkg := range imports.Packages {
+		if strings.HasPrefix(path, prefix) && !isInternalPath(path) && (sb == nil || sb.allowImport(path)) {
+			completions = append(completions, Completion{path, string(pkg.DefaultName(path))})
+		}
+	}
+	if sb == nil {
+		// a sandbox could only import packages compiled into the interpreter
+		completions = append(completions, completeModCache(prefix)...)
+	}
+	return sortCompletions(completions)
+}
+
+// completeModCache returns the directories in the Go module cache
+// whose import path starts with prefix
+func completeModCache(prefix string) []Completion {
+	root := modCacheDir()
+	if root == "" {
+		return nil
+	}
+	dir, name := "", prefix
+	if i := strings.LastIndexByte(prefix, '/'); i >= 0 {
+		dir, name = prefix[:i+1], prefix[i+1:]
+	}
+	fsdir := root
+	if dir != "" {
+		for _, elem := range strings.Split(dir[:len(dir)-1], "/") {
+			if fsdir = modCacheLookup(fsdir, elem); fsdir == "" {
+				return nil
+			}
+		}
+	}
+	entries, err := os.ReadDir(fsdir)
+	if err != nil {
+		return nil
+	}
+	var completions []Completion
+	for _, entry := range entries {
+		elem := entry.Name()
+		if i := strings.IndexByte(elem, '@'); i >= 0 {
+			elem = elem[:i]
+		}
+		elem = modCacheDecode(elem)
+		if !entry.IsDir() || !strings.HasPrefix(elem, name) || elem == "testdata" ||
+			strings.HasPrefix(elem, ".") || strings.HasPrefix(elem, "_") ||
+			(dir == "" && elem == "cache") {
+			continue
+		}
+		completions = append(completions, Completion{dir + elem, ""})
+	}
+	return completions
+}
+
+// modCacheDir returns the Go module cache directory, or "" if not known
+func modCacheDir() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	if list := filepath.SplitList(build.Default.GOPATH); len(list) != 0 && list[0] != "" {
+		return filepath.Join(list[0], "pkg", "mod")
+	}
+	return ""
+}
+
+// modCacheLookup returns the subdirectory of fsdir for the import path element elem.
+// Module roots are stored as elem@version: the latest version is returned
+func modCacheLookup(fsdir string, elem string) string {
+	elem = modCacheEncode(elem)
+	sub := filepath.Join(fsdir, elem)
+	if info, err := os.Stat(sub); err == nil && info.IsDir() {
+		return sub
+	}
+	versions, _ := filepath.Glob(filepath.Join(fsdir, elem) + "@*")
+	if len(versions) == 0 {
+		return ""
+	}
+	// compare semantic versions: lexical order puts v1.9.0 after v1.10.0
+	latest, latestVersion := versions[0], modCacheVersion(versions[0])
+	for _, dir := range versions[1:] {
+		if version := modCacheVersion(dir); semver.Compare(version, latestVersion) > 0 {
+			latest, latestVersion = dir, version
+		}
+	}
+	return latest
+}
+
+// modCacheVersion returns the version of module root dir, stored as elem@version
+func modCacheVersion(dir string) string {
+	return modCacheDecode(dir[strings.LastIndexByte(dir, '@')+1:])
+}
+
+// modCacheEncode escapes uppercase letters as the Go module cache does: 'A' -> "!a"
+func modCacheEncode(s string) string {
+	var buf strings.Builder
+	for _, ch := range s {
+		if unicode.IsUpper(ch) {
+			buf.WriteByte('!')
+			ch = unicode.ToLower(ch)
+		}
+		buf.WriteRune(ch)
+	}
+	return buf.String()
+}
+
+// modCacheDecode is the inverse of modCacheEncode
+func modCacheDecode(s string) string {
+	if strings.IndexByte(s, '!') < 0 {
+		return s
+	}
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '!' && i+1 < len(s) {
+			i++
+			buf.WriteRune(unicode.ToUpper(rune(s[i])))
+		} else {
+			buf.WriteByte(s[i])
+		}
+	}
+	return buf.String()
+}
+
+// exprStart returns the position where the expression at the end of src starts:
+// it skips backward identifiers, dots, literals and balanced brackets
+func exprStart(src string) int {
+	depth := 0
+	i := len(src)
+	for i > 0 {
+		ch, size := utf8.DecodeLastRuneInString(src[:i])
+		switch ch {
+		case ')', ']', '}':
+			depth++
+		case '(', '[', '{':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		case '"', '\'', '`':
+			// skip backward to the opening quote
+			j := strings.LastIndexByte(src[:i-1], byte(ch))
+			for ch != '`' && j > 0 && src[j-1] == '\\' {
+				j = strings.LastIndexByte(src[:j], byte(ch))
+			}
+			if j < 0 {
+				return i
+			}
+			i = j
+			continue
+		default:
+			if depth == 0 && ch != '.' && ch != '_' && !unicode.IsLetter(ch) && !unicode.IsDigit(ch) {
+				return i
+			}
+		}
+		i -= size
+	}
+	return 0
+}
+
+// sortCompletions sorts completions by name and removes duplicates
+func sortCompletions(vec []Completion) []Completion {
+	if n := len(vec); n > 1 {
+		sort.SliceStable(vec, func(i, j int) bool {
+			return vec[i].Name < vec[j].Name
+		})
+		j := 1
+		for i := 1; i < n; i++ {
+			if vec[i].Name != vec[j-1].Name {
+				vec[j] = vec[i]
+				j++
+			}
+		}
+		vec = vec[:j]
+	}
+	return vec
+}
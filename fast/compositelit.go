@@ -65,6 +65,7 @@ func (c *Comp) compositeLitArray(t xr.Type, ellipsis bool, node *ast.CompositeLi
 	if n == 0 {
 		return exprX1(t, func(env *Env) xr.Value {
 			// array len is already encoded in its type
+			env.Run.allocate(t, 1)
 			return xr.New(t).Elem()
 		})
 	}
@@ -80,6 +81,7 @@ func (c *Comp) compositeLitArray(t xr.Type, ellipsis bool, node *ast.CompositeLi
 	zeroelem := xr.Zero(telem)
 
 	return exprX1(t, func(env *Env) xr.Value {
+		env.Run.allocate(t, 1)
 		obj := xr.New(t).Elem()
 		var val xr.Value
 		for i, funval := range funvals {
@@ -105,9 +107,11 @@ func (c *Comp) compositeLitSlice(t xr.Type, node *ast.CompositeLit) *Expr {
 	}
 	size, keys, funvals := c.compositeLitElements(t, false, node)
 
+	telem := t.Elem()
 	rtelem := rtype.Elem()
 	zeroelem := xr.ZeroR(rtelem)
 	return exprX1(t, func(env *Env) xr.Value {
+		env.Run.allocate(telem, size)
 		obj := xr.MakeSlice(t, size, size)
 		var val xr.Value
 		for i, funval := range funvals {
@@ -223,6 +227,7 @@ func (c *Comp) compositeLitMap(t xr.Type, node *ast.CompositeLit) *Expr {
 		}
 	}
 	return exprX1(t, func(env *Env) xr.Value {
+		env.Run.allocateMake(t, n)
 		obj := xr.MakeMap(t)
 		var key, val xr.Value
 		for i, funkey := range funkeys {
@@ -238,6 +243,7 @@ func (c *Comp) compositeLitStruct(t xr.Type, node *ast.CompositeLit) *Expr {
 	n := len(node.Elts)
 	if n == 0 {
 		return exprX1(t, func(env *Env) xr.Value {
+			env.Run.allocate(t, 1)
 			return xr.New(t).Elem()
 		})
 	}
@@ -313,6 +319,7 @@ func (c *Comp) compositeLitStruct(t xr.Type, node *ast.CompositeLit) *Expr {
 			label, t, nfield, n, plural)
 	}
 	return exprX1(t, func(env *Env) xr.Value {
+		env.Run.allocate(t, 1)
 		obj := xr.New(t).Elem()
 		var val, field xr.Value
 		var tfield r.Type
@@ -0,0 +1,168 @@
+package fast
+
+import (
+	"context"
+	"sync"
+
+	"github.com/WilliamNHarvey/gomacro/base"
+	xr "github.com/WilliamNHarvey/gomacro/xreflect"
+)
+
+// runGroup contains the Runs executing an evaluation started by Interp.RunExprContext()
+// or subject to a Budget, including the Runs of goroutines started by the evaluation
+// with "go" statements, and interrupts all of them when its context is done
+// or its budget is exhausted
+type runGroup struct {
+	ctx       context.Context
+	budget    *budgetState // nil if the evaluation has no Budget
+	lock      sync.Mutex
+	runs      map[*Run]struct{}
+	refs      int           // len(runs), plus one until the evaluation completes
+	done      chan struct{} // closed when refs becomes zero
+	cancelled bool
+	err       error // why the group was cancelled
+}
+
+// newRunGroup returns the runGroup for an evaluation,
+// or nil if ctx can never be cancelled and evaluations have no Budget
+func (ir *Interp) newRunGroup(ctx context.Context) *runGroup {
+	budget := ir.env.Run.budget
+	if ctx.Done() == nil && budget == (Budget{}) {
+		return nil
+	}
+	group := &runGroup{
+		ctx:  ctx,
+		runs: make(map[*Run]struct{}),
+		refs: 1,
+		done: make(chan struct{}),
+	}
+	if budget != (Budget{}) {
+		group.budget = newBudgetState(budget)
+	}
+	if ctx.Done() != nil {
+		go group.watch()
+	}
+	return group
+}
+
+// watch interrupts the group when its context is done.
+// returns early if all the Runs in the group completed
+func (group *runGroup) watch() {
+	select {
+	case <-group.ctx.Done():
+		group.cancel(group.ctx.Err())
+	case <-group.done:
+	}
+}
+
+// cancel interrupts all the Runs in the group.
+// err is the reason, and it is ignored if the group was already cancelled
+func (group *runGroup) cancel(err error) {
+	group.lock.Lock()
+	defer group.lock.Unlock()
+	if !group.cancelled {
+		group.cancelled = true
+		group.err = err
+	}
+	for run := range group.runs {
+		run.Signals.Async = base.SigInterrupt
+	}
+}
+
+func (group *runGroup) isCancelled() bool {
+	group.lock.Lock()
+	defer group.lock.Unlock()
+	return group.cancelled
+}
+
+// add run to the group. If the group is already cancelled, interrupts run
+func (group *runGroup) add(run *Run) {
+	group.lock.Lock()
+	defer group.lock.Unlock()
+	group.runs[run] = struct{}{}
+	group.refs++
+	run.group = group
+	if group.budget != nil {
+		run.ExecFlags.SetBudget(true)
+		run.stmtQuota = 0
+	}
+	if group.cancelled {
+		run.Signals.Async = base.SigInterrupt
+	}
+}
+
+func (group *runGroup) remove(run *Run) {
+	group.lock.Lock()
+	defer group.lock.Unlock()
+	delete(group.runs, run)
+	run.group = nil
+	run.ExecFlags.SetBudget(false)
+	run.stmtQuota = 0
+	group.unref()
+}
+
+// release is called when the evaluation completes
+func (group *runGroup) release() {
+	group.lock.Lock()
+	defer group.lock.Unlock()
+	group.unref()
+}
+
+func (group *runGroup) unref() {
+	group.refs--
+	if group.refs == 0 {
+		close(group.done)
+	}
+}
+
+// exit is deferred by goroutines started by the evaluation:
+// removes run from the group, and silently terminates the goroutine
+// if it was interrupted because the group was cancelled
+func (group *runGroup) exit(run *Run) {
+	group.remove(run)
+	if rec := recover(); rec != nil && (rec != base.SigInterrupt || !group.isCancelled()) {
+		panic(rec)
+	}
+}
+
+// RunExprContext is RunE that also interrupts the execution of e, and of the goroutines
+// it starts with "go" statements, when ctx is cancelled or its deadline passes:
+// in such case, returns ctx.Err(). If the evaluation exceeds its Budget, returns a *BudgetError.
+//
+// Interpreted code is interrupted only while it executes interpreted statements:
+// it cannot be interrupted while blocked inside compiled functions,
+// as time.Sleep(), or on channel operations
+func (ir *Interp) RunExprContext(ctx context.Context, e *Expr) ([]xr.Value, []xr.Type, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	var group *runGroup
+	if e != nil {
+		group = ir.newRunGroup(ctx)
+	}
+	if group != nil {
+		defer group.release()
+	}
+	return ir.runE(e, group)
+}
+
+// repanic is deferred by evaluations that panic on errors:
+// if the group interrupted the evaluation, panics with the reason
+func (group *runGroup) repanic() {
+	if rec := recover(); rec != nil {
+		if rec == base.SigInterrupt && group.isCancelled() {
+			rec = group.err
+		}
+		panic(rec)
+	}
+}
+
+// EvalContext is EvalE that also interrupts the execution when ctx is cancelled
+// or its deadline passes. See RunExprContext() for details
+func (ir *Interp) EvalContext(ctx context.Context, src string) ([]xr.Value, []xr.Type, error) {
+	expr, err := ir.CompileE(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ir.RunExprContext(ctx, expr)
+}
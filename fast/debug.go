@@ -86,6 +86,17 @@ func singleStep(env *Env) (Stmt, *Env) {
 		return stmt, env // resume normal execution
 	}
 
+	if run.DebugDepth == 0 && !run.breakpoints.watching() {
+		// single-stepping was only needed by watchpoints, now deleted
+		run.Signals.Debug = base.SigNone
+		run.ExecFlags.SetDebug(false)
+		return stmt, env
+	}
+	if env.CallDepth >= run.DebugDepth && env.IP == len(env.Code)-1 {
+		// end of code: spinInterrupt does not detect it while single-stepping
+		run.Signals.Sync = base.SigReturn
+		return run.Interrupt, env
+	}
 	if env.CallDepth < run.DebugDepth {
 		if run.Options&base.OptDebugDebugger != 0 {
 			run.Debugf("single-stepping: stmt = %p, env = %p, IP = %v, env.CallDepth = %d, g.DebugDepth = %d", stmt, env, env.IP, env.CallDepth, run.DebugDepth)
@@ -102,13 +113,36 @@ func singleStep(env *Env) (Stmt, *Env) {
 	}
 
 	// single step
+	stmtenv, ip := env, env.IP
 	stmt, env = stmt(env)
+	if run.breakpoints.watching() {
+		checkWatchpoints(stmtenv, ip, env)
+	}
 	if run.Signals.Debug != base.SigNone {
 		stmt = run.Interrupt
 	}
 	return stmt, env
 }
 
+// DebugInterp returns an Interp that compiles and executes code in the scope of env,
+// as the debugger does at breakpoints. Returns nil if env has no debugging information,
+// i.e. if it was not created with base.OptDebugger
+func (env *Env) DebugInterp() *Interp {
+	if env == nil || env.DebugComp == nil {
+		return nil
+	}
+	return &Interp{env.DebugComp, env}
+}
+
+// FuncEnv returns the Env of the function containing env,
+// or the outermost Env for top-level code
+func (env *Env) FuncEnv() *Env {
+	for env.Caller == nil && env.Outer != nil {
+		env = env.Outer
+	}
+	return env
+}
+
 func (ir *Interp) debug(breakpoint bool) base.Signal {
 	run := ir.env.Run
 	if run.Debugger == nil {
@@ -139,8 +173,13 @@ func (run *Run) applyDebugOp(op DebugOp) base.Signal {
 	if op.Depth > 0 {
 		sig = base.SigDebug
 	} else {
-		sig = base.SigNone
 		op.Depth = 0
+		if run.breakpoints.watching() {
+			// keep single-stepping to check watchpoints
+			sig = base.SigDebug
+		} else {
+			sig = base.SigNone
+		}
 	}
 	if run.Options&base.OptDebugDebugger != 0 {
 		if op == saveOp {
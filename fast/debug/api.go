@@ -31,7 +31,9 @@ var (
 
 type Debugger struct {
 	interp  *fast.Interp
-	env     *fast.Env
+	env     *fast.Env   // Env of selected frame
+	frames  []*fast.Env // Env of each stack frame, innermost first
+	frame   int         // selected frame
 	globals *base.Globals
 	lastcmd string
 }
@@ -51,6 +53,8 @@ func (d *Debugger) main(interp *fast.Interp, env *fast.Env, breakpoint bool) Deb
 	// without disturbing the code being debugged
 	d.interp = fast.NewInnerInterp(interp, "debug", "debug")
 	d.env = env
+	d.frames = stackFrames(env)
+	d.frame = 0
 	d.globals = &interp.Comp.Globals
 	if !d.Show(breakpoint) {
 		// skip synthetic statements
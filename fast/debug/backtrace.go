@@ -21,26 +21,26 @@ import (
 )
 
 func (d *Debugger) Backtrace(arg string) DebugOp {
-	env := d.env
-	var calls []*fast.Env
-	for env != nil {
-		if env.Caller != nil {
-			// function body
-			calls = append(calls, env)
-			env = env.Caller
-		} else {
-			// nested env
-			env = env.Outer
-		}
-	}
-	d.showFunctionCalls(calls)
+	d.showFrames(d.frames)
 	return DebugOpRepl
 }
 
-func (d *Debugger) showFunctionCalls(calls []*fast.Env) {
+// show stack frames, numbered as expected by command "frame N".
+// the selected frame is marked with '*'
+func (d *Debugger) showFrames(frames []*fast.Env) {
+	g := d.globals
 	// show outermost stack frame first
-	for i := len(calls) - 1; i >= 0; i-- {
-		d.showFunctionCall(calls[i])
+	for i := len(frames) - 1; i >= 0; i-- {
+		mark := ' '
+		if i == d.frame {
+			mark = '*'
+		}
+		g.Fprintf(g.Stdout, "%c#%d\t", mark, i)
+		if env := frames[i].FuncEnv(); env.Caller != nil {
+			d.showFunctionCall(env)
+		} else {
+			g.Fprintf(g.Stdout, "%p\t<toplevel>\n", env)
+		}
 	}
 }
 
@@ -66,3 +66,14 @@ func (d *Debugger) showFunctionCall(env *fast.Env) {
 		g.Fprintf(g.Stdout, "\n")
 	}
 }
+
+// stackFrames returns the Env of each stack frame, innermost first.
+// The Env of each frame is the innermost scope executing in the function
+func stackFrames(env *fast.Env) []*fast.Env {
+	var frames []*fast.Env
+	for env != nil {
+		frames = append(frames, env)
+		env = env.FuncEnv().Caller
+	}
+	return frames
+}
@@ -61,8 +61,11 @@ func (d *Debugger) showEnv(env *fast.Env) {
 	})
 	g := c.CompGlobals
 	for _, bind := range binds {
-		value := bind.RuntimeValue(g, env)
-		o.Fprintf(o.Stdout, "%s\t= %v\t// %v\n", bind.Name, value, bind.Type)
+		var ivalue interface{} = "nil"
+		if value := bind.RuntimeValue(g, env); value.IsValid() {
+			ivalue = value.ReflectValue()
+		}
+		o.Fprintf(o.Stdout, "%s\t= %v\t// %v\n", bind.Name, ivalue, bind.Type)
 	}
 }
 
@@ -80,9 +83,9 @@ func (d *Debugger) showBinds(env *fast.Env, binds []*fast.Bind) {
 
 func (d *Debugger) showBind(env *fast.Env, bind *fast.Bind) {
 	value := bind.RuntimeValue(d.interp.Comp.CompGlobals, env)
-	var ivalue interface{} = value
-	if !value.IsValid() {
-		ivalue = "nil"
+	var ivalue interface{} = "nil"
+	if value.IsValid() {
+		ivalue = value.ReflectValue()
 	}
 
 	g := d.globals
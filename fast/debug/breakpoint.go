@@ -0,0 +1,199 @@
+package debug
+
+import (
+	"go/token"
+	"strconv"
+	"strings"
+
+	"github.com/WilliamNHarvey/gomacro/base"
+	bstrings "github.com/WilliamNHarvey/gomacro/base/strings"
+	"github.com/WilliamNHarvey/gomacro/fast"
+)
+
+func (d *Debugger) cmdBreak(arg string) DebugOp {
+	g := d.globals
+	var cond string
+	if arg == "if" || strings.HasPrefix(arg, "if ") {
+		arg, cond = "", arg[2:]
+	} else if i := strings.Index(arg, " if "); i >= 0 {
+		arg, cond = strings.TrimSpace(arg[:i]), arg[i+4:]
+	}
+	var bp *fast.Breakpoint
+	if file, line, ok := d.parseLocation(arg); ok {
+		bp = d.interp.SetBreakpoint(file, line)
+	} else if arg != "" {
+		bp = d.interp.SetFuncBreakpoint(arg)
+	} else {
+		g.Fprintf(g.Stdout, "// break: unknown current position, please specify a location\n")
+		return DebugOpRepl
+	}
+	if cond = strings.TrimSpace(cond); cond != "" {
+		d.interp.SetBreakpointCondition(bp.ID, cond)
+	}
+	var pending string
+	if bp.Locations == 0 {
+		pending = " (pending)"
+	}
+	g.Fprintf(g.Stdout, "// breakpoint %d at %v%s\n", bp.ID, bp, pending)
+	return DebugOpRepl
+}
+
+func (d *Debugger) cmdCondition(arg string) DebugOp {
+	g := d.globals
+	s, cond := bstrings.Split2(strings.TrimSpace(arg), ' ')
+	id, err := strconv.Atoi(s)
+	if err != nil {
+		g.Fprintf(g.Stdout, "// condition: expecting breakpoint number, found: %q\n", s)
+	} else if !d.interp.SetBreakpointCondition(id, cond) {
+		g.Fprintf(g.Stdout, "// condition: no breakpoint number %d\n", id)
+	}
+	return DebugOpRepl
+}
+
+func (d *Debugger) cmdIgnore(arg string) DebugOp {
+	g := d.globals
+	args := strings.Fields(arg)
+	if len(args) != 2 {
+		g.Fprintf(g.Stdout, "// ignore: expecting breakpoint number and count\n")
+		return DebugOpRepl
+	}
+	id, err1 := strconv.Atoi(args[0])
+	count, err2 := strconv.Atoi(args[1])
+	if err1 != nil || err2 != nil || count < 0 {
+		g.Fprintf(g.Stdout, "// ignore: expecting breakpoint number and count, found: %s\n", arg)
+	} else if !d.interp.SetBreakpointIgnore(id, count) {
+		g.Fprintf(g.Stdout, "// ignore: no breakpoint number %d\n", id)
+	} else {
+		g.Fprintf(g.Stdout, "// will ignore next %d hits of breakpoint %d\n", count, id)
+	}
+	return DebugOpRepl
+}
+
+func (d *Debugger) cmdWatch(arg string) DebugOp {
+	g := d.globals
+	name := strings.TrimSpace(arg)
+	if name == "" {
+		g.Fprintf(g.Stdout, "// watch: missing argument\n")
+		return DebugOpRepl
+	}
+	w, err := d.interp.SetWatchpoint(name)
+	if err != nil {
+		g.Fprintf(g.Stdout, "// watch: %v\n", err)
+	} else {
+		g.Fprintf(g.Stdout, "// watchpoint %d: %s = %s\n", w.ID, w.Name, w.Value)
+	}
+	return DebugOpRepl
+}
+
+func (d *Debugger) cmdDelete(arg string) DebugOp {
+	d.forBreakpoints("delete", arg, func(id int) bool {
+		return d.interp.DeleteBreakpoint(id)
+	})
+	return DebugOpRepl
+}
+
+func (d *Debugger) cmdDisable(arg string) DebugOp {
+	d.forBreakpoints("disable", arg, func(id int) bool {
+		return d.interp.EnableBreakpoint(id, false)
+	})
+	return DebugOpRepl
+}
+
+func (d *Debugger) cmdEnable(arg string) DebugOp {
+	d.forBreakpoints("enable", arg, func(id int) bool {
+		return d.interp.EnableBreakpoint(id, true)
+	})
+	return DebugOpRepl
+}
+
+func (d *Debugger) cmdInfo(arg string) DebugOp {
+	g := d.globals
+	if arg == "" || !strings.HasPrefix("breakpoints", arg) {
+		g.Fprintf(g.Stdout, "// info: expecting \"info breakpoints\"\n")
+		return DebugOpRepl
+	}
+	bps := d.interp.Breakpoints()
+	ws := d.interp.Watchpoints()
+	if len(bps) == 0 && len(ws) == 0 {
+		g.Fprintf(g.Stdout, "// no breakpoints\n")
+		return DebugOpRepl
+	}
+	for _, bp := range bps {
+		var pending string
+		if bp.Locations == 0 {
+			pending = " (pending)"
+		}
+		g.Fprintf(g.Stdout, "%d\t%s %v%s\n", bp.ID, enabledString(bp.Enabled), &bp, pending)
+		if bp.Cond != "" {
+			g.Fprintf(g.Stdout, "\tstop only if %s\n", bp.Cond)
+		}
+		showHits(g, bp.Hits, bp.Ignore)
+	}
+	for _, w := range ws {
+		g.Fprintf(g.Stdout, "%d\t%s %v = %s\n", w.ID, enabledString(w.Enabled), &w, w.Value)
+		showHits(g, w.Hits, w.Ignore)
+	}
+	return DebugOpRepl
+}
+
+func enabledString(enabled bool) string {
+	if enabled {
+		return "enabled "
+	}
+	return "disabled"
+}
+
+func showHits(g *base.Globals, hits int, ignore int) {
+	if hits != 0 {
+		g.Fprintf(g.Stdout, "\thit %d times\n", hits)
+	}
+	if ignore != 0 {
+		g.Fprintf(g.Stdout, "\tignore next %d hits\n", ignore)
+	}
+}
+
+// parseLocation parses FILE:LINE or LINE. If arg is empty, returns the current position
+func (d *Debugger) parseLocation(arg string) (file string, line int, ok bool) {
+	if arg == "" {
+		pos := d.currentPosition()
+		return pos.Filename, pos.Line, pos.Line > 0
+	}
+	if i := strings.LastIndexByte(arg, ':'); i > 0 {
+		if line, err := strconv.Atoi(arg[i+1:]); err == nil {
+			return arg[:i], line, true
+		}
+	} else if line, err := strconv.Atoi(arg); err == nil {
+		return d.currentPosition().Filename, line, true
+	}
+	return "", 0, false
+}
+
+func (d *Debugger) currentPosition() token.Position {
+	env := d.env
+	g := d.globals
+	if ip := env.IP; ip < len(env.DebugPos) && g.Fileset != nil {
+		return g.Fileset.Position(env.DebugPos[ip])
+	}
+	return token.Position{}
+}
+
+// forBreakpoints executes fun on the breakpoints listed in arg,
+// or on all breakpoints and watchpoints if arg is empty
+func (d *Debugger) forBreakpoints(cmd string, arg string, fun func(id int) bool) {
+	g := d.globals
+	if arg == "" {
+		for _, bp := range d.interp.Breakpoints() {
+			fun(bp.ID)
+		}
+		for _, w := range d.interp.Watchpoints() {
+			fun(w.ID)
+		}
+		return
+	}
+	for _, s := range strings.Fields(arg) {
+		id, err := strconv.Atoi(s)
+		if err != nil || !fun(id) {
+			g.Fprintf(g.Stdout, "// %s: no breakpoint number %s\n", cmd, s)
+		}
+	}
+}
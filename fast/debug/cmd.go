@@ -28,7 +28,9 @@ type Cmd struct {
 	Func func(d *Debugger, arg string) DebugOp
 }
 
-type Cmds map[byte]Cmd
+// commands sharing the same first letter are listed in order of preference:
+// the first one is chosen if the abbreviation is ambiguous
+type Cmds map[byte][]Cmd
 
 func (cmd *Cmd) Match(prefix string) bool {
 	return strings.HasPrefix(cmd.Name, prefix)
@@ -36,28 +38,32 @@ func (cmd *Cmd) Match(prefix string) bool {
 
 func (cmds Cmds) Lookup(prefix string) (Cmd, bool) {
 	if len(prefix) != 0 {
-		cmd, found := cmds[prefix[0]]
-		if found && cmd.Match(prefix) {
-			return cmd, true
+		for _, cmd := range cmds[prefix[0]] {
+			if cmd.Match(prefix) {
+				return cmd, true
+			}
 		}
 	}
 	return Cmd{}, false
 }
 
 var cmds = Cmds{
-	'b': Cmd{"backtrace", (*Debugger).cmdBacktrace},
-	'c': Cmd{"continue", (*Debugger).cmdContinue},
-	'e': Cmd{"env", (*Debugger).cmdEnv},
-	'f': Cmd{"finish", (*Debugger).cmdFinish},
-	'h': Cmd{"help", (*Debugger).cmdHelp},
-	'?': Cmd{"?", (*Debugger).cmdHelp},
-	'i': Cmd{"inspect", (*Debugger).cmdInspect},
-	'k': Cmd{"kill", (*Debugger).cmdKill},
-	'l': Cmd{"list", (*Debugger).cmdList},
-	'n': Cmd{"next", (*Debugger).cmdNext},
-	'p': Cmd{"print", (*Debugger).cmdPrint},
-	's': Cmd{"step", (*Debugger).cmdStep},
-	'v': Cmd{"vars", (*Debugger).cmdVars},
+	'b': {{"backtrace", (*Debugger).cmdBacktrace}, {"break", (*Debugger).cmdBreak}},
+	'c': {{"continue", (*Debugger).cmdContinue}, {"condition", (*Debugger).cmdCondition}},
+	'd': {{"delete", (*Debugger).cmdDelete}, {"disable", (*Debugger).cmdDisable}, {"down", (*Debugger).cmdDown}},
+	'e': {{"env", (*Debugger).cmdEnv}, {"enable", (*Debugger).cmdEnable}},
+	'f': {{"finish", (*Debugger).cmdFinish}, {"frame", (*Debugger).cmdFrame}},
+	'h': {{"help", (*Debugger).cmdHelp}},
+	'?': {{"?", (*Debugger).cmdHelp}},
+	'i': {{"inspect", (*Debugger).cmdInspect}, {"info", (*Debugger).cmdInfo}, {"ignore", (*Debugger).cmdIgnore}},
+	'k': {{"kill", (*Debugger).cmdKill}},
+	'l': {{"list", (*Debugger).cmdList}},
+	'n': {{"next", (*Debugger).cmdNext}},
+	'p': {{"print", (*Debugger).cmdPrint}},
+	's': {{"step", (*Debugger).cmdStep}},
+	'u': {{"up", (*Debugger).cmdUp}},
+	'v': {{"vars", (*Debugger).cmdVars}},
+	'w': {{"watch", (*Debugger).cmdWatch}},
 }
 
 // execute one of the debugger commands
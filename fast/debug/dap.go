@@ -0,0 +1,641 @@
+package debug
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/token"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/WilliamNHarvey/gomacro/base"
+	"github.com/WilliamNHarvey/gomacro/fast"
+	xr "github.com/WilliamNHarvey/gomacro/xreflect"
+)
+
+type dapState uint8
+
+const (
+	dapIdle dapState = iota
+	dapRunning
+	dapStopped
+)
+
+// DAPServer exposes the debugger over the Debug Adapter Protocol,
+// used by VS Code and other editors.
+//
+// Requests that inspect or resume the interpreted code are executed
+// by the goroutine that calls Serve(), which must be the goroutine that created the Interp:
+// it is also the goroutine that runs the launched program.
+// Breakpoints and pause requests are executed as soon as they are received.
+type DAPServer struct {
+	ir       *fast.Interp
+	in       *bufio.Reader
+	out      io.Writer
+	outlock  sync.Mutex
+	seq      int
+	requests chan *dapMessage // requests executed by the interpreter goroutine
+
+	lock        sync.Mutex
+	state       dapState
+	launch      *dapLaunchArguments
+	pausing     bool
+	terminating bool
+	evaluating  bool
+	srcbps      map[string][]int // source path -> IDs of breakpoints set by setBreakpoints
+	funcbps     []int            // IDs of breakpoints set by setFunctionBreakpoints
+
+	// valid while stopped
+	frames []*fast.Env
+	refs   []dapRef
+}
+
+// NewDAPServer creates a Debug Adapter Protocol server for ir,
+// reading requests from in and writing responses and events to out
+func NewDAPServer(ir *fast.Interp, in io.Reader, out io.Writer) *DAPServer {
+	return &DAPServer{
+		ir:       ir,
+		in:       bufio.NewReader(in),
+		out:      out,
+		requests: make(chan *dapMessage, 16),
+		srcbps:   make(map[string][]int),
+	}
+}
+
+// ListenDAP accepts a single connection on the local TCP address addr,
+// and serves the Debug Adapter Protocol on it. See DAPServer.Serve()
+func ListenDAP(ir *fast.Interp, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	g := &ir.Comp.Globals
+	g.Fprintf(g.Stderr, "// DAP server listening at %s\n", ln.Addr())
+	conn, err := ln.Accept()
+	ln.Close()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return NewDAPServer(ir, conn, conn).Serve()
+}
+
+// Serve installs s as the debugger of its Interp, and serves requests until the client disconnects.
+// Interpreter output is sent to the client as "output" events.
+// Must be called by the goroutine that created the Interp.
+func (s *DAPServer) Serve() error {
+	ir := s.ir
+	g := &ir.Comp.Globals
+	saveOutput, saveOptions := g.Output, g.Options
+	defer func() {
+		g.Output, g.Options = saveOutput, saveOptions
+	}()
+	g.Stdout = s.Output("stdout")
+	g.Stderr = s.Output("stderr")
+	g.Options |= base.OptDebugger | base.OptCtrlCEnterDebugger | base.OptTrapPanic
+	g.Options &^= base.OptShowPrompt | base.OptShowEval | base.OptShowEvalType
+	ir.SetDebugger(s)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.read()
+	}()
+	for req := range s.requests {
+		if !s.exec(req) {
+			break
+		}
+	}
+	// drain requests until the reader exits
+	go func() {
+		for range s.requests {
+		}
+	}()
+	err := <-errc
+	if err == io.EOF {
+		err = nil
+	}
+	return err
+}
+
+// Output returns an io.Writer that sends what is written to the client,
+// as "output" events with given category: "stdout", "stderr" or "console"
+func (s *DAPServer) Output(category string) io.Writer {
+	return dapOutput{s, category}
+}
+
+type dapOutput struct {
+	s        *DAPServer
+	category string
+}
+
+func (o dapOutput) Write(p []byte) (int, error) {
+	o.s.event("output", &dapOutputEvent{Category: o.category, Output: string(p)})
+	return len(p), nil
+}
+
+// ============================= messages ======================================
+
+func (s *DAPServer) send(msg interface{}) {
+	s.outlock.Lock()
+	defer s.outlock.Unlock()
+	s.seq++
+	switch msg := msg.(type) {
+	case *dapResponse:
+		msg.Seq = s.seq
+	case *dapEvent:
+		msg.Seq = s.seq
+	}
+	writeDAPMessage(s.out, msg)
+}
+
+func (s *DAPServer) respond(req *dapMessage, body interface{}) {
+	s.send(&dapResponse{Type: "response", RequestSeq: req.Seq, Success: true, Command: req.Command, Body: body})
+}
+
+func (s *DAPServer) fail(req *dapMessage, format string, args ...interface{}) {
+	s.send(&dapResponse{Type: "response", RequestSeq: req.Seq, Command: req.Command, Message: fmt.Sprintf(format, args...)})
+}
+
+func (s *DAPServer) event(name string, body interface{}) {
+	s.send(&dapEvent{Type: "event", Event: name, Body: body})
+}
+
+// read reads requests, executes the ones that can run at any time,
+// and forwards the others to the interpreter goroutine
+func (s *DAPServer) read() error {
+	defer close(s.requests)
+	for {
+		req, err := readDAPMessage(s.in)
+		if err != nil {
+			s.terminate()
+			return err
+		}
+		if req.Type != "request" {
+			continue
+		}
+		switch req.Command {
+		case "initialize":
+			s.respond(req, &dapCapabilities{
+				SupportsConfigurationDoneRequest:  true,
+				SupportsFunctionBreakpoints:       true,
+				SupportsConditionalBreakpoints:    true,
+				SupportsHitConditionalBreakpoints: true,
+				SupportsEvaluateForHovers:         true,
+				SupportsTerminateRequest:          true,
+			})
+			s.event("initialized", nil)
+		case "launch":
+			args := &dapLaunchArguments{}
+			if err := json.Unmarshal(req.Arguments, args); err != nil || args.Program == "" {
+				s.fail(req, "launch: missing program")
+				continue
+			}
+			s.lock.Lock()
+			s.launch = args
+			s.lock.Unlock()
+			s.respond(req, nil)
+		case "attach":
+			// the host program evaluates code with the Interp
+			s.respond(req, nil)
+		case "setBreakpoints":
+			s.setBreakpoints(req)
+		case "setFunctionBreakpoints":
+			s.setFunctionBreakpoints(req)
+		case "setExceptionBreakpoints":
+			s.respond(req, &dapBreakpoints{Breakpoints: []dapBreakpoint{}})
+		case "threads":
+			s.respond(req, &dapThreads{Threads: []dapThread{{ID: 1, Name: "main"}}})
+		case "pause":
+			s.lock.Lock()
+			if s.state == dapRunning {
+				s.pausing = true
+				s.ir.Interrupt(nil)
+			}
+			s.lock.Unlock()
+			s.respond(req, nil)
+		case "disconnect", "terminate":
+			s.terminate()
+			s.requests <- req
+			return nil
+		default:
+			s.requests <- req
+		}
+	}
+}
+
+// terminate makes the running program stop at the next statement, then kills it
+func (s *DAPServer) terminate() {
+	s.lock.Lock()
+	s.terminating = true
+	if s.state == dapRunning {
+		s.ir.Interrupt(nil)
+	}
+	s.lock.Unlock()
+}
+
+// exec executes a request while the interpreter is idle.
+// returns false if the client disconnected
+func (s *DAPServer) exec(req *dapMessage) bool {
+	switch req.Command {
+	case "configurationDone":
+		s.respond(req, nil)
+		s.lock.Lock()
+		launch := s.launch
+		s.lock.Unlock()
+		if launch != nil {
+			s.run(launch)
+		}
+	case "evaluate":
+		s.evaluate(req, nil)
+	case "disconnect", "terminate":
+		s.respond(req, nil)
+		return false
+	default:
+		s.fail(req, "%s: not stopped", req.Command)
+	}
+	return true
+}
+
+// run executes the launched program
+func (s *DAPServer) run(launch *dapLaunchArguments) {
+	s.setState(dapRunning)
+	var exitCode int
+	var err error
+	if info, _ := os.Stat(launch.Program); (info != nil && info.IsDir()) || strings.HasSuffix(launch.Program, ".go") {
+		exitCode, err = s.runGoFiles(launch)
+	} else {
+		exitCode, err = s.runFile(launch)
+	}
+	if err != nil {
+		s.event("output", &dapOutputEvent{Category: "stderr", Output: err.Error() + "\n"})
+	}
+	s.setState(dapIdle)
+	s.event("exited", &dapExitedEvent{ExitCode: exitCode})
+	s.event("terminated", nil)
+}
+
+// runFile evaluates the launched file, then calls main() if defined
+func (s *DAPServer) runFile(launch *dapLaunchArguments) (int, error) {
+	ir := s.ir
+	_, err := ir.EvalFile(launch.Program)
+	if err == nil {
+		if sym := ir.Comp.TryResolve("main"); sym != nil && sym.Desc.Class() == fast.FuncBind {
+			s.stopOnEntry(launch)
+			_, err = ir.EvalReader(strings.NewReader("main()\n"))
+		}
+	}
+	if err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+// runGoFiles executes the launched Go file or package directory as "go run" would
+func (s *DAPServer) runGoFiles(launch *dapLaunchArguments) (int, error) {
+	files := []string{launch.Program}
+	if !strings.HasSuffix(launch.Program, ".go") {
+		var err error
+		if files, err = fast.GoFiles(launch.Program); err != nil {
+			return 1, err
+		} else if len(files) == 0 {
+			return 1, fmt.Errorf("no Go files in %s", launch.Program)
+		}
+	}
+	s.stopOnEntry(launch)
+	return s.ir.RunGoFiles(files...)
+}
+
+func (s *DAPServer) stopOnEntry(launch *dapLaunchArguments) {
+	if launch.StopOnEntry {
+		s.lock.Lock()
+		s.pausing = true
+		s.lock.Unlock()
+		s.ir.Interrupt(nil)
+	}
+}
+
+func (s *DAPServer) setState(state dapState) {
+	s.lock.Lock()
+	s.state = state
+	s.lock.Unlock()
+}
+
+// ============================= breakpoints ===================================
+
+// setBreakpoints and setFunctionBreakpoints run in the goroutine reading requests,
+// possibly while the interpreter executes: Interp breakpoints are safe for concurrent use,
+// and each one is added together with its condition and hit count.
+
+func (s *DAPServer) setBreakpoints(req *dapMessage) {
+	args := &dapSetBreakpointsArguments{}
+	if err := json.Unmarshal(req.Arguments, args); err != nil {
+		s.fail(req, "setBreakpoints: %v", err)
+		return
+	}
+	ir := s.ir
+	path := args.Source.Path
+	if path == "" {
+		path = args.Source.Name
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, id := range s.srcbps[path] {
+		ir.DeleteBreakpoint(id)
+	}
+	ids := make([]int, 0, len(args.Breakpoints))
+	ret := make([]dapBreakpoint, len(args.Breakpoints))
+	for i, sbp := range args.Breakpoints {
+		ignore, err := parseHitCondition(sbp.HitCondition)
+		if err != nil {
+			ret[i] = dapBreakpoint{Line: sbp.Line, Message: err.Error()}
+			continue
+		}
+		bp := ir.AddBreakpoint(fast.Breakpoint{File: path, Line: sbp.Line, Cond: sbp.Condition, Ignore: ignore})
+		ids = append(ids, bp.ID)
+		// breakpoints also apply to code compiled later, thus they are always verified
+		ret[i] = dapBreakpoint{ID: bp.ID, Verified: true, Line: sbp.Line}
+	}
+	s.srcbps[path] = ids
+	s.respond(req, &dapBreakpoints{Breakpoints: ret})
+}
+
+func (s *DAPServer) setFunctionBreakpoints(req *dapMessage) {
+	args := &dapSetFunctionBreakpointsArguments{}
+	if err := json.Unmarshal(req.Arguments, args); err != nil {
+		s.fail(req, "setFunctionBreakpoints: %v", err)
+		return
+	}
+	ir := s.ir
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, id := range s.funcbps {
+		ir.DeleteBreakpoint(id)
+	}
+	s.funcbps = s.funcbps[:0]
+	ret := make([]dapBreakpoint, len(args.Breakpoints))
+	for i, fbp := range args.Breakpoints {
+		ignore, err := parseHitCondition(fbp.HitCondition)
+		if err != nil {
+			ret[i] = dapBreakpoint{Message: err.Error()}
+			continue
+		}
+		bp := ir.AddBreakpoint(fast.Breakpoint{Func: fbp.Name, Cond: fbp.Condition, Ignore: ignore})
+		s.funcbps = append(s.funcbps, bp.ID)
+		ret[i] = dapBreakpoint{ID: bp.ID, Verified: true}
+	}
+	s.respond(req, &dapBreakpoints{Breakpoints: ret})
+}
+
+// parseHitCondition parses "N" or ">= N", meaning: stop from the N-th hit on.
+// returns the number of hits to ignore
+func parseHitCondition(cond string) (int, error) {
+	cond = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(cond), ">="))
+	if cond == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(cond)
+	if err != nil || n < 0 {
+		return 0, errors.New("unsupported hit condition, expecting a number")
+	}
+	if n > 0 {
+		n--
+	}
+	return n, nil
+}
+
+// ============================= fast.Debugger =================================
+
+func (s *DAPServer) Breakpoint(ir *fast.Interp, env *fast.Env) DebugOp {
+	reason := "breakpoint"
+	if env.Run.Watch != nil {
+		reason = "data breakpoint"
+	}
+	return s.stop(env, reason)
+}
+
+func (s *DAPServer) At(ir *fast.Interp, env *fast.Env) DebugOp {
+	return s.stop(env, "step")
+}
+
+// stop notifies the client that execution stopped,
+// then executes requests until the client resumes execution
+func (s *DAPServer) stop(env *fast.Env, reason string) DebugOp {
+	s.lock.Lock()
+	if s.terminating {
+		s.lock.Unlock()
+		return dapKill()
+	} else if s.evaluating {
+		// do not stop inside code evaluated by the client
+		s.lock.Unlock()
+		return DebugOpContinue
+	}
+	if ip := env.IP; ip >= len(env.DebugPos) || env.DebugPos[ip] == token.NoPos {
+		// skip synthetic statements
+		s.lock.Unlock()
+		return DebugOp{Depth: env.Run.DebugDepth}
+	}
+	if s.pausing {
+		s.pausing = false
+		reason = "pause"
+	}
+	s.state = dapStopped
+	s.frames = stackFrames(env)
+	s.refs = nil
+	s.lock.Unlock()
+
+	s.event("stopped", &dapStoppedEvent{Reason: reason, ThreadID: 1, AllThreadsStopped: true})
+
+	op := dapKill() // if the client disconnects, kill the program
+	for req := range s.requests {
+		resume := true
+		switch req.Command {
+		case "continue":
+			op = DebugOpContinue
+		case "next":
+			op = DebugOp{Depth: env.CallDepth + 1}
+		case "stepIn":
+			op = DebugOpStep
+		case "stepOut":
+			op = DebugOp{Depth: env.CallDepth}
+		case "disconnect", "terminate":
+			op = dapKill()
+		default:
+			resume = false
+			s.execStopped(req)
+		}
+		if resume {
+			if req.Command == "continue" {
+				s.respond(req, &dapContinued{AllThreadsContinued: true})
+			} else {
+				s.respond(req, nil)
+			}
+			break
+		}
+	}
+	s.lock.Lock()
+	s.state = dapRunning
+	s.frames, s.refs = nil, nil
+	s.lock.Unlock()
+	return op
+}
+
+// dapKill returns a DebugOp that terminates execution
+func dapKill() DebugOp {
+	var panick interface{} = base.SigInterrupt
+	return DebugOp{Panic: &panick}
+}
+
+// execStopped executes a request that inspects the stopped interpreted code
+func (s *DAPServer) execStopped(req *dapMessage) {
+	switch req.Command {
+	case "stackTrace":
+		s.stackTrace(req)
+	case "scopes":
+		s.scopes(req)
+	case "variables":
+		s.variables(req)
+	case "evaluate":
+		args := &dapEvaluateArguments{}
+		json.Unmarshal(req.Arguments, args)
+		s.evaluate(req, s.frame(args.FrameID))
+	default:
+		s.fail(req, "unsupported command: %s", req.Command)
+	}
+}
+
+// ============================= stack frames ==================================
+
+func (s *DAPServer) frame(id *int) *fast.Env {
+	if id == nil || *id < 0 || *id >= len(s.frames) {
+		if len(s.frames) == 0 {
+			return nil
+		}
+		return s.frames[0]
+	}
+	return s.frames[*id]
+}
+
+func (s *DAPServer) stackTrace(req *dapMessage) {
+	g := &s.ir.Comp.Globals
+	frames := make([]dapStackFrame, len(s.frames))
+	for i, env := range s.frames {
+		frame := dapStackFrame{ID: i, Name: "<toplevel>"}
+		if fenv := env.FuncEnv(); fenv.Caller != nil {
+			if c := fenv.DebugComp; c != nil && c.FuncMaker != nil {
+				frame.Name = c.FuncMaker.Name
+			} else {
+				frame.Name = "???"
+			}
+		}
+		if ip := env.IP; ip < len(env.DebugPos) && g.Fileset != nil {
+			pos := g.Fileset.Position(env.DebugPos[ip])
+			frame.Line, frame.Column = pos.Line, pos.Column
+			if pos.Filename != "" {
+				frame.Source = &dapSource{Name: filepath.Base(pos.Filename), Path: pos.Filename}
+			}
+		}
+		frames[i] = frame
+	}
+	s.respond(req, &dapStackTrace{StackFrames: frames, TotalFrames: len(frames)})
+}
+
+func (s *DAPServer) scopes(req *dapMessage) {
+	args := &dapFrameArguments{}
+	json.Unmarshal(req.Arguments, args)
+	env := s.frame(&args.FrameID)
+	if env == nil {
+		s.fail(req, "scopes: no such frame %d", args.FrameID)
+		return
+	}
+	var locals []*fast.Env
+	for e := env; e != nil && e != e.FileEnv; e = e.Outer {
+		locals = append(locals, e)
+	}
+	scopes := []dapScope{
+		{Name: "Locals", VariablesReference: s.newRef(dapRef{envs: locals})},
+	}
+	if env.FileEnv != nil {
+		scopes = append(scopes, dapScope{Name: "Globals", VariablesReference: s.newRef(dapRef{envs: []*fast.Env{env.FileEnv}})})
+	}
+	s.respond(req, &dapScopes{Scopes: scopes})
+}
+
+func (s *DAPServer) variables(req *dapMessage) {
+	args := &dapVariablesArguments{}
+	json.Unmarshal(req.Arguments, args)
+	i := args.VariablesReference - 1
+	if i < 0 || i >= len(s.refs) {
+		s.fail(req, "variables: invalid variablesReference %d", args.VariablesReference)
+		return
+	}
+	s.respond(req, &dapVariables{Variables: s.children(s.refs[i])})
+}
+
+// evaluate compiles and executes an expression in the scope of env,
+// or at top level if env is nil
+func (s *DAPServer) evaluate(req *dapMessage, env *fast.Env) {
+	args := &dapEvaluateArguments{}
+	json.Unmarshal(req.Arguments, args)
+
+	ir := s.ir
+	if inner := env.DebugInterp(); inner != nil {
+		// preserve existing Binds, compiled Code and IP
+		ir = fast.NewInnerInterp(inner, "debug", "debug")
+	}
+	vals, types, err := s.eval(ir, env, args.Expression)
+	if err != nil {
+		s.fail(req, "%v", err)
+		return
+	}
+	ret := &dapEvaluate{}
+	for i, val := range vals {
+		var v dapVariable
+		if i < len(types) {
+			v = s.variable("", val.ReflectValue(), types[i].String())
+		} else {
+			v = s.variable("", val.ReflectValue(), "")
+		}
+		if i == 0 {
+			ret.Result, ret.Type, ret.VariablesReference = v.Value, v.Type, v.VariablesReference
+		} else {
+			ret.Result += ", " + v.Value
+			ret.Type += ", " + v.Type
+			ret.VariablesReference = 0
+		}
+	}
+	s.respond(req, ret)
+}
+
+// eval evaluates src with ir, without stopping at breakpoints or single-stepping
+func (s *DAPServer) eval(ir *fast.Interp, env *fast.Env, src string) (vals []xr.Value, types []xr.Type, err error) {
+	s.lock.Lock()
+	s.evaluating = true
+	s.lock.Unlock()
+
+	var sig *base.Signals
+	var sigdebug base.Signal
+	if env != nil {
+		sig = &env.Run.Signals
+		sigdebug = sig.Debug
+		sig.Debug = base.SigNone
+	}
+	defer func() {
+		if sig != nil {
+			sig.Debug = sigdebug
+		}
+		s.lock.Lock()
+		s.evaluating = false
+		s.lock.Unlock()
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("%v", rec)
+		}
+	}()
+	vals, types = ir.Eval(src)
+	return vals, types, nil
+}
@@ -0,0 +1,207 @@
+package debug
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// the subset of the Debug Adapter Protocol used by DAPServer.
+// see https://microsoft.github.io/debug-adapter-protocol/specification
+
+// dapMessage is a request received from the client
+type dapMessage struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+type dapResponse struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+type dapCapabilities struct {
+	SupportsConfigurationDoneRequest  bool `json:"supportsConfigurationDoneRequest"`
+	SupportsFunctionBreakpoints       bool `json:"supportsFunctionBreakpoints"`
+	SupportsConditionalBreakpoints    bool `json:"supportsConditionalBreakpoints"`
+	SupportsHitConditionalBreakpoints bool `json:"supportsHitConditionalBreakpoints"`
+	SupportsEvaluateForHovers         bool `json:"supportsEvaluateForHovers"`
+	SupportsTerminateRequest          bool `json:"supportsTerminateRequest"`
+}
+
+type dapLaunchArguments struct {
+	Program     string `json:"program"`
+	StopOnEntry bool   `json:"stopOnEntry"`
+	NoDebug     bool   `json:"noDebug"`
+}
+
+type dapSource struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type dapSourceBreakpoint struct {
+	Line         int    `json:"line"`
+	Condition    string `json:"condition,omitempty"`
+	HitCondition string `json:"hitCondition,omitempty"`
+}
+
+type dapSetBreakpointsArguments struct {
+	Source      dapSource             `json:"source"`
+	Breakpoints []dapSourceBreakpoint `json:"breakpoints"`
+}
+
+type dapFunctionBreakpoint struct {
+	Name         string `json:"name"`
+	Condition    string `json:"condition,omitempty"`
+	HitCondition string `json:"hitCondition,omitempty"`
+}
+
+type dapSetFunctionBreakpointsArguments struct {
+	Breakpoints []dapFunctionBreakpoint `json:"breakpoints"`
+}
+
+type dapBreakpoint struct {
+	ID       int    `json:"id,omitempty"`
+	Verified bool   `json:"verified"`
+	Message  string `json:"message,omitempty"`
+	Line     int    `json:"line,omitempty"`
+}
+
+type dapBreakpoints struct {
+	Breakpoints []dapBreakpoint `json:"breakpoints"`
+}
+
+type dapThread struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type dapThreads struct {
+	Threads []dapThread `json:"threads"`
+}
+
+type dapStackFrame struct {
+	ID     int        `json:"id"`
+	Name   string     `json:"name"`
+	Source *dapSource `json:"source,omitempty"`
+	Line   int        `json:"line"`
+	Column int        `json:"column"`
+}
+
+type dapStackTrace struct {
+	StackFrames []dapStackFrame `json:"stackFrames"`
+	TotalFrames int             `json:"totalFrames"`
+}
+
+type dapFrameArguments struct {
+	FrameID int `json:"frameId"`
+}
+
+type dapScope struct {
+	Name               string `json:"name"`
+	VariablesReference int    `json:"variablesReference"`
+	Expensive          bool   `json:"expensive"`
+}
+
+type dapScopes struct {
+	Scopes []dapScope `json:"scopes"`
+}
+
+type dapVariablesArguments struct {
+	VariablesReference int `json:"variablesReference"`
+}
+
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	Type               string `json:"type,omitempty"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+type dapVariables struct {
+	Variables []dapVariable `json:"variables"`
+}
+
+type dapEvaluateArguments struct {
+	Expression string `json:"expression"`
+	FrameID    *int   `json:"frameId,omitempty"`
+	Context    string `json:"context,omitempty"`
+}
+
+type dapEvaluate struct {
+	Result             string `json:"result"`
+	Type               string `json:"type,omitempty"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+type dapStoppedEvent struct {
+	Reason            string `json:"reason"`
+	Description       string `json:"description,omitempty"`
+	ThreadID          int    `json:"threadId"`
+	AllThreadsStopped bool   `json:"allThreadsStopped"`
+}
+
+type dapContinued struct {
+	AllThreadsContinued bool `json:"allThreadsContinued"`
+}
+
+type dapOutputEvent struct {
+	Category string `json:"category"`
+	Output   string `json:"output"`
+}
+
+type dapExitedEvent struct {
+	ExitCode int `json:"exitCode"`
+}
+
+// readDAPMessage reads a message, encoded as a Content-Length header followed by JSON
+func readDAPMessage(in *bufio.Reader) (*dapMessage, error) {
+	header, err := textproto.NewReader(in).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(header.Get("Content-Length")))
+	if err != nil || length <= 0 {
+		return nil, fmt.Errorf("DAP: missing or invalid Content-Length header: %q", header.Get("Content-Length"))
+	}
+	buf := make([]byte, length)
+	if _, err = io.ReadFull(in, buf); err != nil {
+		return nil, err
+	}
+	msg := &dapMessage{}
+	if err = json.Unmarshal(buf, msg); err != nil {
+		return nil, fmt.Errorf("DAP: invalid message: %v", err)
+	}
+	return msg, nil
+}
+
+// writeDAPMessage writes a message, encoded as a Content-Length header followed by JSON
+func writeDAPMessage(out io.Writer, msg interface{}) error {
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(out, "Content-Length: %d\r\n\r\n", len(buf)); err == nil {
+		_, err = out.Write(buf)
+	}
+	return err
+}
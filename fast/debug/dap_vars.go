@@ -0,0 +1,154 @@
+package debug
+
+import (
+	"fmt"
+	r "reflect"
+	"sort"
+
+	"github.com/WilliamNHarvey/gomacro/fast"
+)
+
+// maximum number of elements shown for arrays, slices and maps
+const dapMaxChildren = 1000
+
+// maximum length of formatted values
+const dapMaxValueLen = 1000
+
+// dapRef is the target of a DAP variablesReference:
+// either the variables of some scopes, or the contents of a value
+type dapRef struct {
+	envs  []*fast.Env // innermost first
+	value r.Value
+}
+
+// newRef registers ref and returns its variablesReference
+func (s *DAPServer) newRef(ref dapRef) int {
+	s.refs = append(s.refs, ref)
+	return len(s.refs)
+}
+
+func (s *DAPServer) children(ref dapRef) []dapVariable {
+	if ref.envs != nil {
+		return s.envVariables(ref.envs)
+	}
+	return s.valueChildren(ref.value)
+}
+
+// envVariables returns the variables and constants of envs, innermost first.
+// Variables shadowed by inner scopes are omitted
+func (s *DAPServer) envVariables(envs []*fast.Env) []dapVariable {
+	vars := []dapVariable{}
+	seen := make(map[string]bool)
+	for _, env := range envs {
+		c := env.DebugComp
+		if c == nil {
+			continue
+		}
+		binds := make([]*fast.Bind, 0, len(c.Binds))
+		for name, bind := range c.Binds {
+			if name == "" || name == "_" || seen[name] {
+				continue
+			}
+			switch bind.Desc.Class() {
+			case fast.ConstBind, fast.VarBind, fast.IntBind:
+				binds = append(binds, bind)
+			}
+		}
+		sort.Slice(binds, func(i, j int) bool {
+			return binds[i].Name < binds[j].Name
+		})
+		for _, bind := range binds {
+			seen[bind.Name] = true
+			value := bind.RuntimeValue(c.CompGlobals, env)
+			vars = append(vars, s.variable(bind.Name, value.ReflectValue(), bind.Type.String()))
+		}
+	}
+	return vars
+}
+
+// valueChildren returns the fields, elements or entries of v
+func (s *DAPServer) valueChildren(v r.Value) []dapVariable {
+	vars := []dapVariable{}
+	switch v.Kind() {
+	case r.Ptr:
+		if !v.IsNil() {
+			vars = append(vars, s.variable("*", v.Elem(), v.Type().Elem().String()))
+		}
+	case r.Interface:
+		if !v.IsNil() {
+			return s.valueChildren(v.Elem())
+		}
+	case r.Struct:
+		t := v.Type()
+		for i, n := 0, t.NumField(); i < n; i++ {
+			vars = append(vars, s.variable(t.Field(i).Name, v.Field(i), t.Field(i).Type.String()))
+		}
+	case r.Array, r.Slice:
+		t := v.Type().Elem().String()
+		for i, n := 0, v.Len(); i < n && i < dapMaxChildren; i++ {
+			vars = append(vars, s.variable(fmt.Sprintf("[%d]", i), v.Index(i), t))
+		}
+	case r.Map:
+		t := v.Type().Elem().String()
+		keys := v.MapKeys()
+		names := make([]string, len(keys))
+		for i, key := range keys {
+			names[i] = formatValue(key)
+		}
+		order := make([]int, len(keys))
+		for i := range order {
+			order[i] = i
+		}
+		sort.Slice(order, func(i, j int) bool {
+			return names[order[i]] < names[order[j]]
+		})
+		for i, k := range order {
+			if i >= dapMaxChildren {
+				break
+			}
+			vars = append(vars, s.variable("["+names[k]+"]", v.MapIndex(keys[k]), t))
+		}
+	}
+	return vars
+}
+
+// variable returns the DAP representation of v.
+// If v has fields, elements or entries, registers a variablesReference for them
+func (s *DAPServer) variable(name string, v r.Value, typ string) dapVariable {
+	ret := dapVariable{Name: name, Value: formatValue(v), Type: typ}
+	if typ == "" && v.IsValid() {
+		ret.Type = v.Type().String()
+	}
+	if hasChildren(v) {
+		ret.VariablesReference = s.newRef(dapRef{value: v})
+	}
+	return ret
+}
+
+func hasChildren(v r.Value) bool {
+	switch v.Kind() {
+	case r.Ptr, r.Interface:
+		return !v.IsNil() && (v.Kind() == r.Ptr || hasChildren(v.Elem()))
+	case r.Struct:
+		return v.NumField() != 0
+	case r.Array, r.Slice, r.Map:
+		return v.Len() != 0
+	}
+	return false
+}
+
+func formatValue(v r.Value) string {
+	var str string
+	switch v.Kind() {
+	case r.Invalid:
+		return "nil"
+	case r.String:
+		str = fmt.Sprintf("%q", v)
+	default:
+		str = fmt.Sprintf("%v", v)
+	}
+	if len(str) > dapMaxValueLen {
+		str = str[:dapMaxValueLen] + "..."
+	}
+	return str
+}
@@ -19,6 +19,7 @@ package debug
 import (
 	"go/token"
 	"runtime/debug"
+	"strconv"
 
 	"github.com/WilliamNHarvey/gomacro/base"
 	"github.com/WilliamNHarvey/gomacro/xreflect"
@@ -27,11 +28,24 @@ import (
 func (d *Debugger) Help() {
 	g := d.globals
 	g.Fprintf(g.Stdout, "%s", `// debugger commands:
-backtrace       show call stack
+backtrace       show call stack. the selected frame is marked with *
+break [LOCATION] [if COND]
+                set breakpoint at LOCATION: FILE:LINE, LINE or FUNC.
+                default is current line. methods are named TYPE.METHOD
+                if COND is specified, stop only when it is true
+condition N [COND] set or remove condition of breakpoint N
+delete  [N...]  delete breakpoints N..., or all breakpoints
+disable [N...]  disable breakpoints N..., or all breakpoints
+down    [N]     select the frame N levels below the current one, default 1
+enable  [N...]  enable breakpoints N..., or all breakpoints
 env [NAME]      show available functions, variables and constants
                 in current scope, or from imported package NAME
+frame   [N]     select frame N, as numbered by backtrace,
+                or show the selected frame
 ?               show this help
 help            show this help
+ignore N COUNT  ignore the next COUNT hits of breakpoint N
+info breakpoints show breakpoints and watchpoints
 inspect EXPR    inspect expression interactively
 kill   [EXPR]   terminate execution with panic(EXPR)
 print   EXPR    print expression, statement or declaration
@@ -40,7 +54,12 @@ continue        resume normal execution
 finish          run until the end of current function
 next            execute a single statement, skipping functions
 step            execute a single statement, entering functions
+up      [N]     select the frame N levels above the current one, default 1.
+                print, vars, env, inspect and list use the selected frame
 vars            show local variables
+watch NAME      stop when variable NAME is modified, including the elements
+                of slices and maps, but not data reachable through pointers.
+                execution is much slower while watchpoints exist
 // abbreviations are allowed if unambiguous. enter repeats last command.
 `)
 	/*
@@ -59,7 +78,16 @@ func (d *Debugger) Show(breakpoint bool) bool {
 	ip := env.IP
 
 	var label string
-	if breakpoint {
+	if d.frame != 0 {
+		label = "frame " + strconv.Itoa(d.frame)
+	} else if w := env.Run.Watch; w != nil {
+		var where string
+		if w.Pos != token.NoPos && g.Fileset != nil {
+			where = " at " + g.Fileset.Position(w.Pos).String()
+		}
+		g.Fprintf(g.Stdout, "// watchpoint %d: %s changed%s\n// old value = %s\n// new value = %s\n", w.ID, w.Name, where, w.Old, w.Value)
+		label = "watchpoint"
+	} else if breakpoint {
 		label = "breakpoint"
 	} else {
 		label = "stopped"
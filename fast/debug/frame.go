@@ -0,0 +1,72 @@
+package debug
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/WilliamNHarvey/gomacro/fast"
+)
+
+func (d *Debugger) cmdUp(arg string) DebugOp {
+	if n, ok := d.frameCount("up", arg); ok {
+		d.selectFrame(d.frame + n)
+	}
+	return DebugOpRepl
+}
+
+func (d *Debugger) cmdDown(arg string) DebugOp {
+	if n, ok := d.frameCount("down", arg); ok {
+		d.selectFrame(d.frame - n)
+	}
+	return DebugOpRepl
+}
+
+func (d *Debugger) cmdFrame(arg string) DebugOp {
+	if arg = strings.TrimSpace(arg); arg == "" {
+		d.Show(false)
+	} else if n, err := strconv.Atoi(arg); err != nil || n < 0 {
+		g := d.globals
+		g.Fprintf(g.Stdout, "// frame: expecting a frame number, found %q\n", arg)
+	} else {
+		d.selectFrame(n)
+	}
+	return DebugOpRepl
+}
+
+// frameCount parses the optional argument of commands up and down
+func (d *Debugger) frameCount(cmd string, arg string) (int, bool) {
+	if arg = strings.TrimSpace(arg); arg == "" {
+		return 1, true
+	}
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 0 {
+		g := d.globals
+		g.Fprintf(g.Stdout, "// %s: expecting a number of frames, found %q\n", cmd, arg)
+		return 0, false
+	}
+	return n, true
+}
+
+// selectFrame makes frame n the one used by commands print, vars, env, inspect and list.
+// n is clamped to the existing frames
+func (d *Debugger) selectFrame(n int) {
+	g := d.globals
+	if last := len(d.frames) - 1; n > last {
+		n = last
+		g.Fprintf(g.Stdout, "// outermost frame selected, cannot go up\n")
+	} else if n < 0 {
+		n = 0
+		g.Fprintf(g.Stdout, "// innermost frame selected, cannot go down\n")
+	}
+	env := d.frames[n]
+	ir := env.DebugInterp()
+	if ir == nil {
+		g.Fprintf(g.Stdout, "// frame %d has no debugging information\n", n)
+		return
+	}
+	// create an inner Interp to preserve existing Binds, compiled Code and IP
+	d.interp = fast.NewInnerInterp(ir, "debug", "debug")
+	d.env = env
+	d.frame = n
+	d.Show(false)
+}
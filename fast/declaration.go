@@ -175,6 +175,15 @@ func (c *Comp) DeclVars(node ast.Spec) {
 	switch node := node.(type) {
 	case *ast.ValueSpec:
 		names, t, inits := c.prepareDeclConstsOrVars(toStrings(node.Names), node.Type, node.Values)
+		if t != nil && len(inits) == len(node.Values) {
+			for i, init := range inits {
+				if init.Const() {
+					// convert untyped constants here, to report errors at their position
+					c.Pos = node.Values[i].Pos()
+					init.ConstTo(t)
+				}
+			}
+		}
 		c.DeclVars0(names, t, inits, toPos(node.Names))
 	default:
 		c.Errorf("unsupported variable declaration: expecting <*ast.ValueSpec>, found: %v <%v>", node, r.TypeOf(node))
@@ -0,0 +1,222 @@
+package fast
+
+import (
+	"context"
+	"fmt"
+	"go/token"
+	"strings"
+
+	"github.com/WilliamNHarvey/gomacro/base"
+	"github.com/WilliamNHarvey/gomacro/base/output"
+	"github.com/WilliamNHarvey/gomacro/go/etoken"
+	"github.com/WilliamNHarvey/gomacro/go/scanner"
+	xr "github.com/WilliamNHarvey/gomacro/xreflect"
+)
+
+// ErrorKind classifies the errors returned by Interp.EvalE(), Interp.CompileE() and Interp.RunE()
+type ErrorKind uint8
+
+const (
+	ParseError   ErrorKind = iota + 1 // syntax error, or error during macroexpansion
+	CompileError                      // type error or other compile error
+	RuntimePanic                      // panic during execution
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ParseError:
+		return "parse error"
+	case CompileError:
+		return "compile error"
+	case RuntimePanic:
+		return "runtime panic"
+	}
+	return fmt.Sprintf("ErrorKind(%d)", uint8(k))
+}
+
+// StackFrame is a frame of the interpreted call stack
+type StackFrame struct {
+	Func string         // function name, or "<func>" if unknown (names require base.OptDebugger). empty for top-level code
+	Pos  token.Position // position of the statement being executed
+}
+
+func (f StackFrame) String() string {
+	name := f.Func
+	if name == "" {
+		name = "<toplevel>"
+	}
+	if !f.Pos.IsValid() {
+		return name
+	}
+	return name + " at " + f.Pos.String()
+}
+
+// EvalError is the error returned by Interp.EvalE(), Interp.CompileE() and Interp.RunE()
+type EvalError struct {
+	Kind  ErrorKind
+	Pos   token.Position // position of the error. for runtime panics, the statement that panicked
+	Msg   string         // error message, without position
+	Panic interface{}    // for runtime panics, the value passed to panic()
+	Stack []StackFrame   // for runtime panics, the interpreted call stack, innermost first
+	Err   error          // the underlying error, if any
+}
+
+func (e *EvalError) Error() string {
+	msg := e.Msg
+	if e.Kind == RuntimePanic {
+		msg = "panic: " + msg
+	}
+	if e.Pos.IsValid() {
+		msg = e.Pos.String() + ": " + msg
+	}
+	return msg
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
+// StackTrace returns the interpreted call stack, formatted one frame per line, innermost first
+func (e *EvalError) StackTrace() string {
+	var buf strings.Builder
+	for _, frame := range e.Stack {
+		buf.WriteString(frame.String())
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// makeError converts the argument of a panic during parse or compile to *EvalError
+func (c *Comp) makeError(kind ErrorKind, rec interface{}) *EvalError {
+	e := &EvalError{Kind: kind}
+	switch rec := rec.(type) {
+	case *EvalError:
+		return rec
+	case output.RuntimeError:
+		e.Pos, e.Msg = rec.Position(), rec.Message()
+		if !e.Pos.IsValid() {
+			// raised outside the compiler, as conversions of untyped constants
+			e.Pos = c.Position()
+		}
+	case scanner.ErrorList:
+		if len(rec) != 0 {
+			e.Pos, e.Msg = rec[0].Pos, rec[0].Msg
+		}
+	case *scanner.Error:
+		e.Pos, e.Msg = rec.Pos, rec.Msg
+	case error:
+		e.Pos, e.Msg = c.Position(), rec.Error()
+	default:
+		e.Pos, e.Msg = c.Position(), fmt.Sprint(rec)
+	}
+	if err, ok := rec.(error); ok {
+		e.Err = err
+	}
+	return e
+}
+
+// panicError converts the argument of a panic during execution to *EvalError
+func (run *Run) panicError(fileset *etoken.FileSet, rec interface{}) *EvalError {
+	e := &EvalError{Kind: RuntimePanic, Msg: fmt.Sprint(rec), Panic: rec}
+	if err, ok := rec.(error); ok {
+		e.Err = err
+	}
+	env := run.PanicEnv
+	if env == nil {
+		env = run.CurrEnv
+	}
+	e.Stack = stackTrace(fileset, env)
+	if len(e.Stack) != 0 {
+		e.Pos = e.Stack[0].Pos
+	}
+	return e
+}
+
+// stackTrace returns the interpreted call stack of env, innermost first
+func stackTrace(fileset *etoken.FileSet, env *Env) []StackFrame {
+	var stack []StackFrame
+	for env != nil {
+		fenv := env.FuncEnv()
+		var frame StackFrame
+		if fenv.Caller != nil {
+			if c := fenv.DebugComp; c != nil && c.FuncMaker != nil && c.FuncMaker.Name != "" {
+				frame.Func = c.FuncMaker.Name
+			} else {
+				frame.Func = "<func>"
+			}
+		}
+		if fileset != nil && env.IP < len(env.DebugPos) {
+			frame.Pos = fileset.Position(env.DebugPos[env.IP])
+		}
+		stack = append(stack, frame)
+		env = fenv.Caller
+	}
+	return stack
+}
+
+// CompileE is Compile that returns parse and compile errors as *EvalError instead of panicking
+func (ir *Interp) CompileE(src string) (expr *Expr, err error) {
+	kind := ParseError
+	defer func() {
+		if rec := recover(); rec != nil {
+			expr, err = nil, ir.Comp.makeError(kind, rec)
+		}
+	}()
+	form := ir.Parse(src)
+	kind = CompileError
+	return ir.CompileAst(form), nil
+}
+
+// RunE is RunExpr that returns runtime panics as *EvalError instead of propagating them,
+// and a *BudgetError if the execution exceeds the Budget set by Interp.SetBudget()
+func (ir *Interp) RunE(e *Expr) ([]xr.Value, []xr.Type, error) {
+	return ir.RunExprContext(context.Background(), e)
+}
+
+// runE executes e and returns runtime panics as *EvalError.
+// if group != nil, returns the reason if group interrupted the execution
+func (ir *Interp) runE(e *Expr, group *runGroup) (values []xr.Value, types []xr.Type, err error) {
+	run := ir.env.Run
+	run.PanicEnv = nil
+	defer func() {
+		if rec := recover(); rec != nil {
+			values, types = nil, nil
+			if group != nil && rec == base.SigInterrupt && group.isCancelled() {
+				err = group.err
+			} else {
+				err = run.panicError(ir.Comp.Fileset, rec)
+			}
+		}
+		run.PanicEnv = nil
+	}()
+	values, types = ir.runExpr(e, group)
+	return values, types, nil
+}
+
+// EvalE is Eval that returns errors as *EvalError instead of panicking
+func (ir *Interp) EvalE(src string) ([]xr.Value, []xr.Type, error) {
+	expr, err := ir.CompileE(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ir.RunE(expr)
+}
+
+// Eval1E is Eval1 that returns errors as *EvalError instead of panicking
+func (ir *Interp) Eval1E(src string) (xr.Value, xr.Type, error) {
+	expr, err := ir.CompileE(src)
+	if err != nil {
+		return xr.Value{}, nil, err
+	}
+	if expr == nil {
+		return None, nil, nil
+	}
+	if !expr.Const() && expr.NumOut() == 0 {
+		return xr.Value{}, nil, &EvalError{Kind: CompileError, Pos: ir.Comp.Position(), Msg: "expression returns no values"}
+	}
+	values, types, err := ir.RunE(expr)
+	if err != nil {
+		return xr.Value{}, nil, err
+	}
+	return values[0], types[0], nil
+}
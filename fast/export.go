@@ -0,0 +1,326 @@
+package fast
+
+import (
+	"fmt"
+	r "reflect"
+	"strings"
+
+	"github.com/WilliamNHarvey/gomacro/base"
+	xr "github.com/WilliamNHarvey/gomacro/xreflect"
+)
+
+// ExportAs converts value, usually created by interpreted code, to the compiled type rtype.
+//
+// Types created by interpreted code are emulated: named types become unnamed,
+// unexported struct fields are renamed and recursive types contain xreflect.Forward
+// i.e. interface{} in place of pointers, slices and maps - see doc/features-and-limitations.md.
+// ExportAs creates a deep copy of value with the structurally matching type rtype,
+// following pointers, slices, arrays, maps, structs and interfaces.
+// Struct fields are matched by name. Pointers and maps shared among parts of value,
+// including cycles, remain shared in the result.
+// Interpreted values converted to a compiled interface are wrapped in a proxy, if needed
+func (ir *Interp) ExportAs(value xr.Value, rtype r.Type) (ret r.Value, err error) {
+	defer catchConvertError(&err)
+	cv := ir.newConverter()
+	return cv.export(value.ReflectValue(), rtype), nil
+}
+
+// ImportAs is the inverse of ExportAs: it converts value, usually created by compiled code,
+// to the structurally matching type t, which may be emulated
+func (ir *Interp) ImportAs(value interface{}, t xr.Type) (ret xr.Value, err error) {
+	defer catchConvertError(&err)
+	cv := ir.newConverter()
+	return xr.MakeValue(cv.import_(r.ValueOf(value), t)), nil
+}
+
+// catchConvertError converts a panic into an error
+func catchConvertError(err *error) {
+	if rec := recover(); rec != nil {
+		if e, ok := rec.(error); ok {
+			*err = e
+		} else {
+			*err = fmt.Errorf("%v", rec)
+		}
+	}
+}
+
+type convertKey struct {
+	ptr uintptr
+	len int // for slices
+	t   r.Type
+}
+
+// deepConverter converts between emulated and compiled types,
+// remembering the pointers, maps and slices already converted
+type deepConverter struct {
+	c    *Comp
+	seen map[convertKey]r.Value
+}
+
+func (ir *Interp) newConverter() *deepConverter {
+	return &deepConverter{
+		c:    ir.Comp,
+		seen: make(map[convertKey]r.Value),
+	}
+}
+
+func (cv *deepConverter) errorf(format string, args ...interface{}) {
+	panic(fmt.Errorf(format, args...))
+}
+
+// export returns a deep copy of src converted to the compiled type rtype
+func (cv *deepConverter) export(src r.Value, rtype r.Type) r.Value {
+	// unwrap xr.Forward and other interfaces
+	var tsrc xr.Type
+	for src.Kind() == r.Interface {
+		src = src.Elem()
+	}
+	src, tsrc = fromEmulatedInterface(src)
+	if !src.IsValid() {
+		return r.Zero(rtype)
+	} else if src.Type() == rtype {
+		return src
+	}
+	switch rtype.Kind() {
+	case r.Interface:
+		if src.Type().Implements(rtype) {
+			ret := r.New(rtype).Elem()
+			ret.Set(src)
+			return ret
+		} else if tsrc != nil {
+			// interpreted type stored in an emulated interface:
+			// its methods are visible only to the interpreter
+			tout := cv.c.Universe.FromReflectType(rtype)
+			if tsrc.Implements(tout) {
+				return cv.c.Converter(tsrc, tout)(xr.MakeValue(src)).ReflectValue()
+			}
+		}
+	case r.Ptr:
+		if src.Kind() != r.Ptr {
+			break
+		} else if src.IsNil() {
+			return r.Zero(rtype)
+		}
+		key := convertKey{ptr: src.Pointer(), t: rtype}
+		if ret, ok := cv.seen[key]; ok {
+			return ret
+		}
+		ret := r.New(rtype.Elem())
+		cv.seen[key] = ret
+		ret.Elem().Set(cv.export(src.Elem(), rtype.Elem()))
+		return ret
+	case r.Map:
+		if src.Kind() != r.Map {
+			break
+		} else if src.IsNil() {
+			return r.Zero(rtype)
+		}
+		key := convertKey{ptr: src.Pointer(), t: rtype}
+		if ret, ok := cv.seen[key]; ok {
+			return ret
+		}
+		ret := r.MakeMapWithSize(rtype, src.Len())
+		cv.seen[key] = ret
+		iter := src.MapRange()
+		for iter.Next() {
+			ret.SetMapIndex(cv.export(iter.Key(), rtype.Key()), cv.export(iter.Value(), rtype.Elem()))
+		}
+		return ret
+	case r.Slice:
+		if src.Kind() != r.Slice {
+			break
+		} else if src.IsNil() {
+			return r.Zero(rtype)
+		}
+		key := convertKey{ptr: src.Pointer(), len: src.Len(), t: rtype}
+		if ret, ok := cv.seen[key]; ok {
+			return ret
+		}
+		ret := r.MakeSlice(rtype, src.Len(), src.Len())
+		cv.seen[key] = ret
+		for i, n := 0, src.Len(); i < n; i++ {
+			ret.Index(i).Set(cv.export(src.Index(i), rtype.Elem()))
+		}
+		return ret
+	case r.Array:
+		if src.Kind() != r.Array || src.Len() != rtype.Len() {
+			break
+		}
+		ret := r.New(rtype).Elem()
+		for i, n := 0, src.Len(); i < n; i++ {
+			ret.Index(i).Set(cv.export(src.Index(i), rtype.Elem()))
+		}
+		return ret
+	case r.Struct:
+		if src.Kind() != r.Struct {
+			break
+		}
+		src = addressable(src)
+		ret := r.New(rtype).Elem()
+		fields := matchFields(src.Type(), rtype)
+		if fields == nil {
+			break
+		}
+		for i, j := range fields {
+			accessible(ret.Field(i)).Set(cv.export(accessible(src.Field(j)), rtype.Field(i).Type))
+		}
+		return ret
+	case r.Chan, r.Func, r.UnsafePointer:
+		if src.Type().ConvertibleTo(rtype) {
+			return src.Convert(rtype)
+		}
+	default:
+		if src.Kind() == rtype.Kind() {
+			return src.Convert(rtype)
+		}
+	}
+	cv.errorf("cannot convert <%v> to <%v>", src.Type(), rtype)
+	return r.Value{}
+}
+
+// import_ returns a deep copy of src converted to the type t, which may be emulated
+func (cv *deepConverter) import_(src r.Value, t xr.Type) r.Value {
+	t = t.Resolve()
+	rtype := t.ReflectType()
+	for src.Kind() == r.Interface {
+		src = src.Elem()
+	}
+	if !src.IsValid() {
+		return r.Zero(rtype)
+	} else if src.Type() == rtype {
+		return src
+	}
+	switch t.Kind() {
+	case r.Interface:
+		if xr.IsEmulatedInterface(t) {
+			tin := cv.c.TypeOf(src.Interface())
+			if tin.Implements(t) {
+				return cv.c.Converter(tin, t)(xr.MakeValue(src)).ReflectValue()
+			}
+		} else if src.Type().Implements(rtype) {
+			ret := r.New(rtype).Elem()
+			ret.Set(src)
+			return ret
+		}
+	case r.Ptr:
+		if src.Kind() != r.Ptr {
+			break
+		} else if src.IsNil() {
+			return r.Zero(rtype)
+		}
+		key := convertKey{ptr: src.Pointer(), t: rtype}
+		if ret, ok := cv.seen[key]; ok {
+			return ret
+		}
+		ret := r.New(rtype.Elem())
+		cv.seen[key] = ret
+		ret.Elem().Set(cv.import_(src.Elem(), t.Elem()))
+		return ret
+	case r.Map:
+		if src.Kind() != r.Map {
+			break
+		} else if src.IsNil() {
+			return r.Zero(rtype)
+		}
+		key := convertKey{ptr: src.Pointer(), t: rtype}
+		if ret, ok := cv.seen[key]; ok {
+			return ret
+		}
+		ret := r.MakeMapWithSize(rtype, src.Len())
+		cv.seen[key] = ret
+		iter := src.MapRange()
+		for iter.Next() {
+			ret.SetMapIndex(cv.import_(iter.Key(), t.Key()), cv.import_(iter.Value(), t.Elem()))
+		}
+		return ret
+	case r.Slice:
+		if src.Kind() != r.Slice {
+			break
+		} else if src.IsNil() {
+			return r.Zero(rtype)
+		}
+		key := convertKey{ptr: src.Pointer(), len: src.Len(), t: rtype}
+		if ret, ok := cv.seen[key]; ok {
+			return ret
+		}
+		ret := r.MakeSlice(rtype, src.Len(), src.Len())
+		cv.seen[key] = ret
+		for i, n := 0, src.Len(); i < n; i++ {
+			ret.Index(i).Set(cv.import_(src.Index(i), t.Elem()))
+		}
+		return ret
+	case r.Array:
+		if src.Kind() != r.Array || src.Len() != t.Len() {
+			break
+		}
+		ret := r.New(rtype).Elem()
+		for i, n := 0, src.Len(); i < n; i++ {
+			ret.Index(i).Set(cv.import_(src.Index(i), t.Elem()))
+		}
+		return ret
+	case r.Struct:
+		if src.Kind() != r.Struct {
+			break
+		}
+		src = addressable(src)
+		ret := r.New(rtype).Elem()
+		fields := matchFields(src.Type(), rtype)
+		if fields == nil {
+			break
+		}
+		for i, j := range fields {
+			accessible(ret.Field(i)).Set(cv.import_(accessible(src.Field(j)), t.Field(i).Type))
+		}
+		return ret
+	case r.Chan, r.Func, r.UnsafePointer:
+		if src.Type().ConvertibleTo(rtype) {
+			return src.Convert(rtype)
+		}
+	default:
+		if src.Kind() == rtype.Kind() {
+			return src.Convert(rtype)
+		}
+	}
+	cv.errorf("cannot convert <%v> to <%v>", src.Type(), t)
+	return r.Value{}
+}
+
+// fromEmulatedInterface extracts the value and type stored in an emulated interface.
+// Returns v and nil if v is not an emulated interface
+func fromEmulatedInterface(v r.Value) (r.Value, xr.Type) {
+	if v.Kind() != r.Ptr {
+		return v, nil
+	}
+	if t := v.Type().Elem(); t.Kind() != r.Struct || t.NumField() == 0 ||
+		t.Field(0).Name != xr.StrGensymInterface || t.Field(0).Type != r.TypeOf(xr.InterfaceHeader{}) {
+		return v, nil
+	} else if v.IsNil() {
+		return r.Value{}, nil
+	}
+	val, t := xr.FromEmulatedInterface(xr.MakeValue(v))
+	return val.ReflectValue(), t
+}
+
+// matchFields returns, for each field of struct type dst, the index of the field
+// with the same name in struct type src. Names of unexported fields in types created
+// by the interpreter are mangled: they are compared after removing base.StrGensymPrivate.
+// Returns nil if the fields do not match
+func matchFields(src r.Type, dst r.Type) []int {
+	n := dst.NumField()
+	if src.NumField() != n {
+		return nil
+	}
+	index := make(map[string]int, n)
+	for j := 0; j < n; j++ {
+		index[strings.TrimPrefix(src.Field(j).Name, base.StrGensymPrivate)] = j
+	}
+	ret := make([]int, n)
+	for i := 0; i < n; i++ {
+		j, ok := index[strings.TrimPrefix(dst.Field(i).Name, base.StrGensymPrivate)]
+		if !ok {
+			return nil
+		}
+		ret[i] = j
+	}
+	return ret
+}
@@ -178,7 +178,7 @@ func (c *Comp) Expr1OrType(expr ast.Expr) (e *Expr, t xr.Type) {
 			for o := c; o != nil; o = o.Outer {
 				bind, okb := o.Binds[name]
 				var okt bool
-				if okb && (GENERICS_V1_CXX() || GENERICS_V2_CTI()) {
+				if okb {
 					_, okt = bind.Value.(*GenericType) // generic types are stored in Comp.Bind[]
 					okb = !okt
 				}
@@ -189,12 +189,14 @@ func (c *Comp) Expr1OrType(expr ast.Expr) (e *Expr, t xr.Type) {
 				}
 			}
 		case *ast.IndexExpr:
-			if GENERICS_V1_CXX() || GENERICS_V2_CTI() {
-				if lit, ok := n.Index.(*ast.CompositeLit); ok && lit.Type == nil {
-					// foo#[a, b...] can be a generic function or a generic type
-					node = n.X
-					continue
-				}
+			if lit, ok := n.Index.(*ast.CompositeLit); ok && lit.Type == nil {
+				// foo#[a, b...] can be a generic function or a generic type
+				node = n.X
+				continue
+			} else if ident, ok := n.X.(*ast.Ident); ok && c.isGeneric(ident.Name) {
+				// foo[a] can be a generic function or a generic type
+				node = n.X
+				continue
 			}
 		}
 		break
@@ -214,10 +216,8 @@ func (c *Comp) Expr1OrType(expr ast.Expr) (e *Expr, t xr.Type) {
 // IndexExpr compiles a read operation on obj[idx]
 // or a generic function name#[T1, T2...]
 func (c *Comp) IndexExpr(node *ast.IndexExpr) *Expr {
-	if GENERICS_V1_CXX() || GENERICS_V2_CTI() {
-		if e := c.GenericFunc(node); e != nil {
-			return e
-		}
+	if e := c.GenericFunc(node); e != nil {
+		return e
 	}
 	return c.indexExpr(node, true)
 }
@@ -225,10 +225,8 @@ func (c *Comp) IndexExpr(node *ast.IndexExpr) *Expr {
 // IndexExpr1 compiles a single-valued read operation on obj[idx]
 // or a generic function name#[T1, T2...]
 func (c *Comp) IndexExpr1(node *ast.IndexExpr) *Expr {
-	if GENERICS_V1_CXX() || GENERICS_V2_CTI() {
-		if e := c.GenericFunc(node); e != nil {
-			return e
-		}
+	if e := c.GenericFunc(node); e != nil {
+		return e
 	}
 	return c.indexExpr(node, false)
 }
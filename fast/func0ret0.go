@@ -35,6 +35,23 @@ func (c *Comp) func0ret0(t xr.Type, m *funcMaker) func(env *Env) xr.Value {
 
 	nbind := m.nbind
 	nintbind := m.nintbind
+	if m.recovers {
+		return func(env *Env) xr.Value {
+			env.MarkUsedByClosure()
+			return xr.ValueOf(func() {
+				env := newEnv4Func(env, nbind, nintbind, debugC)
+				// Go recover() only works if invoked directly by the deferred function:
+				// if compiled code deferred this function, recover the panic here
+				// and pass it to the interpreted recover()
+				if rec := recover(); rec != nil {
+					defer exitCompiledDefer(enterCompiledDefer(env, rec))
+				}
+				funcbody(env)
+
+				env.freeEnv4Func()
+			})
+		}
+	}
 	return func(env *Env) xr.Value {
 		// function is closed over the env used to DECLARE it
 		env.MarkUsedByClosure()
@@ -33,6 +33,7 @@ type funcMaker struct {
 	Result    []*Bind
 	resultfun []I
 	funcbody  func(*Env)
+	recovers  bool // true if the function body calls recover()
 }
 
 // DeclFunc compiles a function, macro or method declaration
@@ -50,7 +51,7 @@ func (c *Comp) DeclFunc(funcdecl *ast.FuncDecl) {
 			c.methodDecl(funcdecl)
 			return
 		default:
-			if GENERICS_V1_CXX() || GENERICS_V2_CTI() {
+			if lit, _ := funcdecl.Recv.List[1].Type.(*ast.CompositeLit); lit != nil {
 				c.DeclGenericFunc(funcdecl)
 				return
 			}
@@ -87,6 +88,7 @@ func (c *Comp) DeclFunc(funcdecl *ast.FuncDecl) {
 
 	if body := funcdecl.Body; body != nil {
 		// in Go, function arguments/results and function body are in the same scope
+		cf.declLabels(body.List)
 		for _, node := range body.List {
 			cf.Stmt(node)
 		}
@@ -99,7 +101,7 @@ func (c *Comp) DeclFunc(funcdecl *ast.FuncDecl) {
 		return
 	}
 	// do NOT keep a reference to compile environment!
-	funcbody := cf.Code.Exec()
+	funcbody := cf.execCode(funcname, funcdecl.Pos(), true)
 
 	var stmt Stmt
 	if ismacro {
@@ -166,43 +168,32 @@ func (c *Comp) methodDecl(funcdecl *ast.FuncDecl) {
 			n, funcdecl.Recv, funcdecl.Name)
 		return
 	}
-	recvdecl := funcdecl.Recv.List[0]
-
-	functype := funcdecl.Type
-	t, paramnames, resultnames := c.TypeFunctionOrMethod(recvdecl, functype)
-
-	// gtype := t.GoType().Underlying().(*types.Signature)
-	// c.Debugf("declaring method (%v).%s%s %s\n\treflect.Type: <%v>", gtype.Recv().Type(), funcdecl.Name.Name, gtype.Params(), gtype.Results(), t.ReflectType())
+	recvtype := funcdecl.Recv.List[0].Type
+	if star, ok := recvtype.(*ast.StarExpr); ok {
+		recvtype = star.X
+	}
+	if index, ok := recvtype.(*ast.IndexExpr); ok {
+		// the receiver of a method on a generic type always declares type parameters,
+		// even if their names are already declared in an outer scope
+		if name, _, _ := splitGenericArgs(index); len(name) != 0 && c.isGeneric(name) {
+			c.DeclGenericMethod(funcdecl, index)
+			return
+		}
+	}
+	t, paramnames, resultnames := c.methodType(funcdecl)
 
 	// declare the method name and type before compiling its body: allows recursive methods
 	methodindex, methods := c.methodAdd(funcdecl, t)
 
-	cf := NewComp(c, nil)
-	info, resultfuns := cf.funcBinds(funcdecl.Name.Name, functype, t, paramnames, resultnames)
-	cf.Func = info
-
-	body := funcdecl.Body
-	if body != nil && len(body.List) != 0 {
-		// in Go, function arguments/results and function body are in the same scope
-		cf.List(body.List)
-	}
-	// do NOT keep a reference to compile environment!
-	funcbody := cf.Code.Exec()
-	f := cf.funcCreate(t, info, resultfuns, funcbody)
+	methodname, f := c.methodBody(funcdecl, t, paramnames, resultnames)
 
 	// a method declaration is a statement:
 	// executing it sets the method value in the receiver type
 	var stmt Stmt
 	if c.Options&base.OptDebugMethod != 0 {
-		trecv := t.In(0)
-		tname := trecv.Name()
-		if len(tname) == 0 && trecv.Kind() == r.Ptr {
-			tname = trecv.Elem().Name()
-		}
-		methodname := funcdecl.Name
 		stmt = func(env *Env) (Stmt, *Env) {
 			(*methods)[methodindex] = f(env).ReflectValue()
-			env.Run.Debugf("implemented method %s.%s", tname, methodname)
+			env.Run.Debugf("implemented method %s", methodname)
 			env.IP++
 			return env.Code[env.IP], env
 		}
@@ -216,6 +207,43 @@ func (c *Comp) methodDecl(funcdecl *ast.FuncDecl) {
 	c.Append(stmt, funcdecl.Pos())
 }
 
+// methodType compiles the type of a method, including its receiver
+func (c *Comp) methodType(funcdecl *ast.FuncDecl) (t xr.Type, paramnames []string, resultnames []string) {
+	t, paramnames, resultnames = c.TypeFunctionOrMethod(funcdecl.Recv.List[0], funcdecl.Type)
+
+	// gtype := t.GoType().Underlying().(*types.Signature)
+	// c.Debugf("declaring method (%v).%s%s %s\n\treflect.Type: <%v>", gtype.Recv().Type(), funcdecl.Name.Name, gtype.Params(), gtype.Results(), t.ReflectType())
+	return t, paramnames, resultnames
+}
+
+// methodBody compiles the body of a method whose type is t.
+// returns the method name as Type.Method, and a function that creates the method
+// when evaluated at runtime in the *Env where the method is declared
+func (c *Comp) methodBody(funcdecl *ast.FuncDecl, t xr.Type, paramnames []string, resultnames []string) (string, func(*Env) xr.Value) {
+	cf := NewComp(c, nil)
+	info, resultfuns := cf.funcBinds(funcdecl.Name.Name, funcdecl.Type, t, paramnames, resultnames)
+	cf.Func = info
+
+	body := funcdecl.Body
+	if body != nil && len(body.List) != 0 {
+		// in Go, function arguments/results and function body are in the same scope
+		cf.List(body.List)
+	}
+	methodname := methodName(t.In(0), funcdecl.Name.Name)
+	// do NOT keep a reference to compile environment!
+	funcbody := cf.execCode(methodname, funcdecl.Pos(), true)
+	return methodname, cf.funcCreate(t, info, resultfuns, funcbody)
+}
+
+// methodName returns the name of a method as Type.Method
+func methodName(trecv xr.Type, name string) string {
+	tname := trecv.Name()
+	if len(tname) == 0 && trecv.Kind() == r.Ptr {
+		tname = trecv.Elem().Name()
+	}
+	return tname + "." + name
+}
+
 // FuncLit compiles a function literal, i.e. a closure.
 // For functions or methods declarations, use FuncDecl()
 func (c *Comp) FuncLit(funclit *ast.FuncLit) *Expr {
@@ -232,7 +260,7 @@ func (c *Comp) FuncLit(funclit *ast.FuncLit) *Expr {
 		cf.List(body.List)
 	}
 	// do NOT keep a reference to compile environment!
-	funcbody := cf.Code.Exec()
+	funcbody := cf.execCode("", funclit.Pos(), true)
 
 	f := cf.funcCreate(t, info, resultfuns, funcbody)
 
@@ -326,6 +354,7 @@ func (c *Comp) funcMaker(info *FuncInfo, resultfuns []I, funcbody func(*Env)) *f
 		Result:    info.Result,
 		resultfun: resultfuns,
 		funcbody:  funcbody,
+		recovers:  info.Recovers,
 	}
 	c.FuncMaker = m // store it for debugger command 'backtrace'
 	return m
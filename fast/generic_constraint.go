@@ -0,0 +1,230 @@
+package fast
+
+import (
+	"go/ast"
+	"go/token"
+	r "reflect"
+
+	"github.com/WilliamNHarvey/gomacro/go/types"
+	xr "github.com/WilliamNHarvey/gomacro/xreflect"
+)
+
+// typeTerm is a single term T or ~T of a type union
+type typeTerm struct {
+	tilde bool
+	typ   xr.Type
+}
+
+// typeConstraint is the compiled form of a Go 1.18 type constraint,
+// i.e. an interface that may also contain type unions and 'comparable'
+type typeConstraint struct {
+	comparable bool
+	methods    []xr.Type    // interfaces the type argument must implement
+	unions     [][]typeTerm // type argument must match at least one term of each union
+}
+
+func (term typeTerm) matches(t xr.Type) bool {
+	if term.tilde {
+		return types.Identical(t.GoType().Underlying(), term.typ.GoType().Underlying())
+	}
+	return t.IdenticalTo(term.typ)
+}
+
+func (tc *typeConstraint) merge(other *typeConstraint) {
+	tc.comparable = tc.comparable || other.comparable
+	tc.methods = append(tc.methods, other.methods...)
+	tc.unions = append(tc.unions, other.unions...)
+}
+
+// return true if the constraint is simply a type union,
+// i.e. it can be flattened into the terms of an enclosing union
+func (tc *typeConstraint) isUnion() bool {
+	return !tc.comparable && len(tc.methods) == 0 && len(tc.unions) == 1
+}
+
+// check that t satisfies the constraint. returns a description of the failure, or "" on success
+func (tc *typeConstraint) check(t xr.Type) string {
+	if tc.comparable && !t.Comparable() {
+		return "not comparable"
+	}
+	for _, iface := range tc.methods {
+		if !t.Implements(iface) {
+			return "missing methods of " + iface.String()
+		}
+	}
+	for _, union := range tc.unions {
+		found := false
+		for _, term := range union {
+			if term.matches(t) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "not in the type set"
+		}
+	}
+	return ""
+}
+
+// checkConstraints verifies that generic arguments satisfy the constraints
+// of the corresponding generic params. Generic params must be already declared in c
+func (c *Comp) checkConstraints(constraints []ast.Expr, vals []I, types []xr.Type) {
+	for i, constraint := range constraints {
+		if constraint == nil || vals[i] != nil {
+			// no constraint, or C++-style generic constant argument
+			continue
+		}
+		tc := c.typeConstraint(constraint)
+		if tc == nil {
+			continue
+		}
+		if msg := tc.check(types[i]); len(msg) != 0 {
+			c.Errorf("%v does not satisfy %v (%s)", types[i], constraint, msg)
+		}
+	}
+}
+
+// typeConstraint compiles a type constraint. Returns nil if it accepts any type
+func (c *Comp) typeConstraint(node ast.Expr) *typeConstraint {
+	switch node := node.(type) {
+	case *ast.ParenExpr:
+		return c.typeConstraint(node.X)
+	case *ast.BinaryExpr, *ast.UnaryExpr:
+		return &typeConstraint{unions: [][]typeTerm{c.typeTerms(node, nil)}}
+	case *ast.InterfaceType:
+		return c.interfaceConstraint(node)
+	}
+	t := c.constraintType(node)
+	if tc := c.lookupConstraint(t); tc != nil {
+		return tc
+	}
+	if t.Kind() != r.Interface {
+		// a single type, as in [T int]
+		return &typeConstraint{unions: [][]typeTerm{{{typ: t}}}}
+	} else if t.NumMethod() == 0 {
+		return nil
+	}
+	return &typeConstraint{methods: []xr.Type{t}}
+}
+
+// constraintType compiles a type that is allowed to be, or to contain, a type constraint
+func (c *Comp) constraintType(node ast.Expr) xr.Type {
+	c.inConstraint++
+	defer func() {
+		c.inConstraint--
+	}()
+	return c.Type(node)
+}
+
+// typeTerms compiles the type union T1 | ~T2 | ...
+func (c *Comp) typeTerms(node ast.Expr, terms []typeTerm) []typeTerm {
+	switch n := node.(type) {
+	case *ast.ParenExpr:
+		return c.typeTerms(n.X, terms)
+	case *ast.BinaryExpr:
+		if n.Op == token.OR {
+			terms = c.typeTerms(n.X, terms)
+			return c.typeTerms(n.Y, terms)
+		}
+	case *ast.UnaryExpr:
+		if n.Op == token.TILDE {
+			t := c.constraintType(n.X)
+			if gt := t.GoType(); gt != gt.Underlying() {
+				c.Errorf("invalid use of ~ (underlying type of %v is %v): %v", t, gt.Underlying(), node)
+			}
+			return append(terms, typeTerm{tilde: true, typ: t})
+		}
+	}
+	t := c.constraintType(node)
+	if tc := c.lookupConstraint(t); tc != nil {
+		if !tc.isUnion() {
+			c.Errorf("cannot use %v in union: it contains methods or comparable", node)
+		}
+		return append(terms, tc.unions[0]...)
+	}
+	return append(terms, typeTerm{typ: t})
+}
+
+// interfaceConstraint compiles an interface used as type constraint.
+// Returns nil if it accepts any type
+func (c *Comp) interfaceConstraint(node *ast.InterfaceType) *typeConstraint {
+	if node.Methods == nil {
+		return nil
+	}
+	var tc typeConstraint
+	var methods []*ast.Field
+	for _, field := range node.Methods.List {
+		if len(field.Names) != 0 {
+			methods = append(methods, field)
+			continue
+		}
+		switch field.Type.(type) {
+		case *ast.BinaryExpr, *ast.UnaryExpr:
+			tc.unions = append(tc.unions, c.typeTerms(field.Type, nil))
+			continue
+		}
+		t := c.constraintType(field.Type)
+		if other := c.lookupConstraint(t); other != nil {
+			tc.merge(other)
+		} else if t.Kind() == r.Interface {
+			methods = append(methods, field)
+		} else {
+			tc.unions = append(tc.unions, []typeTerm{{typ: t}})
+		}
+	}
+	if len(methods) != 0 {
+		iface := c.TypeInterface(&ast.InterfaceType{Methods: &ast.FieldList{List: methods}})
+		if iface.NumMethod() != 0 {
+			tc.methods = append(tc.methods, iface)
+		}
+	}
+	if !tc.comparable && len(tc.methods) == 0 && len(tc.unions) == 0 {
+		return nil
+	}
+	return &tc
+}
+
+// isTypeElem returns true if field is a type element i.e. T1 | ~T2,
+// which can only appear in interfaces used as type constraints
+func isTypeElem(field *ast.Field) bool {
+	if len(field.Names) != 0 {
+		return false
+	}
+	switch node := field.Type.(type) {
+	case *ast.BinaryExpr:
+		return node.Op == token.OR
+	case *ast.UnaryExpr:
+		return node.Op == token.TILDE
+	}
+	return false
+}
+
+// isGeneric returns true if name is a generic function or generic type
+func (c *Comp) isGeneric(name string) bool {
+	sym, _ := c.tryResolveGeneric(name)
+	if sym == nil {
+		return false
+	}
+	class := sym.Desc.Class()
+	return class == GenericFuncBind || class == GenericTypeBind
+}
+
+// declConstraint remembers that named interface t is a type constraint
+// i.e. it contains type elements or embeds 'comparable'
+func (c *Comp) declConstraint(t xr.Type, node *ast.InterfaceType) {
+	tc := c.interfaceConstraint(node)
+	if tc == nil || (len(tc.unions) == 0 && !tc.comparable) {
+		// an ordinary interface
+		return
+	}
+	c.constraints[xr.MakeKey(t)] = tc
+}
+
+// lookupConstraint returns the constraint associated to named interface t, or nil
+func (c *Comp) lookupConstraint(t xr.Type) *typeConstraint {
+	if t == nil || t.Kind() != r.Interface || len(t.Name()) == 0 {
+		return nil
+	}
+	return c.constraints[xr.MakeKey(t)]
+}
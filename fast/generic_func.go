@@ -35,9 +35,10 @@ type GenericFuncInstance struct {
 // a generic function declaration.
 // either general, or partially specialized or fully specialized
 type GenericFuncDecl struct {
-	Decl   *ast.FuncLit // generic function declaration. use a *ast.FuncLit because we will compile it with Comp.FuncLit()
-	Params []string     // generic param names
-	For    []ast.Expr   // partial or full specialization
+	Decl        *ast.FuncLit // generic function declaration. use a *ast.FuncLit because we will compile it with Comp.FuncLit()
+	Params      []string     // generic param names
+	Constraints []ast.Expr   // generic param constraints. nil means any type
+	For         []ast.Expr   // partial or full specialization
 }
 
 // generic function
@@ -46,6 +47,7 @@ type GenericFunc struct {
 	Special   map[string]GenericFuncDecl // partially or fully specialized declarations. key is GenericFuncDecl.For converted to string
 	Instances map[I]*GenericFuncInstance // cache of instantiated functions. key is [N]interface{}{T1, T2...}
 	DeclScope *Comp                      // scope where generic function is declared
+	DeclEnv   *Env                       // if not nil, runtime environment where generic function is declared. used by imported generic functions
 }
 
 func (f *GenericFunc) Pos() token.Pos {
@@ -147,15 +149,16 @@ func (c *Comp) DeclGenericFunc(decl *ast.FuncDecl) {
 			decl.Recv.List[1].Type, decl)
 	}
 
-	params, fors := c.genericParams(lit.Elts, "function or method", decl)
+	params, constraints, fors := c.genericParams(lit.Elts, "function or method", decl)
 
 	fdecl := GenericFuncDecl{
 		Decl: &ast.FuncLit{
 			Type: decl.Type,
 			Body: decl.Body,
 		},
-		Params: params,
-		For:    fors,
+		Params:      params,
+		Constraints: constraints,
+		For:         fors,
 	}
 	name := decl.Name.Name
 
@@ -247,6 +250,13 @@ func (c *Comp) genericFunc(maker *genericMaker, node ast.Node) *Expr {
 		g.Debugf("generic function: %v, upn = %v, instance = %v", maker, upn, instance)
 	}
 	// switch to the correct *Env before evaluating expr
+	if declEnv := fun.DeclEnv; declEnv != nil {
+		// imported generic function: its *Env is not an outer *Env of the caller
+		retfun = func(*Env) xr.Value {
+			return efun(declEnv)
+		}
+		return exprFun(instance.Type, retfun)
+	}
 	switch upn {
 	case 0:
 		retfun = efun
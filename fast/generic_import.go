@@ -0,0 +1,115 @@
+package fast
+
+import (
+	"bytes"
+	"go/ast"
+	"sort"
+	"strings"
+
+	"github.com/WilliamNHarvey/gomacro/base/genimport"
+	"github.com/WilliamNHarvey/gomacro/gls"
+	xr "github.com/WilliamNHarvey/gomacro/xreflect"
+)
+
+// loadGenerics compiles the source code of the generic functions and types
+// exported by a compiled package, and adds them to imp.Binds.
+// Errors are reported as warnings: the rest of the package remains usable
+func (c *Comp) loadGenerics(imp *Import, pkgref *genimport.PackageRef) {
+	if pkgref == nil || len(pkgref.Generics) == 0 {
+		return
+	}
+	ir := c.newGenericsInterp(imp)
+	defer func() {
+		if rec := recover(); rec != nil {
+			c.Warnf("skipping import of generic functions and types from package %q: %v", imp.Path, rec)
+		}
+	}()
+	// generic code may use the non-generic declarations of its own package
+	ir.Comp.declDotImport0(imp)
+	ir.apply()
+
+	sources := pkgref.Generics
+	if src := sources[genimport.GenericsImportKey]; len(src) != 0 {
+		ir.RunExpr(ir.Compile(src))
+	}
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		if name != genimport.GenericsImportKey {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for _, name := range names {
+		buf.WriteString(sources[name])
+		buf.WriteString("\n\n")
+	}
+	// declarations may appear in any order: Comp.Compile() sorts them
+	ir.RunExpr(ir.Compile(buf.String()))
+
+	for name, bind := range ir.Comp.Binds {
+		if !ast.IsExported(name) {
+			continue
+		}
+		switch value := bind.Value.(type) {
+		case *GenericFunc:
+			value.DeclEnv = ir.env
+		case *GenericType:
+		default:
+			continue
+		}
+		imp.Binds[name] = bind
+	}
+}
+
+// newGenericsInterp creates the interpreter used to compile
+// generic functions and types imported from a compiled package
+func (c *Comp) newGenericsInterp(imp *Import) *Interp {
+	top := c.TopComp()
+	run := c.glsGet(gls.GoID())
+	if run == nil {
+		run = &Run{IrGlobals: c.IrGlobals, goid: gls.GoID()}
+		run.glsStore()
+	}
+	env := &Env{
+		EnvBinds: EnvBinds{
+			Vals: make([]xr.Value, top.BindNum),
+			Ints: make([]uint64, top.IntBindNum),
+		},
+		Run:           run,
+		UsedByClosure: true, // do not try to recycle this Env
+	}
+	ir := NewInnerInterp(&Interp{top, env}, imp.Name, imp.Path)
+	ir.env.UsedByClosure = true
+	return ir
+}
+
+// tryResolveGeneric resolves the name of a generic function or type.
+// Also accepts qualified names pkg.Name of generic functions and types
+// imported from compiled packages
+func (c *Comp) tryResolveGeneric(name string) (*Symbol, *Comp) {
+	dot := strings.IndexByte(name, '.')
+	if dot < 0 {
+		return c.tryResolve(name)
+	}
+	sym, _ := c.tryResolve(name[:dot])
+	if sym == nil || sym.Desc.Class() != ConstBind {
+		return nil, nil
+	}
+	imp, _ := sym.Value.(*Import)
+	if imp == nil {
+		return nil, nil
+	}
+	c.checkSymbol(imp, name[dot+1:])
+	bind := imp.Binds[name[dot+1:]]
+	if bind == nil {
+		return nil, nil
+	}
+	switch value := bind.Value.(type) {
+	case *GenericFunc:
+		return bind.AsSymbol(0), value.DeclScope
+	case *GenericType:
+		return bind.AsSymbol(0), value.DeclScope
+	}
+	return nil, nil
+}
@@ -111,9 +111,7 @@ func (c *Comp) inferGenericFunc(call *ast.CallExpr, fun *Expr, args []*Expr) *Ex
 			}
 		}
 	}
-	if variadic && !ellipsis {
-		c.Errorf("unimplemented type inference on variadic generic function: %v", call)
-	} else if !variadic && ellipsis {
+	if !variadic && ellipsis {
 		c.Errorf("invalid use of ... in call to non-variadic generic function: %v", call)
 	}
 
@@ -137,6 +135,15 @@ func (c *Comp) inferGenericFunc(call *ast.CallExpr, fun *Expr, args []*Expr) *Ex
 			}
 		}
 	}
+	if variadic && !ellipsis && nargs >= len(patterns)-1 {
+		// match each variadic argument against the element type of the last param
+		n := len(patterns) - 1
+		elt := patterns[n].(*ast.Ellipsis).Elt
+		patterns = patterns[:n]
+		for i := n; i < nargs; i++ {
+			patterns = append(patterns, elt)
+		}
+	}
 	if nargs != len(patterns) {
 		c.Errorf("generic function %v has %d params, cannot call with %d values: %v", tfun, len(patterns), nargs, call)
 	}
@@ -180,7 +187,21 @@ func (inf *inferFuncType) args() (vals []I, types []xr.Type) {
 		}
 	}
 
-	params := inf.tfun.Master.Params
+	// third pass: constraints with a core type, as E in [S ~[]E, E any]
+	master := inf.tfun.Master
+	for i, constraint := range master.Constraints {
+		tilde, ok := constraint.(*ast.UnaryExpr)
+		if !ok || tilde.Op != token.TILDE {
+			continue
+		} else if _, ok := tilde.X.(*ast.Ident); ok {
+			continue
+		}
+		if inferred := inf.inferred[master.Params[i]]; inferred.Type != nil {
+			inf.arg(tilde.X, inferred.Type, exact)
+		}
+	}
+
+	params := master.Params
 	n := len(params)
 	vals = make([]I, n)
 	types = make([]xr.Type, n)
@@ -75,6 +75,7 @@ func (special *genericFuncCandidate) injectBinds(c *Comp) {
 			c.declTypeAlias(name, t)
 		}
 	}
+	c.checkConstraints(special.decl.Constraints, special.vals, special.types)
 }
 
 func (special *genericTypeCandidate) injectBinds(c *Comp) {
@@ -86,6 +87,7 @@ func (special *genericTypeCandidate) injectBinds(c *Comp) {
 			c.declTypeAlias(name, t)
 		}
 	}
+	c.checkConstraints(special.decl.Constraints, special.vals, special.types)
 }
 
 // return the qualified name of the function or type to instantiate, for example "Pair#[int,string]"
@@ -112,18 +114,22 @@ func (maker *genericMaker) String() string {
 }
 
 func (c *Comp) genericMaker(node *ast.IndexExpr, which BindClass) *genericMaker {
-	name, genericArgs, ok := splitGenericArgs(node)
-	if !ok {
+	name, genericArgs, explicit := splitGenericArgs(node)
+	if len(name) == 0 {
 		return nil
 	}
-	sym, upc := c.tryResolve(name)
+	sym, upc := c.tryResolveGeneric(name)
 	if sym == nil {
+		if !explicit {
+			// could be an ordinary index expression, let the caller report the error
+			return nil
+		}
 		c.Errorf("undefined identifier: %v", name)
 	}
 	n := len(genericArgs)
 	var params []string
 	ifun := sym.Value
-	ok = false
+	ok := false
 	if ifun != nil && sym.Desc.Class() == which {
 		switch which {
 		case GenericFuncBind:
@@ -141,6 +147,10 @@ func (c *Comp) genericMaker(node *ast.IndexExpr, which BindClass) *genericMaker
 		}
 	}
 	if !ok {
+		if !explicit {
+			// name[arg] is an ordinary index expression
+			return nil
+		}
 		c.Errorf("symbol is not a %v, cannot use #[...] on it: %s", which, name)
 	}
 	if n != len(params) {
@@ -227,23 +237,48 @@ func (c *Comp) constToAstExpr(val interface{}, pos token.Pos) ast.Expr {
 	}
 }
 
-func splitGenericArgs(node *ast.IndexExpr) (string, []ast.Expr, bool) {
-	if ident, _ := node.X.(*ast.Ident); ident != nil {
-		cindex, _ := node.Index.(*ast.CompositeLit)
-		if cindex != nil && cindex.Type == nil {
-			return ident.Name, cindex.Elts, true
+// split name#[T1,T2...] or name[T1,T2...] into name and generic arguments.
+// explicit is true if node is surely a generic instantiation,
+// and false if node is name[arg] i.e. it may also be an ordinary index expression
+func splitGenericArgs(node *ast.IndexExpr) (name string, args []ast.Expr, explicit bool) {
+	switch x := node.X.(type) {
+	case *ast.Ident:
+		name = x.Name
+	case *ast.SelectorExpr:
+		// generic function or type imported from a compiled package, as pkg.Name[T]
+		if pkg, _ := x.X.(*ast.Ident); pkg != nil {
+			name = pkg.Name + "." + x.Sel.Name
 		}
 	}
-	return "", nil, false
+	if len(name) == 0 {
+		return "", nil, false
+	}
+	cindex, _ := node.Index.(*ast.CompositeLit)
+	if cindex != nil && cindex.Type == nil {
+		return name, cindex.Elts, true
+	}
+	return name, []ast.Expr{node.Index}, false
 }
 
-func (c *Comp) genericParams(params []ast.Expr, errlabel string, node ast.Node) ([]string, []ast.Expr) {
+// return the generic param names, their constraints and the partial or full specialization.
+// a nil constraint means the generic param accepts any type
+func (c *Comp) genericParams(params []ast.Expr, errlabel string, node ast.Node) ([]string, []ast.Expr, []ast.Expr) {
 	names := make([]string, 0, len(params))
-	var exprs []ast.Expr
+	var constraints, exprs []ast.Expr
 	for i, param := range params {
 		switch param := param.(type) {
 		case *ast.Ident:
 			names = append(names, param.Name)
+			constraints = append(constraints, nil)
+		case *ast.KeyValueExpr:
+			// generic param with constraint, i.e. T: C or T C
+			if ident, ok := param.Key.(*ast.Ident); ok {
+				names = append(names, ident.Name)
+				constraints = append(constraints, param.Value)
+				break
+			}
+			c.Errorf("invalid generic %s declaration: generic parameter %d should be an identifier, found %T: %v",
+				errlabel, i, param.Key, node)
 		case *ast.BadExpr:
 		case *ast.CompositeLit:
 			exprs = param.Elts
@@ -252,7 +287,7 @@ func (c *Comp) genericParams(params []ast.Expr, errlabel string, node ast.Node)
 				errlabel, i, param, node)
 		}
 	}
-	return names, exprs
+	return names, constraints, exprs
 }
 
 // return the most specialized function declaration applicable to used params.
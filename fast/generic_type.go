@@ -18,8 +18,11 @@ package fast
 
 import (
 	"bytes"
+	"fmt"
 	"go/ast"
 	"go/token"
+	r "reflect"
+	"sort"
 
 	"github.com/WilliamNHarvey/gomacro/base"
 	"github.com/WilliamNHarvey/gomacro/base/output"
@@ -29,16 +32,43 @@ import (
 // a generic type declaration.
 // either general, or partially specialized or fully specialized
 type GenericTypeDecl struct {
-	Decl   ast.Expr   // type declaration body. use an ast.Expr because we will compile it with Comp.Type()
-	Alias  bool       // true if declaration is an alias: 'type Foo = ...'
-	Params []string   // generic param names
-	For    []ast.Expr // for partial or full specialization
+	Decl        ast.Expr   // type declaration body. use an ast.Expr because we will compile it with Comp.Type()
+	Alias       bool       // true if declaration is an alias: 'type Foo = ...'
+	Params      []string   // generic param names
+	Constraints []ast.Expr // generic param constraints. nil means any type
+	For         []ast.Expr // for partial or full specialization
 }
 
 type GenericType struct {
 	Master    GenericTypeDecl            // master (i.e. non specialized) declaration
 	Special   map[string]GenericTypeDecl // partially or fully specialized declarations. key is TemplateTypeDecl.For converted to string
 	Instances map[I]xr.Type              // cache of instantiated types. key is [N]interface{}{T1, T2...}
+	DeclScope *Comp                      // scope where generic type is declared
+	Methods   map[string]*GenericMethod  // methods declared on the generic type
+	instances []*genericTypeInstance     // instantiated named types, in order of instantiation
+}
+
+// a method declared on a generic type, as func (s *Stack[T]) Push(v T).
+// it is compiled for each instantiated type
+type GenericMethod struct {
+	Decl      *ast.FuncDecl
+	Params    []string // names of the receiver type parameters, as T above
+	DeclEnv   *Env     // *Env where the method declaration was executed. nil until then
+	instances []*genericMethodInstance
+}
+
+// an instantiated generic type, and its generic arguments
+type genericTypeInstance struct {
+	t     xr.Type
+	vals  []I
+	types []xr.Type
+}
+
+// a method compiled for an instantiated generic type
+type genericMethodInstance struct {
+	fun     func(*Env) xr.Value // creates the method when evaluated in GenericMethod.DeclEnv
+	methods *[]r.Value
+	index   int
 }
 
 func (t *GenericType) Pos() token.Pos {
@@ -117,13 +147,14 @@ func (c *Comp) DeclGenericType(spec *ast.TypeSpec) {
 		c.Errorf("invalid generic type declaration: expecting an *ast.CompositeLit, found &ast.CompositeLit{Type: &ast.CompositeLit{}}: %v",
 			spec)
 	}
-	params, fors := c.genericParams(lit.Elts, "type", spec)
+	params, constraints, fors := c.genericParams(lit.Elts, "type", spec)
 
 	tdecl := GenericTypeDecl{
-		Decl:   lit.Type,
-		Alias:  spec.Assign != token.NoPos,
-		Params: params,
-		For:    fors,
+		Decl:        lit.Type,
+		Alias:       spec.Assign != token.NoPos,
+		Params:      params,
+		Constraints: constraints,
+		For:         fors,
 	}
 	name := spec.Name.Name
 
@@ -141,6 +172,7 @@ func (c *Comp) DeclGenericType(spec *ast.TypeSpec) {
 			Master:    tdecl,
 			Special:   make(map[string]GenericTypeDecl),
 			Instances: make(map[I]xr.Type),
+			DeclScope: c,
 		}
 		return
 	}
@@ -168,6 +200,7 @@ func (c *Comp) DeclGenericType(spec *ast.TypeSpec) {
 func (c *Comp) GenericType(node *ast.IndexExpr) xr.Type {
 	maker := c.genericMaker(node, GenericTypeBind)
 	if maker == nil {
+		c.Errorf("not a generic type: %v", node.X)
 		return nil
 	}
 	typ := maker.ifun.(*GenericType)
@@ -233,6 +266,10 @@ func (maker *genericMaker) instantiateType(typ *GenericType, node *ast.IndexExpr
 		typ.Instances[key] = t
 		u := c.Type(special.decl.Decl)
 		c.SetUnderlyingType(t, u)
+
+		inst := &genericTypeInstance{t: t, vals: maker.vals, types: maker.types}
+		typ.compileMethods(inst, typ.methodList())
+		typ.instances = append(typ.instances, inst)
 	} else {
 		// either the generic type is an alias, or name == "_" (discards the result of type declaration)
 		t = c.Type(special.decl.Decl)
@@ -241,3 +278,165 @@ func (maker *genericMaker) instantiateType(typ *GenericType, node *ast.IndexExpr
 	panicking = false
 	return t
 }
+
+// DeclGenericMethod compiles a method declaration on a generic type, as func (s *Stack[T]) Push(v T).
+// The method is compiled for each instantiated type, including the types instantiated later
+func (c *Comp) DeclGenericMethod(funcdecl *ast.FuncDecl, recv *ast.IndexExpr) {
+	name, args, _ := splitGenericArgs(recv)
+	sym, scope := c.tryResolveGeneric(name)
+	var typ *GenericType
+	if sym != nil && sym.Desc.Class() == GenericTypeBind {
+		typ, _ = sym.Value.(*GenericType)
+	}
+	if typ == nil {
+		c.Errorf("invalid receiver type %v: %s is not a generic type", recv, name)
+	} else if scope != c || typ.DeclScope != c {
+		c.Errorf("cannot define new methods on non-local type %v", recv)
+	} else if len(args) != len(typ.Master.Params) {
+		c.Errorf("receiver type %v has %d type parameters, expecting %d: func (%v) %s(/*...*/)",
+			recv, len(args), len(typ.Master.Params), funcdecl.Recv.List[0].Type, funcdecl.Name)
+	}
+	params := make([]string, len(args))
+	blank := false
+	for i, arg := range args {
+		ident, _ := arg.(*ast.Ident)
+		if ident == nil {
+			c.Errorf("receiver type parameter %v must be an identifier: func (%v) %s(/*...*/)",
+				arg, funcdecl.Recv.List[0].Type, funcdecl.Name)
+		}
+		params[i] = ident.Name
+		if ident.Name == "_" {
+			// the receiver type needs a name for each type parameter:
+			// use one that cannot appear in source code
+			params[i] = fmt.Sprintf("_#%d", i)
+			blank = true
+		}
+	}
+	if blank {
+		funcdecl = blankReceiverParams(funcdecl, recv, params)
+	}
+	mname := funcdecl.Name.Name
+	method := &GenericMethod{Decl: funcdecl, Params: params}
+
+	old := typ.Methods[mname]
+	panicking := true
+	defer func() {
+		// on compile error, restore pre-existing declaration
+		if !panicking {
+			// nothing to do
+		} else if old != nil {
+			typ.Methods[mname] = old
+		} else {
+			delete(typ.Methods, mname)
+		}
+	}()
+	if typ.Methods == nil {
+		typ.Methods = make(map[string]*GenericMethod)
+	}
+	typ.Methods[mname] = method
+
+	// compile the method for the types already instantiated
+	for _, inst := range typ.instances {
+		typ.compileMethods(inst, []*GenericMethod{method})
+	}
+	// a method declaration is a statement:
+	// executing it sets the method value in the instantiated types
+	c.Append(func(env *Env) (Stmt, *Env) {
+		method.setDeclEnv(env)
+		env.IP++
+		return env.Code[env.IP], env
+	}, funcdecl.Pos())
+	panicking = false
+}
+
+// blankReceiverParams returns a copy of funcdecl, whose receiver type recv
+// has the type parameters replaced by params
+func blankReceiverParams(funcdecl *ast.FuncDecl, recv *ast.IndexExpr, params []string) *ast.FuncDecl {
+	args := make([]ast.Expr, len(params))
+	for i, param := range params {
+		args[i] = &ast.Ident{NamePos: recv.Index.Pos(), Name: param}
+	}
+	index := *recv
+	if lit, ok := recv.Index.(*ast.CompositeLit); ok && lit.Type == nil {
+		elts := *lit
+		elts.Elts = args
+		index.Index = &elts
+	} else {
+		index.Index = args[0]
+	}
+	field := *funcdecl.Recv.List[0]
+	if star, ok := field.Type.(*ast.StarExpr); ok {
+		field.Type = &ast.StarExpr{Star: star.Star, X: &index}
+	} else {
+		field.Type = &index
+	}
+	decl := *funcdecl
+	decl.Recv = &ast.FieldList{Opening: funcdecl.Recv.Opening, List: []*ast.Field{&field}, Closing: funcdecl.Recv.Closing}
+	return &decl
+}
+
+// methodList returns the methods declared on generic type typ, sorted by name
+func (typ *GenericType) methodList() []*GenericMethod {
+	names := make([]string, 0, len(typ.Methods))
+	for name := range typ.Methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]*GenericMethod, len(names))
+	for i, name := range names {
+		list[i] = typ.Methods[name]
+	}
+	return list
+}
+
+// compileMethods compiles the methods of generic type typ for the instantiated type inst
+func (typ *GenericType) compileMethods(inst *genericTypeInstance, methods []*GenericMethod) {
+	type pending struct {
+		comp        *Comp
+		t           xr.Type
+		paramnames  []string
+		resultnames []string
+		instance    *genericMethodInstance
+	}
+	list := make([]pending, len(methods))
+	// declare all the methods before compiling their bodies: methods can call each other
+	for i, method := range methods {
+		// compile in the scope where the generic type is declared,
+		// injecting the receiver type parameters
+		c := NewComp(typ.DeclScope, nil)
+		c.UpCost = 0
+		c.Depth--
+		for j, name := range method.Params {
+			t := inst.types[j]
+			if val := inst.vals[j]; val != nil {
+				c.DeclConst0(name, t, val, t)
+			} else {
+				c.declTypeAlias(name, t)
+			}
+		}
+		t, paramnames, resultnames := c.methodType(method.Decl)
+		index, methodvalues := c.methodAdd(method.Decl, t)
+		list[i] = pending{c, t, paramnames, resultnames, &genericMethodInstance{methods: methodvalues, index: index}}
+	}
+	for i, method := range methods {
+		p := &list[i]
+		_, p.instance.fun = p.comp.methodBody(method.Decl, p.t, p.paramnames, p.resultnames)
+		method.instances = append(method.instances, p.instance)
+		if env := method.DeclEnv; env != nil {
+			p.instance.set(env)
+		}
+	}
+}
+
+// setDeclEnv sets the *Env where the method declaration was executed,
+// and the method value in the types instantiated so far
+func (method *GenericMethod) setDeclEnv(env *Env) {
+	method.DeclEnv = env
+	for _, instance := range method.instances {
+		instance.set(env)
+	}
+}
+
+func (instance *genericMethodInstance) set(env *Env) {
+	(*instance.methods)[instance.index] = instance.fun(env).ReflectValue()
+}
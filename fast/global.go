@@ -141,6 +141,7 @@ type Expr struct {
 	Fun   I         // function that evaluates the expression at runtime.
 	Sym   *Symbol   // in case the expression is a symbol
 	EFlags
+	compiledPkg string // if not empty, the expression is a function or method declared by this compiled package
 }
 
 func (e *Expr) Const() bool {
@@ -327,11 +328,7 @@ func (bind *Bind) RuntimeValue(g *CompGlobals, env *Env) xr.Value {
 	case VarBind, FuncBind:
 		v = env.Vals[bind.Desc.Index()]
 	case GenericFuncBind, GenericTypeBind:
-		if GENERICS_V1_CXX() || GENERICS_V2_CTI() {
-			v = bind.Lit.ConstValue()
-			break
-		}
-		fallthrough
+		v = bind.Lit.ConstValue()
 	default:
 		output.Errorf("Symbol %q: unsupported class: %v", bind.Name, bind.Desc.Class())
 	}
@@ -459,6 +456,7 @@ type LoopInfo struct {
 	Break      *int
 	Continue   *int
 	ThisLabels []string // sorted. for labeled "switch" and "for"
+	RangeFunc  *Bind    // for range-over-func loops: unnamed bind holding the loop state
 }
 
 func (l *LoopInfo) HasLabel(label string) bool {
@@ -471,6 +469,9 @@ type FuncInfo struct {
 	Param        []*Bind
 	Result       []*Bind
 	NamedResults bool
+	Recovers     bool            // true if the function body calls recover()
+	labels       map[string]bool // labels declared in the function body
+	codes        []*debugCode    // function literals in the function body, registered for breakpoints
 }
 
 const (
@@ -483,6 +484,7 @@ const (
 	EFStartDefer ExecFlags = 1 << iota // true next executed function body is a defer
 	EFDefer                            // function body being executed is a defer
 	EFDebug                            // function body is executed with debugging enabled
+	EFBudget                           // executed statements are charged to a Budget
 )
 
 func (ef ExecFlags) StartDefer() bool {
@@ -497,6 +499,10 @@ func (ef ExecFlags) IsDebug() bool {
 	return ef&EFDebug != 0
 }
 
+func (ef ExecFlags) IsBudget() bool {
+	return ef&EFBudget != 0
+}
+
 func (ef *ExecFlags) SetDefer(flag bool) {
 	if flag {
 		(*ef) |= EFDefer
@@ -521,6 +527,14 @@ func (ef *ExecFlags) SetDebug(flag bool) {
 	}
 }
 
+func (ef *ExecFlags) SetBudget(flag bool) {
+	if flag {
+		(*ef) |= EFBudget
+	} else {
+		(*ef) &^= EFBudget
+	}
+}
+
 type DebugOp struct {
 	// statements at env.CallDepth < Depth will be executed in single-stepping mode,
 	// i.e. invoking the debugger after every statement
@@ -543,8 +557,10 @@ type Debugger interface {
 
 // IrGlobals contains interpreter configuration
 type IrGlobals struct {
-	gls  map[uintptr]*Run
-	lock atomic.SpinLock
+	gls         map[uintptr]*Run
+	lock        atomic.SpinLock
+	breakpoints breakpoints
+	budget      Budget // set by Interp.SetBudget()
 	base.Globals
 }
 
@@ -557,12 +573,18 @@ type Run struct {
 	ExecFlags    ExecFlags
 	CurrEnv      *Env        // caller of current function. used ONLY at function entry to build call stack
 	InstallDefer func()      // defer function to be installed
+	DirectDefer  interface{} // if not nil, the compiled function to be deferred directly instead of InstallDefer, so it can recover()
+	DeferArg     interface{} // the argument of DirectDefer, if it has one
 	DeferOfFun   *Env        // function whose defer are running
 	PanicFun     *Env        // the currently panicking function
 	Panic        interface{} // current panic. needed for recover()
+	PanicEnv     *Env        // innermost Env when the current panic started. used for stack traces
 	CmdOpt       base.CmdOpt
 	Debugger     Debugger
-	DebugDepth   int // depth of function to debug with single-step
+	DebugDepth   int         // depth of function to debug with single-step
+	Watch        *Watchpoint // watchpoint that triggered the current debugger stop, or nil
+	group        *runGroup   // evaluation this Run belongs to, set by Interp.RunExprContext()
+	stmtQuota    int64       // statements this Run can execute before charging the Budget again
 	PoolSize     int
 	Pool         [poolCapacity]*Env
 }
@@ -570,11 +592,18 @@ type Run struct {
 // CompGlobals contains interpreter compile bookeeping information
 type CompGlobals struct {
 	*IrGlobals
-	Universe     *xr.Universe
-	KnownImports map[string]*Import // map[path]*Import cache of known imports
-	interf2proxy map[r.Type]r.Type  // interface -> proxy
-	proxy2interf map[r.Type]xr.Type // proxy -> interface
-	Prompt       string
+	Universe      *xr.Universe
+	KnownImports  map[string]*Import         // map[path]*Import cache of known imports
+	interf2proxy  map[r.Type]r.Type          // interface -> proxy
+	proxy2interf  map[r.Type]xr.Type         // proxy -> interface
+	constraints   map[xr.Key]*typeConstraint // named interface -> type constraint
+	inConstraint  int                        // > 0 while compiling a type constraint
+	sandbox       *sandbox                   // set by Interp.SetSandbox()
+	methodProxies map[string][]methodProxy   // package path -> interfaces its compiled functions look for with reflection
+	autoImports   map[string]string          // package name -> path, set by Interp.SetAutoImport()
+	profile       []string                   // files evaluated by Interp.LoadProfile()
+	results       resultHistory              // last results of Interp.ParseEvalPrint()
+	Prompt        string
 }
 
 func (cg *CompGlobals) CompileOptions() CompileOptions {
@@ -609,10 +638,11 @@ type Comp struct {
 	// usually equals one. will be zero if this *Comp defines no local variables/functions.
 	UpCost    int
 	Depth     int
-	Code      Code      // "compiled" code
-	Loop      *LoopInfo // != nil when compiling a for or switch
-	Func      *FuncInfo // != nil when compiling a function
-	Labels    map[string]*int
+	Code      Code            // "compiled" code
+	Loop      *LoopInfo       // != nil when compiling a for or switch
+	Func      *FuncInfo       // != nil when compiling a function
+	Labels    map[string]*int // label -> jump target. *target < 0 means label is declared later, i.e. forward goto
+	Gotos     map[string]int  // label -> number of variables declared when first forward goto to it was compiled
 	Outer     *Comp
 	FuncMaker *funcMaker // used by debugger command 'backtrace' to obtain function name, type and binds for arguments and results
 }
@@ -651,5 +681,6 @@ type Import struct {
 	// interpreted and compiled constants, functions, variables and types.
 	CompBinds
 	*EnvBinds
-	env *Env
+	env      *Env
+	compiled bool // true if loaded from compiled code, i.e. from imports.Packages or a plugin
 }
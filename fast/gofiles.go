@@ -0,0 +1,186 @@
+package fast
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"os"
+	"path/filepath"
+
+	"github.com/WilliamNHarvey/gomacro/ast2"
+	"github.com/WilliamNHarvey/gomacro/base/paths"
+)
+
+// GoFiles returns the Go source files in directory dir that "go build" would compile:
+// files excluded by build constraints and _test.go files are omitted.
+// Returns nil, nil if dir contains no such files
+func GoFiles(dir string) ([]string, error) {
+	pkg, err := build.ImportDir(dir, 0)
+	if err != nil {
+		if _, ok := err.(*build.NoGoError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(pkg.CgoFiles) != 0 {
+		return nil, fmt.Errorf("%s: cgo is not supported by the interpreter: %v", dir, pkg.CgoFiles)
+	}
+	files := make([]string, len(pkg.GoFiles))
+	for i, file := range pkg.GoFiles {
+		files[i] = paths.Subdir(dir, file)
+	}
+	return files, nil
+}
+
+// goPackage contains the top-level declarations of the Go files of a package
+type goPackage struct {
+	name    string
+	file    string // the file declaring name
+	imports []ast.Node
+	decls   []ast.Node
+	inits   []*ast.FuncDecl
+}
+
+// RunGoFiles executes the Go source files of a single package as "go run" would:
+// declarations can appear in any order and in any file, package-level variables
+// are initialized in dependency order, then the init() functions are executed
+// in the order they appear in the files, and finally main() if the package is "main".
+//
+// Returns the exit status "go run" would return: 0 on success,
+// 1 if the files cannot be read, parsed or compiled, 2 if the program panics.
+// Interpreted code calling os.Exit() terminates the whole process
+func (ir *Interp) RunGoFiles(filenames ...string) (exitCode int, err error) {
+	exitCode = 1
+	c := ir.Comp
+	kind := ParseError
+	defer func() {
+		if rec := recover(); rec != nil {
+			if exitCode == 1 {
+				// report the file and line of the error
+				err = c.makeError(kind, rec)
+				return
+			}
+			switch rec := rec.(type) {
+			case error:
+				err = rec
+			default:
+				err = errors.New(fmt.Sprint(rec))
+			}
+			err = fmt.Errorf("panic: %v", err)
+		}
+	}()
+	pkg := &goPackage{}
+	for _, filename := range filenames {
+		if err = ir.parseGoFile(pkg, filename); err != nil {
+			return exitCode, err
+		}
+	}
+	kind = CompileError
+	// compile everything before running anything: compile errors must not execute code
+	// dep.Sorter resolves declarations out of order only if imports come first
+	decls := ir.CompileAst(ast2.NodeSlice{X: append(pkg.imports, pkg.decls...)})
+	inits := make([]*Expr, len(pkg.inits))
+	for i, decl := range pkg.inits {
+		c.Pos = decl.Pos()
+		if decl.Type.Params.NumFields() != 0 || decl.Type.Results.NumFields() != 0 {
+			c.Errorf("func init must have no arguments and no return values")
+		} else if decl.Body == nil {
+			c.Errorf("missing function body: func init")
+		}
+		// init() functions cannot be referenced: compile them as anonymous functions and call them
+		inits[i] = ir.CompileNode(&ast.CallExpr{
+			Fun:    &ast.FuncLit{Type: decl.Type, Body: decl.Body},
+			Lparen: decl.Body.Lbrace,
+			Rparen: decl.Body.Lbrace,
+		})
+	}
+	var main *Expr
+	if pkg.name == "main" {
+		if main, err = ir.compileMain(); err != nil {
+			return exitCode, err
+		}
+	}
+	exitCode = 2
+	ir.RunExpr(decls)
+	for _, e := range inits {
+		ir.RunExpr(e)
+	}
+	ir.RunExpr(main)
+	return 0, nil
+}
+
+// parseGoFile parses a Go source file and adds its declarations to pkg
+func (ir *Interp) parseGoFile(pkg *goPackage, filename string) error {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	c := ir.Comp
+	g := c.CompGlobals
+	saveFilename, saveLine := g.Filepath, g.Line
+	defer func() {
+		g.Filepath, g.Line = saveFilename, saveLine
+	}()
+	g.Filepath, g.Line = filename, 0
+
+	for _, node := range ast2.ToNodesAppend(nil, c.Parse(string(src))) {
+		c.Pos = node.Pos()
+		switch node := node.(type) {
+		case *ast.GenDecl:
+			switch node.Tok {
+			case token.PACKAGE:
+				ir.goPackageName(pkg, filename, node)
+				continue
+			case token.IMPORT:
+				pkg.imports = append(pkg.imports, node)
+				continue
+			}
+		case *ast.FuncDecl:
+			if node.Recv == nil && node.Name.Name == "init" {
+				pkg.inits = append(pkg.inits, node)
+				continue
+			}
+		case ast.Decl:
+		default:
+			c.Errorf("non-declaration statement outside function body: %v", node)
+		}
+		pkg.decls = append(pkg.decls, node)
+	}
+	if pkg.file != filename {
+		return fmt.Errorf("%s: expected 'package', found no package clause", filename)
+	}
+	return nil
+}
+
+func (ir *Interp) goPackageName(pkg *goPackage, filename string, node *ast.GenDecl) {
+	var name string
+	if len(node.Specs) == 1 {
+		if spec, ok := node.Specs[0].(*ast.ValueSpec); ok && len(spec.Names) == 1 && len(spec.Values) == 0 {
+			name = spec.Names[0].Name
+		}
+	}
+	if name == "" {
+		ir.Comp.Errorf("invalid package clause, expecting a package name: %v", node)
+	} else if pkg.name == "" {
+		pkg.name = name
+	} else if name != pkg.name {
+		ir.Comp.Errorf("found packages %s (%s) and %s (%s)",
+			pkg.name, filepath.Base(pkg.file), name, filepath.Base(filename))
+	}
+	pkg.file = filename
+}
+
+// compileMain compiles a call to the function main()
+func (ir *Interp) compileMain() (*Expr, error) {
+	c := ir.Comp
+	bind := c.Binds["main"]
+	if bind == nil || bind.Desc.Class() != FuncBind {
+		return nil, errors.New("function main is undeclared in the main package")
+	}
+	if t := bind.Type; t.NumIn() != 0 || t.NumOut() != 0 {
+		return nil, errors.New("func main must have no arguments and no return values")
+	}
+	return ir.CompileNode(&ast.CallExpr{Fun: ast.NewIdent("main")}), nil
+}
@@ -184,6 +184,7 @@ func (c *Comp) ImportPackagesOrError(paths map[string]PackageName) (map[string]*
 		}
 		for path, pkgref := range pkgrefs {
 			imp := cg.NewImport(pkgref)
+			c.loadGenerics(imp, pkgref)
 			cg.KnownImports[path] = imp
 			imported[path] = imp
 		}
@@ -220,6 +221,7 @@ func (c *Comp) MultiImport(node *ast.GenDecl) {
 				c.Errorf("error unescaping import path %q: %v", str, err)
 			}
 			path = c.sanitizeImportPath(path)
+			c.checkImport(path)
 			var name PackageName
 			if node.Name != nil {
 				name = PackageName(node.Name.Name)
@@ -281,6 +283,9 @@ func (c *Comp) declDotImport0(imp *Import) {
 		c.Types = make(map[string]xr.Type)
 	}
 	for name, typ := range imp.Types {
+		if !c.allowSymbol(imp, name) {
+			continue
+		}
 		if t, exists := c.Types[name]; exists {
 			c.Warnf("redefined type: %v", t)
 		}
@@ -293,6 +298,9 @@ func (c *Comp) declDotImport0(imp *Import) {
 	var findexv []int
 
 	for name, bind := range imp.Binds {
+		if !c.allowSymbol(imp, name) {
+			continue
+		}
 		// use c.CompBinds.NewBind() to prevent optimization VarBind -> IntBind
 		// also, if class == IntBind, we must preserve the address of impenv.Ints[idx]
 		// thus we must convert it into a VarBind (argh!)
@@ -303,7 +311,7 @@ func (c *Comp) declDotImport0(imp *Import) {
 		cbind := c.CompBinds.NewBind(&c.Output, name, class, bind.Type)
 		cidx := cbind.Desc.Index()
 		switch bind.Desc.Class() {
-		case ConstBind:
+		case ConstBind, GenericFuncBind, GenericTypeBind:
 			cbind.Value = bind.Value
 		case IntBind:
 			if cidx == NoIndex {
@@ -343,6 +351,7 @@ func (cg *CompGlobals) NewImport(pkgref *genimport.PackageRef) *Import {
 	imp := &Import{
 		EnvBinds: &env.EnvBinds,
 		env:      env,
+		compiled: pkgref != nil,
 	}
 	if pkgref != nil {
 		imp.Name = pkgref.Name
@@ -491,9 +500,16 @@ func (imp *Import) selector(name string, st *output.Stringer) *Expr {
 	case ConstBind:
 		return exprLit(bind.Lit, bind.AsSymbol(0))
 	case FuncBind, VarBind:
-		return imp.symbol(bind, st)
+		e := imp.symbol(bind, st)
+		if imp.compiled && bind.Desc.Class() == FuncBind {
+			e.compiledPkg = imp.Path
+		}
+		return e
 	case IntBind:
 		return imp.intSymbol(bind, st)
+	case GenericFuncBind, GenericTypeBind:
+		// must be followed by [...] generic arguments, or called with inferred generic arguments
+		return &Expr{Lit: Lit{Type: bind.Type, Value: bind.Value}, Sym: bind.AsSymbol(0)}
 	default:
 		st.Errorf("package symbol %s.%s has unknown class %s", imp.Name, name, bind.Desc.Class())
 		return nil
@@ -35,7 +35,25 @@ func (c *Comp) TypeInterface(node *ast.InterfaceType) xr.Type {
 	if node.Methods == nil || len(node.Methods.List) == 0 {
 		return c.TypeOfInterface()
 	}
-	types, names := c.TypeFields(node.Methods)
+	fields := node.Methods
+	for i, field := range fields.List {
+		if isTypeElem(field) {
+			if c.inConstraint == 0 {
+				c.Errorf("cannot use %v outside a type constraint: interface contains type constraints", node)
+			}
+			// skip type elements T1 | ~T2 ... they are only used by type constraints
+			fields = &ast.FieldList{List: make([]*ast.Field, 0, len(node.Methods.List))}
+			fields.List = append(fields.List, node.Methods.List[:i]...)
+			for _, field := range node.Methods.List[i+1:] {
+				if !isTypeElem(field) {
+					fields.List = append(fields.List, field)
+				}
+			}
+			break
+		}
+	}
+	// embedded constraints are checked below
+	types, names := c.constraintFields(fields)
 
 	// parser returns embedded interfaces as unnamed fields
 	var methodnames []string
@@ -44,18 +62,34 @@ func (c *Comp) TypeInterface(node *ast.InterfaceType) xr.Type {
 		if i < len(names) && len(names[i]) != 0 {
 			methodnames = append(methodnames, names[i])
 			methodtypes = append(methodtypes, typ)
-		} else {
-			if typ.Kind() != r.Interface {
+			continue
+		}
+		if typ.Kind() != r.Interface {
+			if c.inConstraint == 0 {
 				c.Errorf("embedded interface is not an interface: %v", typ)
 			}
-			embeddedtypes = append(embeddedtypes, typ)
+			// type element T, only used by type constraints
+			continue
+		} else if c.inConstraint == 0 && c.lookupConstraint(typ) != nil {
+			c.Errorf("cannot use %v outside a type constraint: interface contains type constraints", node)
 		}
+		embeddedtypes = append(embeddedtypes, typ)
 	}
 	universe := c.Universe
 	pkg := universe.LoadPackage(c.FileComp().Path)
 	return universe.InterfaceOf(pkg, methodnames, methodtypes, embeddedtypes)
 }
 
+// constraintFields compiles the methods and embedded types of an interface,
+// allowing embedded type constraints
+func (c *Comp) constraintFields(fields *ast.FieldList) ([]xr.Type, []string) {
+	c.inConstraint++
+	defer func() {
+		c.inConstraint--
+	}()
+	return c.TypeFields(fields)
+}
+
 // InterfaceProxy returns the proxy struct that implements a compiled interface
 func (c *Comp) InterfaceProxy(t xr.Type) r.Type {
 	ret := c.interf2proxy[t.ReflectType()]
@@ -68,8 +102,14 @@ func (c *Comp) InterfaceProxy(t xr.Type) r.Type {
 // converterToProxy compiles a conversion from 'tin' into a proxy struct that implements the interface type 'tout'
 // and returns a function that performs such conversion
 func (c *Comp) converterToProxy(tin xr.Type, tout xr.Type) func(val xr.Value) xr.Value {
-	rtout := tout.ReflectType()       // a compiled interface
-	rtproxy := c.InterfaceProxy(tout) // one of our proxies that pre-implement the compiled interface
+	// one of our proxies that pre-implement the compiled interface
+	return c.converterToGivenProxy(tin, tout, c.InterfaceProxy(tout))
+}
+
+// converterToGivenProxy compiles a conversion from 'tin' into the proxy struct 'rtproxy'
+// that implements the interface type 'tout' and returns a function that performs such conversion
+func (c *Comp) converterToGivenProxy(tin xr.Type, tout xr.Type, rtproxy r.Type) func(val xr.Value) xr.Value {
+	rtout := tout.ReflectType() // a compiled interface
 
 	tsrc := tin
 	if tin.Kind() == r.Ptr {
@@ -88,7 +128,12 @@ func (c *Comp) converterToProxy(tin xr.Type, tout xr.Type) func(val xr.Value) xr
 			c.Errorf("type <%v> has %d wrapper methods %s %s all at the same depth=%d - cannot convert to interface <%v>",
 				tin, count, mtdout.PkgPath, mtdout.Name, len(mtdin.FieldIndex), tout)
 		}
-		e := c.compileMethodAsFunc(tin, mtdin)
+		trecv := tin
+		if tin.Kind() == r.Ptr && len(mtdin.FieldIndex) == 0 && mtdin.Type.In(0).Kind() != r.Ptr {
+			// method with value receiver: setProxyField() dereferences the pointer
+			trecv = tsrc
+		}
+		e := c.compileMethodAsFunc(trecv, mtdin)
 		// c.Debugf("type %v proxy %v method %s = %v // %v", tin.Name(), tout.Name(), mtdin.Name, e.Value, e.Type)
 		setProxyField(vtable.Field(i+1), xr.ValueOf(e.Value))
 	}
@@ -127,8 +172,14 @@ func setProxyField(place xr.Value, mtd xr.Value) {
 			rcall = r.Value.CallSlice
 		}
 		rmtd := mtd.ReflectValue()
+		rtrecv := rtin.In(0)
 		rfunc := r.MakeFunc(rtout, func(args []r.Value) []r.Value {
-			args[0] = args[0].Interface().(xr.InterfaceHeader).Value().ReflectValue()
+			recv := args[0].Interface().(xr.InterfaceHeader).Value().ReflectValue()
+			if recv.Kind() == r.Ptr && recv.Type() != rtrecv && recv.Type().Elem() == rtrecv {
+				// method with value receiver, invoked on a pointer
+				recv = recv.Elem()
+			}
+			args[0] = recv
 			return rcall(rmtd, args)
 		})
 		place.Set(xr.MakeValue(rfunc))
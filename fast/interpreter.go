@@ -20,6 +20,7 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"go/token"
 	"io"
 	"os"
 	r "reflect"
@@ -59,6 +60,7 @@ func newTopInterp(path string) *Interp {
 		KnownImports: make(map[string]*Import),
 		interf2proxy: make(map[r.Type]r.Type),
 		proxy2interf: make(map[r.Type]xr.Type),
+		constraints:  make(map[xr.Key]*typeConstraint),
 		Prompt:       "gomacro> ",
 	}
 
@@ -194,7 +196,7 @@ func (ir *Interp) DeclVar(name string, t xr.Type, value I) {
 // apply executes the compiled declarations, statements and expressions,
 // then clears the compiled buffer
 func (ir *Interp) apply() {
-	exec := ir.Comp.Code.Exec()
+	exec := ir.Comp.execCode("", token.NoPos, false)
 	if exec != nil {
 		exec(ir.PrepareEnv())
 	}
@@ -262,6 +264,11 @@ func (ir *Interp) Eval(src string) ([]xr.Value, []xr.Type) {
 }
 
 func (ir *Interp) EvalFile(filepath string) (comments string, err error) {
+	return ir.evalFile(filepath, false)
+}
+
+// evalFile evaluates a file. If keepOptions, the options toggled by :options in the file remain in effect
+func (ir *Interp) evalFile(filepath string, keepOptions bool) (comments string, err error) {
 	g := ir.Comp.CompGlobals
 	saveFilename := g.Filepath
 	f, err := os.Open(filepath)
@@ -273,10 +280,37 @@ func (ir *Interp) EvalFile(filepath string) (comments string, err error) {
 		g.Filepath = saveFilename
 	}()
 	g.Filepath = filepath
-	return ir.EvalReader(f)
+	return ir.evalReader(f, keepOptions)
+}
+
+// LoadProfile evaluates the files in order, as EvalFile does,
+// except that the options toggled by :options in the files remain in effect.
+// It remembers the files, and the REPL command :reload-profile evaluates them again:
+// since :options toggles options, the second time their changes are discarded
+func (ir *Interp) LoadProfile(files ...string) error {
+	ir.Comp.CompGlobals.profile = files
+	return ir.loadProfile(true)
+}
+
+// Profile returns the files evaluated by LoadProfile
+func (ir *Interp) Profile() []string {
+	return ir.Comp.CompGlobals.profile
+}
+
+func (ir *Interp) loadProfile(keepOptions bool) error {
+	for _, file := range ir.Comp.CompGlobals.profile {
+		if _, err := ir.evalFile(file, keepOptions); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (ir *Interp) EvalReader(src io.Reader) (comments string, err error) {
+	return ir.evalReader(src, false)
+}
+
+func (ir *Interp) evalReader(src io.Reader, keepOptions bool) (comments string, err error) {
 	g := ir.Comp.CompGlobals
 	savein := g.Readline
 	saveopts := g.Options
@@ -285,9 +319,15 @@ func (ir *Interp) EvalReader(src io.Reader) (comments string, err error) {
 	g.Readline = in
 	// parsing a file: suppress prompt and printing expression results
 	g.Options &^= base.OptShowPrompt | base.OptShowEval | base.OptShowEvalType
+	startopts := g.Options
 	defer func() {
 		g.Readline = savein
-		g.Options = saveopts
+		if keepOptions {
+			// apply to saved options the toggles performed by the file
+			g.Options = saveopts ^ (g.Options ^ startopts)
+		} else {
+			g.Options = saveopts
+		}
 		if rec := recover(); rec != nil {
 			switch rec := rec.(type) {
 			case error:
@@ -0,0 +1,381 @@
+package fast
+
+import (
+	"container/heap"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	r "reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/WilliamNHarvey/gomacro/imports"
+	xr "github.com/WilliamNHarvey/gomacro/xreflect"
+)
+
+// Methods of interpreted types are emulated, thus compiled code cannot find them with reflection:
+// fmt.Println() does not see the String() method of an interpreted type converted to interface{}.
+//
+// To overcome this, arguments of interpreted types passed to compiled functions and methods
+// of some packages are wrapped in a proxy that implements the interfaces those packages look for.
+// A value can be wrapped in a single proxy: if its type implements several of them,
+// the interface with more methods wins, then the one registered first.
+
+// methodProxy is an interface that compiled functions of a package look for with reflection
+type methodProxy struct {
+	rtype r.Type
+	xtype xr.Type
+	proxy r.Type
+}
+
+// proxyDecl is an interface and its proxy. A nil proxy means the proxy in imports.Packages
+type proxyDecl struct {
+	interf r.Type
+	proxy  r.Type
+}
+
+// proxies for error, fmt.Stringer and fmt.GoStringer passed to package fmt.
+// They also implement fmt.Formatter: as fmt does for compiled types, they use
+// their methods only for the verbs that print strings, and format the wrapped value otherwise
+type (
+	proxy_fmtError struct {
+		Object interface{}
+		Error_ func(interface{}) string
+	}
+	proxy_fmtStringer struct {
+		Object  interface{}
+		String_ func(interface{}) string
+	}
+	proxy_fmtGoStringer struct {
+		Object    interface{}
+		GoString_ func(interface{}) string
+	}
+)
+
+func (p *proxy_fmtError) Error() string {
+	return p.Error_(p.Object)
+}
+
+func (p *proxy_fmtError) Format(f fmt.State, verb rune) {
+	if f.Flag('#') && verb == 'v' {
+		formatObject(f, verb, p.Object)
+	} else {
+		formatString(f, verb, p.Object, p.Error)
+	}
+}
+
+func (p *proxy_fmtStringer) String() string {
+	return p.String_(p.Object)
+}
+
+func (p *proxy_fmtStringer) Format(f fmt.State, verb rune) {
+	if f.Flag('#') && verb == 'v' {
+		formatObject(f, verb, p.Object)
+	} else {
+		formatString(f, verb, p.Object, p.String)
+	}
+}
+
+func (p *proxy_fmtGoStringer) GoString() string {
+	return p.GoString_(p.Object)
+}
+
+func (p *proxy_fmtGoStringer) Format(f fmt.State, verb rune) {
+	if f.Flag('#') && verb == 'v' {
+		fmt.Fprint(f, p.GoString())
+	} else {
+		formatObject(f, verb, p.Object)
+	}
+}
+
+// formatString formats str() if verb prints strings, otherwise formats the value wrapped in obj
+func formatString(f fmt.State, verb rune, obj interface{}, str func() string) {
+	switch verb {
+	case 'v', 's', 'q', 'x', 'X':
+		fmt.Fprintf(f, fmtDirective(f, verb), str())
+	default:
+		formatObject(f, verb, obj)
+	}
+}
+
+// formatObject formats the value wrapped in obj
+func formatObject(f fmt.State, verb rune, obj interface{}) {
+	if h, ok := obj.(xr.InterfaceHeader); ok {
+		obj = nil
+		if v := h.Value(); v.IsValid() && v.CanInterface() {
+			obj = v.Interface()
+		}
+	}
+	fmt.Fprintf(f, fmtDirective(f, verb), obj)
+}
+
+// fmtDirective returns the formatting directive that invoked Format(f, verb)
+func fmtDirective(f fmt.State, verb rune) string {
+	var buf strings.Builder
+	buf.WriteByte('%')
+	for _, flag := range "+-# 0" {
+		if f.Flag(int(flag)) {
+			buf.WriteRune(flag)
+		}
+	}
+	if width, ok := f.Width(); ok {
+		buf.WriteString(strconv.Itoa(width))
+	}
+	if prec, ok := f.Precision(); ok {
+		buf.WriteByte('.')
+		buf.WriteString(strconv.Itoa(prec))
+	}
+	buf.WriteRune(verb)
+	return buf.String()
+}
+
+// interfaces of standard packages with both marshalling and unmarshalling methods:
+// they usually have different receivers, and a value can be wrapped in a single proxy
+type (
+	jsonMarshalerUnmarshaler interface {
+		json.Marshaler
+		json.Unmarshaler
+	}
+	textMarshalerUnmarshaler interface {
+		encoding.TextMarshaler
+		encoding.TextUnmarshaler
+	}
+)
+
+// proxy for jsonMarshalerUnmarshaler
+type proxy_jsonMarshalerUnmarshaler struct {
+	Object         interface{}
+	MarshalJSON_   func(interface{}) ([]byte, error)
+	UnmarshalJSON_ func(interface{}, []byte) error
+}
+
+func (p *proxy_jsonMarshalerUnmarshaler) MarshalJSON() ([]byte, error) {
+	return p.MarshalJSON_(p.Object)
+}
+
+func (p *proxy_jsonMarshalerUnmarshaler) UnmarshalJSON(data []byte) error {
+	return p.UnmarshalJSON_(p.Object, data)
+}
+
+// proxy for textMarshalerUnmarshaler
+type proxy_textMarshalerUnmarshaler struct {
+	Object         interface{}
+	MarshalText_   func(interface{}) ([]byte, error)
+	UnmarshalText_ func(interface{}, []byte) error
+}
+
+func (p *proxy_textMarshalerUnmarshaler) MarshalText() ([]byte, error) {
+	return p.MarshalText_(p.Object)
+}
+
+func (p *proxy_textMarshalerUnmarshaler) UnmarshalText(text []byte) error {
+	return p.UnmarshalText_(p.Object, text)
+}
+
+func rtypeOfPtr(ptr interface{}) r.Type {
+	return r.TypeOf(ptr).Elem()
+}
+
+var (
+	rtypeOfJSONMarshalerUnmarshaler = rtypeOfPtr((*jsonMarshalerUnmarshaler)(nil))
+	rtypeOfTextMarshalerUnmarshaler = rtypeOfPtr((*textMarshalerUnmarshaler)(nil))
+
+	fmtMethodProxies = []proxyDecl{
+		{rtypeOfPtr((*fmt.Formatter)(nil)), nil},
+		{rtypeOfPtr((*error)(nil)), rtypeOfPtr((*proxy_fmtError)(nil))},
+		{rtypeOfPtr((*fmt.Stringer)(nil)), rtypeOfPtr((*proxy_fmtStringer)(nil))},
+		{rtypeOfPtr((*fmt.GoStringer)(nil)), rtypeOfPtr((*proxy_fmtGoStringer)(nil))},
+	}
+	jsonMethodProxies = []proxyDecl{
+		{rtypeOfJSONMarshalerUnmarshaler, rtypeOfPtr((*proxy_jsonMarshalerUnmarshaler)(nil))},
+		{rtypeOfPtr((*json.Marshaler)(nil)), nil},
+		{rtypeOfPtr((*json.Unmarshaler)(nil)), nil},
+		{rtypeOfTextMarshalerUnmarshaler, rtypeOfPtr((*proxy_textMarshalerUnmarshaler)(nil))},
+		{rtypeOfPtr((*encoding.TextMarshaler)(nil)), nil},
+		{rtypeOfPtr((*encoding.TextUnmarshaler)(nil)), nil},
+	}
+
+	// package path -> interfaces that its compiled functions and methods look for with reflection
+	defaultMethodProxies = map[string][]proxyDecl{
+		"container/heap": {{rtypeOfPtr((*heap.Interface)(nil)), nil}},
+		"encoding/json":  jsonMethodProxies,
+		"fmt":            fmtMethodProxies,
+		"log":            fmtMethodProxies,
+		"sort":           {{rtypeOfPtr((*sort.Interface)(nil)), nil}},
+	}
+)
+
+// AddMethodProxy declares that compiled functions and methods of package pkgpath
+// look for the interface interf with reflection, as fmt.Println() does with fmt.Stringer.
+// From now on, interpreted values whose type implements interf will be wrapped
+// in proxy when passed to them, so that compiled code can call their methods.
+//
+// proxy must be a struct type as the ones in imports.Package.Proxies, see imports.PackageBuilder.Proxy().
+// If proxy is nil, the proxy for interf already known to the interpreter or to imports.Packages is used
+func (ir *Interp) AddMethodProxy(pkgpath string, interf r.Type, proxy r.Type) error {
+	cg := ir.Comp.CompGlobals
+	if interf == nil || interf.Kind() != r.Interface || interf.NumMethod() == 0 {
+		return fmt.Errorf("AddMethodProxy: expecting an interface type with methods, found <%v>", interf)
+	}
+	if proxy == nil {
+		if proxy = cg.findProxy(interf); proxy == nil {
+			return fmt.Errorf("AddMethodProxy: no proxy found for interface <%v>", interf)
+		}
+	} else if proxy.Kind() != r.Struct || !r.PtrTo(proxy).Implements(interf) || proxy.NumField() != interf.NumMethod()+1 {
+		return fmt.Errorf("AddMethodProxy: invalid proxy <%v> for interface <%v>", proxy, interf)
+	}
+	mps := append(cg.packageMethodProxies(pkgpath), cg.loadMethodProxy(interf, proxy))
+	cg.methodProxies[pkgpath] = mps
+	return nil
+}
+
+// packageMethodProxies returns the interfaces that compiled functions and methods of package pkgpath
+// look for with reflection
+func (cg *CompGlobals) packageMethodProxies(pkgpath string) []methodProxy {
+	if mps, ok := cg.methodProxies[pkgpath]; ok {
+		return mps
+	}
+	var mps []methodProxy
+	for _, decl := range defaultMethodProxies[pkgpath] {
+		proxy := decl.proxy
+		if proxy == nil {
+			proxy = cg.findProxy(decl.interf)
+		}
+		if proxy != nil {
+			mps = append(mps, cg.loadMethodProxy(decl.interf, proxy))
+		}
+	}
+	if cg.methodProxies == nil {
+		cg.methodProxies = make(map[string][]methodProxy)
+	}
+	cg.methodProxies[pkgpath] = mps
+	return mps
+}
+
+func (cg *CompGlobals) loadMethodProxy(interf r.Type, proxy r.Type) methodProxy {
+	xtype := cg.Universe.FromReflectType(interf)
+	if cg.interf2proxy[interf] == nil {
+		cg.interf2proxy[interf] = proxy
+	}
+	// allow extracting values from proxy
+	cg.proxy2interf[proxy] = xtype
+	return methodProxy{rtype: interf, xtype: xtype, proxy: proxy}
+}
+
+// findProxy returns the proxy for compiled interface interf, or nil if not found
+func (cg *CompGlobals) findProxy(interf r.Type) r.Type {
+	if proxy := cg.interf2proxy[interf]; proxy != nil {
+		return proxy
+	}
+	if pkg, ok := imports.Packages[interf.PkgPath()]; ok {
+		return pkg.Proxies[interf.Name()]
+	}
+	return nil
+}
+
+// methodProxyConverter returns a function that wraps values of interpreted type tin
+// into a proxy for the interface with more methods, among the ones in mps, that tin implements
+// and that can be converted to compiled interface tout.
+// Returns nil if there is no such interface, or if tout already has as many methods
+func (c *Comp) methodProxyConverter(tin xr.Type, tout xr.Type, mps []methodProxy) func(xr.Value) xr.Value {
+	rtin, rtout := tin.ReflectType(), tout.ReflectType()
+	var best *methodProxy
+	for i := range mps {
+		mp := &mps[i]
+		if (best == nil || mp.rtype.NumMethod() > best.rtype.NumMethod()) &&
+			mp.rtype.NumMethod() > rtout.NumMethod() &&
+			mp.rtype.Implements(rtout) && !rtin.Implements(mp.rtype) && tin.Implements(mp.xtype) {
+			best = mp
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	conv := c.converterToGivenProxy(tin, best.xtype, best.proxy)
+	return func(v xr.Value) xr.Value {
+		return conv(v).Convert(rtout)
+	}
+}
+
+// methodProxyCallArgs wraps in proxies the arguments of interpreted types
+// passed to a compiled function or method of package pkgpath, whose type is t.
+// Must be invoked before Comp.checkCallArgs()
+func (c *Comp) methodProxyCallArgs(pkgpath string, t xr.Type, args []*Expr, ellipsis bool) {
+	mps := c.packageMethodProxies(pkgpath)
+	if len(mps) == 0 || len(args) == 1 && args[0].NumOut() > 1 {
+		return
+	}
+	n := t.NumIn()
+	variadic := t.IsVariadic() && !ellipsis
+	for i, arg := range args {
+		var ti xr.Type
+		if variadic && i >= n-1 {
+			ti = t.In(n - 1).Elem()
+		} else if i < n {
+			ti = t.In(i)
+		}
+		if ti == nil || ti.Kind() != r.Interface || xr.IsEmulatedInterface(ti) ||
+			arg.Untyped() || arg.Type == nil || !arg.Type.AssignableTo(ti) {
+			continue
+		}
+		targ := arg.Type
+		if targ.Kind() == r.Interface {
+			c.methodProxyKeep(arg, ti, mps)
+		} else if conv := c.methodProxyConverter(targ, ti, mps); conv != nil {
+			fun := arg.AsX1()
+			args[i] = exprX1(ti, func(env *Env) xr.Value {
+				return conv(fun(env))
+			})
+		}
+	}
+}
+
+// methodProxyKeep converts arg, whose type is a compiled interface among the ones in mps,
+// to compiled interface ti without extracting the value wrapped in its proxy, if any
+func (c *Comp) methodProxyKeep(arg *Expr, ti xr.Type, mps []methodProxy) {
+	rtarg, rti := arg.Type.ReflectType(), ti.ReflectType()
+	if rtarg == rti || !rtarg.Implements(rti) {
+		return
+	}
+	for _, mp := range mps {
+		if mp.rtype == rtarg {
+			fun := arg.AsX1()
+			rtproxy := mp.proxy
+			*arg = *exprX1(ti, func(env *Env) xr.Value {
+				v := fun(env)
+				if !v.IsValid() || v.IsNil() {
+					return xr.ZeroR(rti)
+				}
+				rv := v.ReflectValue()
+				if rv.Kind() == r.Interface {
+					rv = rv.Elem()
+				}
+				if rt := rv.Type(); rt.Kind() == r.Ptr && rt.Elem() != rtproxy && rt.Elem().Kind() == r.Struct && rt.Elem().NumField() == rtproxy.NumField() {
+					rv = copyProxy(rv, rtproxy)
+				}
+				return xr.MakeValue(rv.Convert(rti))
+			})
+			return
+		}
+	}
+}
+
+// copyProxy copies the proxy *rv into a new proxy of type rtproxy for the same interface
+func copyProxy(rv r.Value, rtproxy r.Type) r.Value {
+	src := rv.Elem()
+	if src.Kind() != r.Struct {
+		return rv
+	}
+	ret := r.New(rtproxy)
+	dst := ret.Elem()
+	for i, n := 0, src.NumField(); i < n; i++ {
+		if src.Field(i).Type() != dst.Field(i).Type() {
+			return rv
+		}
+	}
+	for i, n := 0, src.NumField(); i < n; i++ {
+		dst.Field(i).Set(src.Field(i))
+	}
+	return ret
+}
@@ -0,0 +1,171 @@
+package fast
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/WilliamNHarvey/gomacro/base"
+	"github.com/WilliamNHarvey/gomacro/base/reflect"
+	"github.com/WilliamNHarvey/gomacro/gls"
+	xr "github.com/WilliamNHarvey/gomacro/xreflect"
+)
+
+// Program is source code compiled once by Interp.CompileProgram(),
+// that can be executed many times, also concurrently from multiple goroutines:
+// each execution has its own input variables and its own top-level declarations.
+//
+// Packages, functions, variables and types declared in the Interp are shared
+// by all executions: do not modify them while a Program is executing
+type Program struct {
+	ir       *Interp
+	comp     *Comp // scope of the Program top-level declarations, including the inputs
+	fun      func(*Env) (xr.Value, []xr.Value)
+	types    []xr.Type
+	inputs   map[string]*Bind
+	outputs  map[string]func(*Env) xr.Value
+	nbind    int
+	nintbind int
+}
+
+// Result contains the outcome of an execution of a Program
+type Result struct {
+	Values []xr.Value // values of the last expression of the Program, if any
+	Types  []xr.Type
+	prog   *Program
+	env    *Env
+}
+
+// CompileProgram compiles src into a Program.
+// inputs are the names and types of the variables that each execution receives.
+// Returns parse and compile errors as *EvalError
+func (ir *Interp) CompileProgram(src string, inputs map[string]xr.Type) (prog *Program, err error) {
+	c := NewComp(ir.Comp, nil)
+	kind := ParseError
+	defer func() {
+		if rec := recover(); rec != nil {
+			prog, err = nil, c.makeError(kind, rec)
+		}
+	}()
+	form := ir.Parse(src)
+	kind = CompileError
+
+	prog = &Program{
+		ir:      ir,
+		comp:    c,
+		inputs:  make(map[string]*Bind, len(inputs)),
+		outputs: make(map[string]func(*Env) xr.Value),
+	}
+	for name, t := range inputs {
+		// use c.CompBinds.NewBind() to prevent optimization VarBind -> IntBind:
+		// inputs are stored in Env.Vals[]
+		prog.inputs[name] = c.CompBinds.NewBind(&c.Output, name, VarBind, t)
+	}
+	expr := c.Compile(form)
+	if expr != nil {
+		if c.Globals.Options&base.OptKeepUntyped == 0 && expr.Untyped() {
+			expr.ConstTo(expr.DefaultType())
+		}
+		prog.fun = expr.AsXV(COptKeepUntyped)
+		prog.types = reflect.PackTypes(expr.Type, expr.Types)
+	}
+	for name, bind := range c.Binds {
+		if bind.Desc.Class() != GenericFuncBind && bind.Desc.Class() != GenericTypeBind {
+			prog.outputs[name] = bind.Expr(c.CompGlobals).AsX1()
+		}
+	}
+	prog.nbind, prog.nintbind = c.BindNum, c.IntBindNum
+	return prog, nil
+}
+
+// Run executes the Program in a new environment, with the given values of its inputs.
+// Inputs not specified are set to their zero value.
+// Returns runtime panics as *EvalError, and a *BudgetError if the execution exceeds
+// the Budget set by Interp.SetBudget()
+func (prog *Program) Run(inputs map[string]interface{}) (*Result, error) {
+	return prog.RunContext(context.Background(), inputs)
+}
+
+// RunContext is Run that also interrupts the execution when ctx is cancelled
+// or its deadline passes. See Interp.RunExprContext() for details
+func (prog *Program) RunContext(ctx context.Context, inputs map[string]interface{}) (res *Result, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	ir := prog.ir
+	// each goroutine needs its own Run
+	goid := gls.GoID()
+	run := ir.env.Run.glsGet(goid)
+	if run == nil {
+		run = ir.env.Run.new(goid)
+		run.glsStore()
+		defer run.glsDel()
+	}
+	env := newEnv(run, ir.env, prog.nbind, prog.nintbind)
+	if err = prog.setInputs(env, inputs); err != nil {
+		return nil, err
+	}
+	run.Signals.Sync = base.SigNone
+	run.Signals.Async = base.SigNone
+
+	group := ir.newRunGroup(ctx)
+	if group != nil {
+		defer group.release()
+		group.add(run)
+		defer group.remove(run)
+	}
+	run.PanicEnv = nil
+	defer func() {
+		if rec := recover(); rec != nil {
+			res = nil
+			if group != nil && rec == base.SigInterrupt && group.isCancelled() {
+				err = group.err
+			} else {
+				err = run.panicError(ir.Comp.Fileset, rec)
+			}
+		}
+		run.PanicEnv = nil
+	}()
+	res = &Result{Types: prog.types, prog: prog, env: env}
+	if prog.fun != nil {
+		panicking := true
+		defer run.restoreCurrEnv(run.setCurrEnv(env), &panicking)
+		res.Values = reflect.PackValues(prog.fun(env))
+		panicking = false
+	}
+	return res, nil
+}
+
+// setInputs stores the inputs of the Program in env
+func (prog *Program) setInputs(env *Env, inputs map[string]interface{}) error {
+	for name := range inputs {
+		if prog.inputs[name] == nil {
+			return fmt.Errorf("program has no input named %q", name)
+		}
+	}
+	for name, bind := range prog.inputs {
+		v := xr.New(bind.Type).Elem()
+		if input, ok := inputs[name]; ok && input != nil {
+			value := xr.ValueOf(input)
+			rtype := bind.Type.ReflectType()
+			if !value.Type().AssignableTo(rtype) {
+				if !value.Type().ConvertibleTo(rtype) {
+					return fmt.Errorf("cannot use %v <%v> as input %s <%v>", input, value.Type(), name, bind.Type)
+				}
+				value = value.Convert(rtype)
+			}
+			v.Set(value)
+		}
+		env.Vals[bind.Desc.Index()] = v
+	}
+	return nil
+}
+
+// ValueOf returns the value of a constant, function or variable declared
+// at top level by the Program, or of one of its inputs.
+// Returns the zero Value if there is no such declaration
+func (res *Result) ValueOf(name string) xr.Value {
+	if get := res.prog.outputs[name]; get != nil {
+		return get(res.env)
+	}
+	return xr.Value{}
+}
@@ -24,6 +24,7 @@ import (
 	"unicode/utf8"
 	"unsafe"
 
+	"github.com/WilliamNHarvey/gomacro/base/reflect"
 	xr "github.com/WilliamNHarvey/gomacro/xreflect"
 )
 
@@ -40,7 +41,7 @@ func (c *Comp) Range(node *ast.RangeStmt, labels []string) {
 	erange := c.Expr1(node.X, nil)
 	t := erange.Type
 	if erange.Untyped() {
-		t = erange.DefaultType()
+		t = c.rangeUntypedType(node, erange)
 		erange.ConstTo(t)
 	}
 	var jump rangeJump
@@ -73,6 +74,11 @@ func (c *Comp) Range(node *ast.RangeStmt, labels []string) {
 		c.rangeMap(node, erange, &jump)
 	case xr.String:
 		c.rangeString(node, erange, &jump)
+	case xr.Int, xr.Int8, xr.Int16, xr.Int32, xr.Int64,
+		xr.Uint, xr.Uint8, xr.Uint16, xr.Uint32, xr.Uint64, xr.Uintptr:
+		c.rangeInt(node, erange, &jump)
+	case xr.Func:
+		c.rangeFunc(node, erange, &jump)
 	default:
 		c.Errorf("cannot range over %v <%v>", node.X, t)
 	}
@@ -231,6 +237,74 @@ func (c *Comp) rangeSlice(node *ast.RangeStmt, erange *Expr, jump *rangeJump) {
 	})
 }
 
+// rangeUntypedType returns the type of an untyped constant range expression.
+// Go spec: it is the type of the iteration variable if there is one, otherwise its default type
+func (c *Comp) rangeUntypedType(node *ast.RangeStmt, erange *Expr) xr.Type {
+	t := erange.DefaultType()
+	if node.Tok != token.ASSIGN || node.Key == nil || !reflect.IsCategory(t.Kind(), xr.Int) {
+		return t
+	}
+	if ident, ok := node.Key.(*ast.Ident); ok && ident.Name == "_" {
+		return t
+	}
+	if tkey := c.Place(node.Key).Type; reflect.IsCategory(tkey.Kind(), xr.Int, xr.Uint) {
+		t = tkey
+	}
+	return t
+}
+
+func (c *Comp) rangeInt(node *ast.RangeStmt, erange *Expr, jump *rangeJump) {
+	t := erange.Type
+
+	// save range limit in an unnamed bind
+	bindlimit := c.DeclVar0("", nil, erange)
+	elimit := c.Bind(bindlimit)
+
+	placekey, _ := c.rangeVars(node, t, nil)
+
+	// Go spec: assigning to the iteration variable does not affect the number of iterations.
+	// use an unnamed counter, and copy it to the iteration variable
+	bindcount := c.DeclVar0("", t, nil)
+	ecount := c.Bind(bindcount)
+
+	jump.Start = c.Code.Len()
+
+	// compile comparison against range limit
+	cmpnode := &ast.BinaryExpr{X: node.X, OpPos: node.X.Pos(), Op: token.LSS, Y: node.X}
+	funcmp := c.Lss(cmpnode, ecount, elimit).WithFun().(func(*Env) bool)
+	c.append(func(env *Env) (Stmt, *Env) {
+		var ip int
+		if funcmp(env) {
+			ip = env.IP + 1
+		} else {
+			ip = jump.Break
+		}
+		env.IP = ip
+		return env.Code[ip], env
+	})
+	if placekey != nil {
+		c.SetPlace(placekey, token.ASSIGN, ecount)
+	}
+
+	// compile the body
+	c.Block(node.Body)
+
+	// "continue" is a jump to the increment below
+	jump.Continue = c.Code.Len()
+
+	// increment counter
+	c.Pos = node.End() - 1
+	one := c.exprValue(t, r.ValueOf(1).Convert(t.ReflectType()).Interface())
+	c.SetPlace(bindcount.AsVar(0, PlaceSettable).AsPlace(), token.ADD_ASSIGN, one)
+
+	// jump back to comparison
+	c.append(func(env *Env) (Stmt, *Env) {
+		ip := jump.Start
+		env.IP = ip
+		return env.Code[ip], env
+	})
+}
+
 func (c *Comp) rangeString(node *ast.RangeStmt, erange *Expr, jump *rangeJump) {
 	// save string in an unnamed bind
 	bindrange := c.DeclVar0("", nil, erange)
@@ -0,0 +1,296 @@
+package fast
+
+import (
+	"go/ast"
+	"go/token"
+	r "reflect"
+
+	"github.com/WilliamNHarvey/gomacro/base"
+	xr "github.com/WilliamNHarvey/gomacro/xreflect"
+)
+
+// how the body of a range-over-func loop was exited
+type rangeFuncExit uint8
+
+const (
+	rangeFuncNone rangeFuncExit = iota
+	rangeFuncContinue
+	rangeFuncBreak
+	rangeFuncJump   // break, continue or goto to a statement outside the loop body
+	rangeFuncReturn // return from the function containing the loop
+	rangeFuncPanic  // panic, raised by the loop body or by the iterator
+)
+
+// rangeFuncState is the runtime state of a range-over-func loop.
+//
+// The iterator is called synchronously, and each call to yield() executes the loop body
+// until it reaches the end of the body or exits from it. Exits that cannot be performed
+// while the iterator is running, i.e. return, goto and break or continue to an outer
+// statement, make yield() return false and are completed after the iterator returns.
+// Same for defer: deferred calls are collected and installed after the iterator returns.
+type rangeFuncState struct {
+	exit   rangeFuncExit
+	done   bool // set when yield() returned false or the iterator returned
+	upn    int  // for rangeFuncJump: number of Env:s to exit, starting from the loop Env
+	ip     *int // for rangeFuncJump: jump target
+	panic  interface{}
+	defers []func()
+}
+
+// rangeFunc compiles a range-over-func loop, i.e. a for-range on a func(yield func(...) bool)
+func (c *Comp) rangeFunc(node *ast.RangeStmt, erange *Expr, jump *rangeJump) {
+	t := erange.Type
+	var tyield xr.Type
+	if t.NumIn() == 1 && t.NumOut() == 0 && !t.IsVariadic() {
+		tyield = t.In(0)
+	}
+	if tyield == nil || tyield.Kind() != r.Func || tyield.NumIn() > 2 || tyield.IsVariadic() ||
+		tyield.NumOut() != 1 || tyield.Out(0).Kind() != r.Bool {
+		c.Errorf("cannot range over %v <%v>: func must be func(yield func(...) bool)", node.X, t)
+	}
+	nargs := tyield.NumIn()
+	var targs [2]xr.Type
+	for i := 0; i < nargs; i++ {
+		targs[i] = tyield.In(i)
+	}
+
+	// unnamed bind, contains the loop state
+	bindstate := c.NewBind("", VarBind, c.TypeOfInterface())
+	idxstate := bindstate.Desc.Index()
+
+	// unnamed binds, contain the arguments passed to yield()
+	var bindargs [2]*Bind
+	idxargs := make([]int, nargs)
+	for i := 0; i < nargs; i++ {
+		bindargs[i] = c.NewBind("", VarBind, c.TypeOfInterface())
+		idxargs[i] = bindargs[i].Desc.Index()
+	}
+
+	placekey, placeval := c.rangeVars(node, targs[0], targs[1])
+
+	// the loop may be itself inside the body of another range-over-func loop
+	var outeridx int
+	outerbind, outerupn := c.Outer.rangeFuncOuter()
+	if outerbind != nil {
+		outeridx = outerbind.Desc.Index()
+		outerupn += c.UpCost
+	}
+
+	var ipbody, ipbreak, ippost int
+	c.Loop.Break = &ipbreak
+	c.Loop.RangeFunc = bindstate
+
+	// executed after the iterator returns
+	post := func(env *Env) (Stmt, *Env) {
+		state := env.Vals[idxstate].Interface().(*rangeFuncState)
+		env.Vals[idxstate] = xr.Value{}
+		switch state.exit {
+		case rangeFuncPanic:
+			panic(state.panic)
+		case rangeFuncReturn:
+			run := env.Run
+			run.Signals.Sync = base.SigReturn
+			return run.Interrupt, env
+		case rangeFuncJump:
+			if outerbind != nil && state.upn > outerupn {
+				// jump out of the outer range-over-func loop body too
+				rangeFuncStateOf(env, outerupn, outeridx).jumpOut(state.upn-outerupn, state.ip)
+				return nil, env
+			}
+			o := env
+			for i := 0; i < state.upn; i++ {
+				o = o.Outer
+			}
+			ip := *state.ip
+			o.IP = ip
+			return o.Code[ip], o
+		default:
+			ip := jump.Break
+			env.IP = ip
+			return env.Code[ip], env
+		}
+	}
+
+	funseq := erange.AsX1()
+	rettrue := []xr.Value{xr.MakeValue(r.ValueOf(true).Convert(tyield.Out(0).ReflectType()))}
+	retfalse := []xr.Value{xr.MakeValue(r.ValueOf(false).Convert(tyield.Out(0).ReflectType()))}
+
+	c.append(func(env *Env) (Stmt, *Env) {
+		seq := funseq(env)
+		state := &rangeFuncState{}
+		env.Vals[idxstate] = xr.ValueOf(state)
+		yield := xr.MakeFunc(tyield, func(args []xr.Value) []xr.Value {
+			if state.done {
+				panic("range function continued iteration after function for loop body returned false")
+			}
+			for i, idx := range idxargs {
+				env.Vals[idx] = args[i]
+			}
+			if state.body(env, ipbody) {
+				return rettrue
+			}
+			state.done = true
+			return retfalse
+		})
+		run := env.Run
+		interrupt, caller := run.Interrupt, run.CurrEnv
+		state.call(seq, yield)
+		run.Interrupt, run.CurrEnv = interrupt, caller
+
+		if len(state.defers) != 0 {
+			// install the deferred calls collected while executing the loop body
+			run.InstallDefer = state.deferred(run)
+			run.Signals.Sync = base.SigDefer
+			env.IP = ippost
+			return run.Interrupt, env
+		}
+		return post(env)
+	})
+
+	ipbody = c.Code.Len()
+	if placekey != nil {
+		c.SetPlace(placekey, token.ASSIGN, unwrapBind(bindargs[0], targs[0]))
+	}
+	if placeval != nil {
+		c.SetPlace(placeval, token.ASSIGN, unwrapBind(bindargs[1], targs[1]))
+	}
+
+	// compile the body
+	c.Block(node.Body)
+
+	// "continue" and reaching the end of the body make yield() return true
+	jump.Continue = c.Code.Len()
+	c.append(func(env *Env) (Stmt, *Env) {
+		env.Vals[idxstate].Interface().(*rangeFuncState).exit = rangeFuncContinue
+		return nil, env
+	})
+
+	// "break" makes yield() return false
+	ipbreak = c.Code.Len()
+	c.append(func(env *Env) (Stmt, *Env) {
+		env.Vals[idxstate].Interface().(*rangeFuncState).exit = rangeFuncBreak
+		return nil, env
+	})
+
+	ippost = c.Code.Len()
+	c.append(post)
+}
+
+// call invokes the iterator.
+// If the loop body executed some defer, a panic is recovered and stored in state:
+// it will be raised again after installing the deferred calls
+func (state *rangeFuncState) call(seq xr.Value, yield xr.Value) {
+	panicking := true
+	defer func() {
+		state.done = true
+		if panicking && len(state.defers) != 0 {
+			state.exit = rangeFuncPanic
+			state.panic = recover()
+		}
+	}()
+	seq.Call([]xr.Value{yield})
+	panicking = false
+}
+
+// body executes the loop body, starting at ip, until it exits.
+// returns true if the loop should continue with the next iteration
+func (state *rangeFuncState) body(env *Env, ip int) bool {
+	run := env.Run
+	interrupt, caller := run.Interrupt, run.CurrEnv
+	// make statements that raise a signal return nil, so that we can intercept it
+	run.Interrupt = nil
+	run.CurrEnv = env
+
+	state.exit = rangeFuncNone
+	env.IP = ip
+	stmt := env.Code[ip]
+	for {
+		for stmt != nil && run.Signals.Async == base.SigNone && run.Signals.Debug == base.SigNone {
+			if run.ExecFlags.IsBudget() && !run.spendStatement() {
+				break
+			}
+			stmt, env = stmt(env)
+		}
+		if stmt == nil {
+			if state.exit != rangeFuncNone {
+				break
+			}
+			if sig := run.Signals.Sync; sig == base.SigDefer {
+				run.Signals.Sync = base.SigNone
+				// defers inside the loop body are executed together later,
+				// thus they cannot be deferred directly
+				state.defers = append(state.defers, run.InstallDefer)
+				run.InstallDefer, run.DirectDefer, run.DeferArg = nil, nil, nil
+			} else if sig == base.SigReturn {
+				run.Signals.Sync = base.SigNone
+				state.exit = rangeFuncReturn
+				break
+			}
+			stmt = env.Code[env.IP]
+		}
+		if sig := run.Signals.Async; sig != base.SigNone {
+			run.applyAsyncSignal(sig)
+		}
+		if run.Signals.Debug != base.SigNone {
+			stmt, env = singleStep(env)
+		}
+	}
+	run.Interrupt, run.CurrEnv = interrupt, caller
+	return state.exit == rangeFuncContinue
+}
+
+// jumpOut makes the loop body exit with a jump to a statement outside the loop
+func (state *rangeFuncState) jumpOut(upn int, ip *int) {
+	state.exit = rangeFuncJump
+	state.upn = upn
+	state.ip = ip
+}
+
+// deferred returns a function that executes the deferred calls collected while executing the loop body
+func (state *rangeFuncState) deferred(run *Run) func() {
+	defers := state.defers
+	state.defers = nil
+	return func() {
+		for _, fun := range defers {
+			fun := fun
+			defer func() {
+				// allow recover() in each deferred call
+				run.ExecFlags.SetStartDefer(true)
+				fun()
+			}()
+		}
+	}
+}
+
+// rangeFuncStateOf returns the state of the range-over-func loop stored in the upn-th outer Env
+func rangeFuncStateOf(env *Env, upn int, idx int) *rangeFuncState {
+	for i := 0; i < upn; i++ {
+		env = env.Outer
+	}
+	return env.Vals[idx].Interface().(*rangeFuncState)
+}
+
+// rangeFuncJumpOut returns a statement that exits the body of a range-over-func loop
+// with a jump to a statement outside the loop.
+// upn is the number of Env:s to exit to reach the loop Env,
+// target is the number of Env:s to exit from the loop Env to reach the jump target.
+func rangeFuncJumpOut(upn int, idx int, target int, ip *int) Stmt {
+	return func(env *Env) (Stmt, *Env) {
+		rangeFuncStateOf(env, upn, idx).jumpOut(target, ip)
+		return nil, env
+	}
+}
+
+// rangeFuncOuter returns the unnamed bind holding the state of the innermost range-over-func loop
+// whose body contains c, and the number of Env:s to exit to reach it.
+// Does not cross function boundaries.
+func (c *Comp) rangeFuncOuter() (*Bind, int) {
+	upn := 0
+	for o := c; o != nil && o.Func == nil; o = o.Outer {
+		if o.Loop != nil && o.Loop.RangeFunc != nil {
+			return o.Loop.RangeFunc, upn
+		}
+		upn += o.UpCost
+	}
+	return nil, 0
+}
@@ -18,7 +18,7 @@ package fast
 
 import (
 	"bufio"
-	"fmt"
+	"context"
 	"go/ast"
 	"go/token"
 	"os"
@@ -32,6 +32,7 @@ import (
 	"github.com/WilliamNHarvey/gomacro/base/paths"
 	"github.com/WilliamNHarvey/gomacro/base/reflect"
 	bstrings "github.com/WilliamNHarvey/gomacro/base/strings"
+	"github.com/WilliamNHarvey/gomacro/gls"
 	xr "github.com/WilliamNHarvey/gomacro/xreflect"
 )
 
@@ -116,6 +117,21 @@ func (ir *Interp) RunExpr1(e *Expr) (xr.Value, xr.Type) {
 
 // run without debugging. to execute with single-step debugging, use Interp.DebugExpr() instead
 func (ir *Interp) RunExpr(e *Expr) ([]xr.Value, []xr.Type) {
+	if e == nil {
+		return nil, nil
+	}
+	if group := ir.newRunGroup(context.Background()); group != nil {
+		// evaluation has a Budget
+		defer group.release()
+		defer group.repanic()
+		return ir.runExpr(e, group)
+	}
+	return ir.runExpr(e, nil)
+}
+
+// run without debugging. if group != nil, the execution belongs to group
+// and is interrupted when group is cancelled
+func (ir *Interp) runExpr(e *Expr, group *runGroup) ([]xr.Value, []xr.Type) {
 	if e == nil {
 		return nil, nil
 	}
@@ -127,10 +143,22 @@ func (ir *Interp) RunExpr(e *Expr) ([]xr.Value, []xr.Type) {
 	run := env.Run
 	run.applyDebugOp(DebugOpContinue)
 
-	defer run.setCurrEnv(run.setCurrEnv(env))
+	if group != nil {
+		// add group after PrepareEnv(), which clears pending signals.
+		// top-level code is executed by env.Run, functions by the Run of current goroutine
+		group.add(run)
+		defer group.remove(run)
+		if curr := run.getRun4Goid(gls.GoID()); curr != run {
+			group.add(curr)
+			defer group.remove(curr)
+		}
+	}
+	panicking := true
+	defer run.restoreCurrEnv(run.setCurrEnv(env), &panicking)
 
 	fun := e.AsXV(COptKeepUntyped)
 	v, vs := fun(env)
+	panicking = false
 	return reflect.PackValues(v, vs), reflect.PackTypes(e.Type, e.Types)
 }
 
@@ -157,10 +185,12 @@ func (ir *Interp) DebugExpr(e *Expr) ([]xr.Value, []xr.Type) {
 	}
 	run := env.Run
 	run.applyDebugOp(DebugOpStep)
-	defer run.setCurrEnv(run.setCurrEnv(env))
+	panicking := true
+	defer run.restoreCurrEnv(run.setCurrEnv(env), &panicking)
 
 	fun := e.AsXV(COptKeepUntyped)
 	v, vs := fun(env)
+	panicking = false
 	return reflect.PackValues(v, vs), reflect.PackTypes(e.Type, e.Types)
 }
 
@@ -176,6 +206,15 @@ func (g *Run) setCurrEnv(env *Env) *Env {
 	return old
 }
 
+// restore CurrEnv. If *panicking, also save the innermost Env
+// of the current panic in PanicEnv, unless already saved
+func (g *Run) restoreCurrEnv(env *Env, panicking *bool) {
+	if *panicking && g.PanicEnv == nil {
+		g.PanicEnv = g.CurrEnv
+	}
+	g.CurrEnv = env
+}
+
 // ================ PrepareEnv() ========================
 
 func (ir *Interp) PrepareEnv() *Env {
@@ -348,6 +387,11 @@ func (ir *Interp) ParseEvalPrint(src string) (callAgain bool) {
 	// print phase
 	g.Print(values, types)
 
+	// remember printed results. Files are evaluated without printing results
+	if g.Options&(base.OptShowEval|base.OptMacroExpandOnly) == base.OptShowEval {
+		ir.recordResults(values, types)
+	}
+
 	trap = false // no panic happened
 	return callAgain
 }
@@ -394,54 +438,13 @@ func cmdOptForceEval(g *base.Globals, opt base.CmdOpt) (toenable base.Options) {
 }
 
 // implement code completion API github.com/pererh/liner.WordCompleter
-// Currently only supports global symbols and imported packages,
-// optionally followed by a dot-separated sequence of field or method names,
-// including embedded fields and wrapper methods.
+// Supports symbols, keywords, fields and methods of arbitrary expressions
+// and import paths. See Interp.Complete for details and for completions with hints.
 func (ir *Interp) CompleteWords(line string, pos int) (head string, completions []string, tail string) {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Fprintf(ir.Comp.Stdout, "\npanic in Interp.CompleteWords: %v\n", r)
-			head = ""
-			completions = nil
-			tail = ""
-		}
-	}()
-	if pos > len(line) {
-		pos = len(line)
-	}
-	head = line[:pos]
-	tail = line[pos:]
-	words := strings.Split(head, ".")
-	n := len(words)
-	// find the longest sequence of ident.ident.ident...
-
-	for i := n - 1; i >= 0; i-- {
-		// ignore spaces before and after identifiers
-		words[i] = strings.TrimSpace(words[i])
-
-		if i == n-1 && len(words[i]) == 0 {
-			// last word can be empty: it means TAB immediately after '.'
-			continue
-		}
-		word := TailIdentifier(words[i])
-		if len(word) != len(words[i]) {
-			if len(word) != 0 {
-				words[i] = word
-			} else {
-				i++
-			}
-			words = words[i:]
-			break
-		}
-	}
-	completions = ir.Comp.CompleteWords(words)
-	if len(completions) != 0 {
-		fixed := len(head) - len(TailIdentifier(head))
-		pos := strings.LastIndexByte(head, '.')
-		if pos >= 0 && pos >= fixed {
-			head = head[:pos+1]
-		} else {
-			head = head[:fixed]
+	head, list, tail := ir.Complete(line, pos)
+	for _, completion := range list {
+		if completion.Name != "" {
+			completions = append(completions, completion.Name)
 		}
 	}
 	return head, completions, tail
@@ -581,7 +584,9 @@ func (c *Comp) completeLastWord(node interface{}, word string) []string {
 				}
 			}
 		case xr.Type:
-			completions = c.listFieldsAndMethods(obj, word)
+			for _, completion := range c.completeFieldsAndMethods(obj, word, true) {
+				completions = append(completions, completion.Name)
+			}
 		}
 		break
 	}
@@ -0,0 +1,255 @@
+package fast
+
+import (
+	"fmt"
+	"go/token"
+	r "reflect"
+	"strconv"
+	"unsafe"
+
+	"github.com/WilliamNHarvey/gomacro/base"
+	xr "github.com/WilliamNHarvey/gomacro/xreflect"
+)
+
+// resultHistory contains the results of the last expressions evaluated by the REPL,
+// bound to the identifiers PREFIX1, PREFIX2 ... where PREFIX1 is the most recent one.
+// Multi-valued results are bound to PREFIXn_1, PREFIXn_2 ...
+type resultHistory struct {
+	prefix  string
+	size    int
+	entries [][]result       // entries[0] is the most recent
+	comp    *Comp            // where names are bound
+	binds   map[string]*Bind // bound identifiers
+	free    []*Bind          // variables no longer bound, reused by later results of identical type
+}
+
+type result struct {
+	value xr.Value
+	t     xr.Type
+}
+
+const (
+	defaultResultPrefix = "_"
+	defaultResultSize   = 10
+)
+
+// SetResultHistory configures how the REPL remembers the results of evaluated expressions:
+// the last size results are bound to the identifiers prefix+"1" (the most recent), prefix+"2" ...
+// and each value of a multi-valued result n is bound to prefix+"n_1", prefix+"n_2" ...
+// The default is prefix "_" and size 10. Size 0 disables the history and removes its identifiers
+func (ir *Interp) SetResultHistory(prefix string, size int) error {
+	if !token.IsIdentifier(prefix + "1") {
+		return fmt.Errorf("invalid result prefix %q: %s is not an identifier", prefix, prefix+"1")
+	} else if size < 0 {
+		return fmt.Errorf("invalid result history size %d", size)
+	}
+	h := &ir.Comp.CompGlobals.results
+	ir.unbindResults()
+	h.prefix, h.size = prefix, size
+	if len(h.entries) > size {
+		h.entries = h.entries[:size]
+	}
+	ir.bindResults()
+	return nil
+}
+
+func (h *resultHistory) init() {
+	if h.prefix == "" {
+		h.prefix, h.size = defaultResultPrefix, defaultResultSize
+	}
+}
+
+// recordResults adds the values of an evaluated expression to the result history
+func (ir *Interp) recordResults(values []xr.Value, types []xr.Type) {
+	h := &ir.Comp.CompGlobals.results
+	h.init()
+	if h.size == 0 || len(values) == 0 {
+		return
+	}
+	entry := make([]result, len(values))
+	for i, v := range values {
+		var t xr.Type
+		if i < len(types) {
+			t = types[i]
+		}
+		if t == nil {
+			if !v.IsValid() || !v.CanInterface() {
+				return
+			}
+			t = ir.Comp.TypeOf(v.Interface())
+		}
+		if v.IsValid() {
+			// copy v, it may be the storage of a variable
+			rv := v.ReflectValue()
+			cp := r.New(rv.Type()).Elem()
+			cp.Set(rv)
+			v = xr.MakeValue(cp)
+		}
+		entry[i] = result{v, t}
+	}
+	n := len(h.entries)
+	if n < h.size {
+		h.entries = append(h.entries, nil)
+		n++
+	}
+	copy(h.entries[1:n], h.entries[:n-1])
+	h.entries[0] = entry
+	ir.bindResults()
+}
+
+// resultName returns the identifier for value j of result i, both starting from 0
+func (h *resultHistory) resultName(entry []result, i int, j int) string {
+	name := h.prefix + strconv.Itoa(i+1)
+	if len(entry) > 1 {
+		name += "_" + strconv.Itoa(j+1)
+	}
+	return name
+}
+
+// bindResults binds the result history to its identifiers in the current package.
+// Each identifier is bound to a variable of the result type. Variables are reused
+// for results of identical type, instead of declaring new ones at each evaluation,
+// while code compiled before may still refer to the variables of other types.
+// Identifiers declared by the user after the history bound them are left alone
+func (ir *Interp) bindResults() {
+	c := ir.Comp
+	h := &c.CompGlobals.results
+	if h.comp != c {
+		ir.unbindResults()
+		h.comp = c
+	}
+	prev := h.binds
+	binds := make(map[string]*Bind)
+	type pending struct {
+		name string
+		res  result
+	}
+	var pendings []pending
+	for i, entry := range h.entries {
+		for j, res := range entry {
+			name := h.resultName(entry, i, j)
+			if bind := c.Binds[name]; bind != nil && bind != prev[name] {
+				// declared by the user
+				continue
+			}
+			if bind := prev[name]; bind != nil && h.reusable(bind, res) {
+				delete(prev, name)
+				ir.setResult(bind, res)
+				binds[name] = bind
+			} else {
+				pendings = append(pendings, pending{name, res})
+			}
+		}
+	}
+	for name, bind := range prev {
+		ir.releaseResult(name, bind)
+	}
+	for _, p := range pendings {
+		binds[p.name] = ir.bindResult(p.name, p.res)
+	}
+	h.binds = binds
+}
+
+// reusable returns true if the variable bind can store res
+func (h *resultHistory) reusable(bind *Bind, res result) bool {
+	return !bind.Const() && bind.Type.IdenticalTo(res.t)
+}
+
+func (ir *Interp) bindResult(name string, res result) *Bind {
+	c := ir.Comp
+	h := &c.CompGlobals.results
+	if res.t.IdenticalTo(c.TypeOfUntypedLit()) {
+		// keep untyped constants exact
+		c.DeclConst0(name, nil, res.value.Interface(), res.t)
+		return c.Binds[name]
+	}
+	for i, bind := range h.free {
+		if h.reusable(bind, res) {
+			h.free = append(h.free[:i], h.free[i+1:]...)
+			reuse := *bind
+			reuse.Name = name
+			c.Binds[name] = &reuse
+			ir.setResult(&reuse, res)
+			return &reuse
+		}
+	}
+	v := res.value
+	if !v.IsValid() || !v.CanInterface() {
+		v = xr.Zero(res.t)
+	}
+	ir.DeclVar(name, res.t, v.Interface())
+	return c.Binds[name]
+}
+
+// setResult stores the value of res into the variable bind
+func (ir *Interp) setResult(bind *Bind, res result) {
+	dst := ir.resultVar(bind)
+	if !dst.IsValid() || !dst.CanSet() {
+		return
+	}
+	rdst := dst.ReflectValue()
+	if v := res.value; v.IsValid() && v.ReflectValue().Type().AssignableTo(rdst.Type()) {
+		rdst.Set(v.ReflectValue())
+	} else {
+		rdst.Set(r.Zero(rdst.Type()))
+	}
+}
+
+// releaseResult removes the identifier name bound to bind by the result history, unless the user redeclared it.
+// Variables are set to zero, to release their values, and kept for later results
+func (ir *Interp) releaseResult(name string, bind *Bind) {
+	h := &ir.Comp.CompGlobals.results
+	if h.comp.Binds[name] == bind {
+		delete(h.comp.Binds, name)
+	}
+	if bind.Const() || h.comp != ir.Comp {
+		return
+	}
+	if v := ir.resultVar(bind); v.IsValid() && v.CanSet() {
+		v.Set(xr.ZeroR(v.Type()))
+	}
+	h.free = append(h.free, bind)
+}
+
+// resultVar returns the variable of bind, declared in the current package
+func (ir *Interp) resultVar(bind *Bind) xr.Value {
+	env := ir.PrepareEnv()
+	idx := bind.Desc.Index()
+	if bind.Desc.Class() == IntBind {
+		return xr.MakeValue(r.NewAt(bind.Type.ReflectType(), unsafe.Pointer(&env.Ints[idx])).Elem())
+	}
+	return env.Vals[idx]
+}
+
+// unbindResults removes the identifiers of the result history.
+// Their variables are set to zero, to release their values
+func (ir *Interp) unbindResults() {
+	h := &ir.Comp.CompGlobals.results
+	if h.comp == nil {
+		return
+	}
+	for name, bind := range h.binds {
+		ir.releaseResult(name, bind)
+	}
+	if h.comp != ir.Comp {
+		// variables of another package cannot be reused
+		h.free = nil
+	}
+	h.comp = nil
+	h.binds = nil
+}
+
+// show the result history
+func (ir *Interp) cmdResults(_ string, opt base.CmdOpt) (string, base.CmdOpt) {
+	g := &ir.Comp.Globals
+	h := &ir.Comp.CompGlobals.results
+	if len(h.entries) == 0 {
+		g.Fprintf(g.Stdout, "// no results\n")
+	}
+	for i, entry := range h.entries {
+		for j, res := range entry {
+			g.Fprintf(g.Stdout, "%s = %v\t// %v\n", h.resultName(entry, i, j), res.value.ReflectValue(), res.t)
+		}
+	}
+	return "", opt
+}
@@ -0,0 +1,167 @@
+package fast
+
+import (
+	"strings"
+
+	"github.com/WilliamNHarvey/gomacro/imports"
+)
+
+// Sandbox restricts the packages and package symbols that interpreted code can use.
+//
+// Import paths can end with "/..." to also match all the packages below a path,
+// as "golang.org/x/..." does. Symbols are written as "PATH.NAME", as "os.Remove"
+// or "net/http.Get", and include constants, functions, types and variables.
+//
+// The zero value allows everything
+type Sandbox struct {
+	// if not empty, only these packages can be imported and used
+	AllowImports []string
+	// packages that cannot be imported or used. Takes precedence over AllowImports
+	DenyImports []string
+	// if it contains some symbols of a package, only those symbols of that package can be used
+	AllowSymbols []string
+	// symbols that cannot be used. Takes precedence over AllowSymbols
+	DenySymbols []string
+	// if true, only packages already compiled into the interpreter can be imported:
+	// importing other packages would require compiling and loading a plugin
+	NoPlugins bool
+	// if true, the REPL commands :package and :unload are disabled
+	NoPackageCommands bool
+}
+
+// sandbox is the compiled form of a Sandbox
+type sandbox struct {
+	Sandbox
+	allowImports, denyImports pathSet
+	allowSymbols, denySymbols map[string]map[string]bool // path -> name -> true
+}
+
+// pathSet is a set of import paths, and of path prefixes ending in "/"
+type pathSet struct {
+	paths    map[string]bool
+	prefixes []string
+}
+
+func newPathSet(list []string) pathSet {
+	set := pathSet{paths: make(map[string]bool)}
+	for _, path := range list {
+		if strings.HasSuffix(path, "/...") {
+			path = path[:len(path)-3]
+			set.paths[path[:len(path)-1]] = true
+			set.prefixes = append(set.prefixes, path)
+		} else {
+			set.paths[path] = true
+		}
+	}
+	return set
+}
+
+func (set *pathSet) contains(path string) bool {
+	if set.paths[path] {
+		return true
+	}
+	for _, prefix := range set.prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// newSymbolSet converts a list of "PATH.NAME" to a map PATH -> NAME -> true
+func newSymbolSet(list []string) map[string]map[string]bool {
+	set := make(map[string]map[string]bool)
+	for _, sym := range list {
+		dot := strings.LastIndexByte(sym, '.')
+		if dot < 0 || strings.IndexByte(sym[dot:], '/') >= 0 {
+			continue
+		}
+		path, name := sym[:dot], sym[dot+1:]
+		if set[path] == nil {
+			set[path] = make(map[string]bool)
+		}
+		set[path][name] = true
+	}
+	return set
+}
+
+// SetSandbox restricts the packages and package symbols that interpreted code can use
+// from now on, and the REPL commands available. A nil sandbox removes all restrictions.
+//
+// The restrictions are enforced at compile time: they do not affect
+// code already compiled, nor packages imported by Interp.ImportPackage()
+// until interpreted code uses them
+func (ir *Interp) SetSandbox(s *Sandbox) {
+	cg := ir.Comp.CompGlobals
+	if s == nil {
+		cg.sandbox = nil
+		return
+	}
+	cg.sandbox = &sandbox{
+		Sandbox:      *s,
+		allowImports: newPathSet(s.AllowImports),
+		denyImports:  newPathSet(s.DenyImports),
+		allowSymbols: newSymbolSet(s.AllowSymbols),
+		denySymbols:  newSymbolSet(s.DenySymbols),
+	}
+}
+
+// Sandbox returns a copy of the restrictions set by Interp.SetSandbox(), or nil if there are none
+func (ir *Interp) Sandbox() *Sandbox {
+	sb := ir.Comp.CompGlobals.sandbox
+	if sb == nil {
+		return nil
+	}
+	s := sb.Sandbox
+	return &s
+}
+
+func (sb *sandbox) allowImport(path string) bool {
+	return (len(sb.AllowImports) == 0 || sb.allowImports.contains(path)) && !sb.denyImports.contains(path)
+}
+
+func (sb *sandbox) allowSymbol(path string, name string) bool {
+	if !sb.allowImport(path) || sb.denySymbols[path][name] {
+		return false
+	}
+	allow := sb.allowSymbols[path]
+	return allow == nil || allow[name]
+}
+
+// checkImport fails if the sandbox does not allow importing path
+func (c *Comp) checkImport(path string) {
+	sb := c.CompGlobals.sandbox
+	if sb == nil {
+		return
+	}
+	if !sb.allowImport(path) {
+		c.Errorf("import %q is not allowed by the sandbox", path)
+	}
+	if _, ok := imports.Packages[path]; sb.NoPlugins && !ok && c.CompGlobals.KnownImports[path] == nil {
+		c.Errorf("import %q: package is not compiled into the interpreter, and the sandbox does not allow compiling plugins", path)
+	}
+}
+
+// checkSymbol fails if the sandbox does not allow using the symbol name of package imp
+func (c *Comp) checkSymbol(imp *Import, name string) {
+	if sb := c.CompGlobals.sandbox; sb != nil && !sb.allowSymbol(imp.Path, name) {
+		c.Errorf("use of %s.%s is not allowed by the sandbox", imp.Name, name)
+	}
+}
+
+// allowSymbol returns false if the sandbox does not allow using the symbol name of package imp
+func (c *Comp) allowSymbol(imp *Import, name string) bool {
+	sb := c.CompGlobals.sandbox
+	return sb == nil || sb.allowSymbol(imp.Path, name)
+}
+
+// allowPackageCommands returns false if the sandbox disables the REPL commands :package and :unload
+func (ir *Interp) allowPackageCommands() bool {
+	sb := ir.Comp.CompGlobals.sandbox
+	if sb != nil && sb.NoPackageCommands {
+		g := &ir.Comp.Globals
+		g.Warnf("package commands are disabled by the sandbox")
+		return false
+	}
+	return true
+}
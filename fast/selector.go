@@ -27,6 +27,9 @@ import (
 
 // SelectorExpr compiles foo.bar, i.e. read access to methods, struct fields and imported packages
 func (c *Comp) SelectorExpr(node *ast.SelectorExpr) *Expr {
+	if ident, ok := node.X.(*ast.Ident); ok {
+		c.autoImport(ident.Name)
+	}
 	e, t := c.Expr1OrType(node.X)
 	if t != nil {
 		return c.selectorType(node, t)
@@ -37,6 +40,7 @@ func (c *Comp) SelectorExpr(node *ast.SelectorExpr) *Expr {
 	if t.Kind() == r.Ptr && t.ReflectType() == rtypeOfPtrImport && e.Const() {
 		// access symbol from imported package, for example fmt.Printf
 		imp := e.Value.(*Import)
+		c.checkSymbol(imp, name)
 		return imp.selector(name, &c.Stringer)
 	}
 	if GENERICS_V2_CTI() && e.Untyped() {
@@ -134,46 +138,6 @@ func (c *Comp) TryLookupFieldOrMethod(t xr.Type, name string) (xr.StructField, b
 	return field, fieldn == 1, mtd, mtdn == 1, nil
 }
 
-// list direct and embedded field names that start with prefix,
-// and  explicit and wrapper methods that start with prefix
-func (c *Comp) listFieldsAndMethods(t xr.Type, prefix string) []string {
-	var names []string
-	size := len(prefix)
-
-	collectMethods := func(typ xr.Type) {
-		if t.Kind() == r.Ptr {
-			t = t.Elem()
-			if t.Kind() == r.Interface {
-				// ignore pointer-to-interface
-				return
-			}
-		}
-		for i, n := 0, typ.NumMethod(); i < n; i++ {
-			if name := typ.Method(i).Name; len(name) >= size && name[:size] == prefix {
-				names = append(names, name)
-			}
-		}
-	}
-	if t.Kind() == r.Ptr {
-		t = t.Elem()
-		if t.Kind() == r.Interface {
-			// ignore pointer-to-interface
-			return nil
-		}
-	}
-	collectMethods(t)
-	if t.Kind() == r.Struct {
-		size := len(prefix)
-		c.Universe.VisitFields(t, func(field xr.StructField) {
-			if name := field.Name; len(name) >= size && name[:size] == prefix {
-				names = append(names, name)
-			}
-			collectMethods(field.Type)
-		})
-	}
-	return names
-}
-
 // LookupField performs a breadth-first search for struct field with given name
 func (c *Comp) LookupField(t xr.Type, name string) (field xr.StructField, numfound int) {
 	return t.FieldByName(name, c.FileComp().Path)
@@ -473,9 +437,29 @@ func (c *Comp) compileMethod(node *ast.SelectorExpr, e *Expr, mtd xr.Method) *Ex
 	fun := e.AsX1()
 	tclosure := c.removeFirstParam(mtd.Type)
 
-	return exprX1(tclosure, func(env *Env) xr.Value {
+	ret := exprX1(tclosure, func(env *Env) xr.Value {
 		return obj2method(fun(env))
 	})
+	ret.compiledPkg = compiledMethodPkg(mtd)
+	return ret
+}
+
+// compiledMethodPkg returns the package of the type that declares method mtd,
+// or the empty string if mtd is not declared by compiled code
+func compiledMethodPkg(mtd xr.Method) string {
+	trecv := mtd.Type.In(0)
+	if len(mtd.FieldIndex) != 0 || trecv.Kind() == r.Interface {
+		// wrapper method, or method of an interface
+		return ""
+	}
+	rtrecv := trecv.ReflectType()
+	if rmtd, ok := rtrecv.MethodByName(mtd.Name); !ok || rmtd.Type != mtd.Type.ReflectType() {
+		return ""
+	}
+	if trecv.Kind() == r.Ptr {
+		rtrecv = rtrecv.Elem()
+	}
+	return rtrecv.PkgPath()
 }
 
 // create and return a function that, given a reflect.Value, returns its method specified by mtd
@@ -959,12 +943,16 @@ func (c *Comp) compileMethodAsFunc(t xr.Type, mtd xr.Method) *Expr {
 
 // SelectorPlace compiles a.b returning a settable and/or addressable Place
 func (c *Comp) SelectorPlace(node *ast.SelectorExpr, opt PlaceOption) *Place {
+	if ident, ok := node.X.(*ast.Ident); ok {
+		c.autoImport(ident.Name)
+	}
 	obje := c.Expr1(node.X, nil)
 	te := obje.Type
 	name := node.Sel.Name
 	if te.ReflectType() == rtypeOfPtrImport && obje.Const() {
 		// access settable and/or addressable variable from imported package, for example os.Stdout
 		imp := obje.Value.(*Import)
+		c.checkSymbol(imp, name)
 		return imp.selectorPlace(c, name, opt)
 	}
 	ispointer := false
@@ -0,0 +1,292 @@
+package fast
+
+import (
+	"errors"
+	"go/ast"
+	r "reflect"
+	"unsafe"
+
+	xr "github.com/WilliamNHarvey/gomacro/xreflect"
+)
+
+// Snapshot is a copy of the state of an interpreter, created by Interp.Snapshot()
+// and restored by Interp.Restore().
+//
+// It contains the declarations of the current package, its imported packages,
+// and deep copies of the values of its variables. Deep copies follow pointers, slices,
+// maps, arrays, structs and interfaces, preserving pointers and maps shared among variables.
+// Values of types declared in compiled packages, as *os.File or time.Time, are not deep copied:
+// they may reference objects owned by compiled code, as open files or time.Local,
+// thus they are shared between the interpreter and its snapshots.
+// Channels, functions and unsafe pointers are shared too.
+// Methods added to types are not part of the snapshot either.
+//
+// A snapshot cannot be restored into a different interpreter, because
+// compiled functions and closures refer to the environment of the interpreter that created them
+type Snapshot struct {
+	ir          Interp // current package when the snapshot was taken
+	binds       CompBinds
+	vals        []xr.Value
+	ints        []uint64
+	imports     map[string]*Import
+	packagePath string
+	decls       []ast.Decl
+	genDecls    []*ast.GenDecl
+	stmts       []ast.Stmt
+}
+
+// Snapshot returns a copy of the current state of the interpreter.
+// To roll back to it, call Interp.Restore()
+func (ir *Interp) Snapshot() *Snapshot {
+	c := ir.Comp
+	g := c.CompGlobals
+	env := ir.PrepareEnv()
+	snap := &Snapshot{
+		ir:          *ir,
+		binds:       c.CompBinds,
+		ints:        make([]uint64, c.IntBindNum),
+		imports:     make(map[string]*Import, len(g.KnownImports)),
+		packagePath: g.PackagePath,
+		decls:       g.Declarations[:len(g.Declarations):len(g.Declarations)],
+		genDecls:    g.Imports[:len(g.Imports):len(g.Imports)],
+		stmts:       g.Statements[:len(g.Statements):len(g.Statements)],
+	}
+	snap.binds.Binds = copyBinds(c.Binds)
+	snap.binds.Types = copyTypes(c.Types)
+	for path, imp := range g.KnownImports {
+		snap.imports[path] = imp
+	}
+	snap.vals = make([]xr.Value, c.BindNum)
+	copyVars(snap.vals, snap.ints, env.Vals, env.Ints)
+	return snap
+}
+
+// Restore rolls back the interpreter to the state saved in snap,
+// forgetting the declarations made after the snapshot and restoring
+// the values of variables. Variables keep their address, thus pointers to them remain valid.
+// A snapshot can be restored multiple times
+func (ir *Interp) Restore(snap *Snapshot) error {
+	if snap == nil || snap.ir.Comp.CompGlobals != ir.Comp.CompGlobals {
+		return errors.New("cannot restore a snapshot of a different interpreter")
+	}
+	*ir = snap.ir
+	c := ir.Comp
+	g := c.CompGlobals
+
+	intBindMax := c.IntBindMax // Env.Ints[] addresses may have been taken after the snapshot
+	c.CompBinds = snap.binds
+	c.IntBindMax = intBindMax
+	c.Binds = copyBinds(snap.binds.Binds)
+	c.Types = copyTypes(snap.binds.Types)
+
+	g.KnownImports = make(map[string]*Import, len(snap.imports))
+	for path, imp := range snap.imports {
+		g.KnownImports[path] = imp
+	}
+	g.PackagePath = snap.packagePath
+	g.Declarations, g.Imports, g.Statements = snap.decls, snap.genDecls, snap.stmts
+
+	env := ir.PrepareEnv()
+	vals := env.Vals[:len(snap.vals)]
+	for i, v := range snap.vals {
+		// preserve the address of variables, if possible
+		if curr := vals[i]; !v.CanSet() || !curr.IsValid() || !curr.CanSet() || curr.Type() != v.Type() {
+			vals[i] = xr.Value{}
+		}
+	}
+	copyVars(vals, env.Ints, snap.vals, snap.ints)
+	for i := len(vals); i < len(env.Vals); i++ {
+		env.Vals[i] = xr.Value{}
+	}
+	return nil
+}
+
+func copyBinds(binds map[string]*Bind) map[string]*Bind {
+	if binds == nil {
+		return nil
+	}
+	ret := make(map[string]*Bind, len(binds))
+	for name, bind := range binds {
+		ret[name] = bind
+	}
+	return ret
+}
+
+func copyTypes(types map[string]xr.Type) map[string]xr.Type {
+	if types == nil {
+		return nil
+	}
+	ret := make(map[string]xr.Type, len(types))
+	for name, t := range types {
+		ret[name] = t
+	}
+	return ret
+}
+
+// copyVars stores into dstVals and dstInts a deep copy of the variables in srcVals and srcInts.
+// Variables are copied into the existing elements of dstVals, or into new ones
+// if they are invalid. Pointers to variables in srcVals and srcInts are converted
+// to pointers to the corresponding variables in dstVals and dstInts.
+// Other values, as functions, are not copied
+func copyVars(dstVals []xr.Value, dstInts []uint64, srcVals []xr.Value, srcInts []uint64) {
+	cp := deepCopier{
+		seen: make(map[deepCopyKey]r.Value),
+		vars: make(map[uintptr]deepCopyVar),
+	}
+	src := make([]r.Value, len(srcVals))
+	dst := make([]r.Value, len(srcVals))
+	for i, v := range srcVals {
+		if !v.IsValid() || !v.CanSet() {
+			dstVals[i] = v
+			continue
+		}
+		// do not unwrap xr.Forward: use the actual storage of the variable
+		src[i] = v.Addr().ReflectValue().Elem()
+		if dstVals[i].IsValid() {
+			dst[i] = dstVals[i].Addr().ReflectValue().Elem()
+		} else {
+			dst[i] = r.New(src[i].Type()).Elem()
+			dstVals[i] = xr.MakeValue(dst[i])
+		}
+		cp.vars[src[i].UnsafeAddr()] = deepCopyVar{src[i].Type(), unsafe.Pointer(dst[i].UnsafeAddr())}
+	}
+	for i := range srcInts {
+		cp.vars[uintptr(unsafe.Pointer(&srcInts[i]))] = deepCopyVar{nil, unsafe.Pointer(&dstInts[i])}
+	}
+	copy(dstInts, srcInts)
+	for i := range src {
+		if src[i].IsValid() {
+			cp.copyInto(dst[i], src[i])
+		}
+	}
+}
+
+// deepCopier creates deep copies of values, preserving shared pointers and maps
+type deepCopier struct {
+	seen map[deepCopyKey]r.Value
+	vars map[uintptr]deepCopyVar // address of source variable -> destination variable
+}
+
+type deepCopyVar struct {
+	t    r.Type // nil for variables stored in Env.Ints[]
+	addr unsafe.Pointer
+}
+
+type deepCopyKey struct {
+	ptr uintptr
+	t   r.Type
+}
+
+// copy returns a deep copy of v
+func (cp *deepCopier) copy(v r.Value) r.Value {
+	if v.Kind() != r.Ptr && compiledType(v.Type()) {
+		return v
+	}
+	switch v.Kind() {
+	case r.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		if dst, ok := cp.vars[v.Pointer()]; ok && (dst.t == nil || dst.t == v.Type().Elem()) {
+			return r.NewAt(v.Type().Elem(), dst.addr)
+		}
+		if compiledType(v.Type().Elem()) {
+			// as *os.File: copying the pointed object would duplicate resources owned by compiled code
+			return v
+		}
+		key := deepCopyKey{v.Pointer(), v.Type()}
+		if ret, ok := cp.seen[key]; ok {
+			return ret
+		}
+		ret := r.New(v.Type().Elem())
+		cp.seen[key] = ret
+		cp.copyInto(ret.Elem(), v.Elem())
+		return ret
+	case r.Map:
+		if v.IsNil() {
+			return v
+		}
+		key := deepCopyKey{v.Pointer(), v.Type()}
+		if ret, ok := cp.seen[key]; ok {
+			return ret
+		}
+		ret := r.MakeMapWithSize(v.Type(), v.Len())
+		cp.seen[key] = ret
+		iter := v.MapRange()
+		for iter.Next() {
+			ret.SetMapIndex(cp.copy(iter.Key()), cp.copy(iter.Value()))
+		}
+		return ret
+	case r.Slice:
+		if v.IsNil() {
+			return v
+		}
+		ret := r.MakeSlice(v.Type(), v.Len(), v.Cap())
+		for i, n := 0, v.Len(); i < n; i++ {
+			cp.copyInto(ret.Index(i), v.Index(i))
+		}
+		return ret
+	case r.Array, r.Struct:
+		ret := r.New(v.Type()).Elem()
+		cp.copyInto(ret, v)
+		return ret
+	case r.Interface:
+		if v.IsNil() {
+			return v
+		}
+		ret := r.New(v.Type()).Elem()
+		ret.Set(cp.copy(v.Elem()))
+		return ret
+	default:
+		// basic kinds and strings are immutable.
+		// channels, functions and unsafe pointers are shared
+		return v
+	}
+}
+
+// copyInto stores a deep copy of src into dst, which must be settable
+func (cp *deepCopier) copyInto(dst r.Value, src r.Value) {
+	if compiledType(src.Type()) {
+		dst.Set(src)
+		return
+	}
+	switch src.Kind() {
+	case r.Array:
+		src = addressable(src)
+		for i, n := 0, src.Len(); i < n; i++ {
+			cp.copyInto(dst.Index(i), src.Index(i))
+		}
+	case r.Struct:
+		src = addressable(src)
+		for i, n := 0, src.NumField(); i < n; i++ {
+			cp.copyInto(accessible(dst.Field(i)), accessible(src.Field(i)))
+		}
+	default:
+		dst.Set(cp.copy(src))
+	}
+}
+
+// compiledType returns true if t was declared in a compiled package.
+// Types created by the interpreter, including named ones, have no package path,
+// and use xr.Forward for recursive fields
+func compiledType(t r.Type) bool {
+	return t.PkgPath() != "" && t != rtypeOfForward
+}
+
+// addressable returns an addressable copy of v, unless v is already addressable
+func addressable(v r.Value) r.Value {
+	if v.CanAddr() {
+		return v
+	}
+	ret := r.New(v.Type()).Elem()
+	ret.Set(v)
+	return ret
+}
+
+// accessible returns a settable alias of the addressable struct field v, even if unexported
+func accessible(v r.Value) r.Value {
+	if v.CanSet() {
+		return v
+	}
+	return r.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem()
+}
@@ -20,7 +20,9 @@ import (
 	"go/ast"
 	"go/token"
 	r "reflect"
+	"runtime"
 	"sort"
+	"strings"
 
 	"github.com/WilliamNHarvey/gomacro/base"
 	"github.com/WilliamNHarvey/gomacro/base/output"
@@ -90,6 +92,7 @@ func (c *Comp) Stmt(in ast.Stmt) {
 			if c.Labels == nil {
 				c.Labels = map[string]*int{label: &ip}
 			} else if addr := c.Labels[label]; addr != nil {
+				c.checkGotoBinds(label)
 				*addr = ip
 			} else {
 				c.Labels[label] = &ip
@@ -185,6 +188,9 @@ func (c *Comp) List(list []ast.Stmt) {
 
 	c2, locals := c.pushEnvIfLocalBinds(&nbinds, list...)
 
+	// labels are visible in the whole block, also before their declaration
+	c2.declLabels(list)
+
 	for _, node := range list {
 		c2.Stmt(node)
 	}
@@ -267,24 +273,99 @@ func (c *Comp) Goto(node *ast.BranchStmt) {
 	}
 	label := node.Label.Name
 	upn := 0
-	// do not cross function boundaries
-	for o := c; o != nil && o.Func == nil; o = o.Outer {
+	for o := c; o != nil; o = o.Outer {
 		if ip := o.Labels[label]; ip != nil {
+			if *ip < 0 {
+				// forward goto: label is declared later in the same block or in an enclosing one.
+				// remember how many variables are in scope, to detect jumps over variable declarations
+				if o.Gotos == nil {
+					o.Gotos = make(map[string]int)
+				}
+				if _, ok := o.Gotos[label]; !ok {
+					o.Gotos[label] = o.BindNum + o.IntBindNum
+				}
+			}
 			// only keep a reference to the jump target, NOT TO THE WHOLE *Comp!
+			// for forward goto, the jump target will be set when compiling the label
 			c.jumpOut(upn, ip)
 			return
 		}
+		if o.Func != nil {
+			// do not cross function boundaries
+			break
+		}
 		upn += o.UpCost // count how many Env:s we must exit at runtime
 	}
 	c.Errorf("goto label not found: %v", label)
 }
 
+// declLabels declares the labels of a statement list before compiling it,
+// so that forward goto statements can find them
+func (c *Comp) declLabels(list []ast.Stmt) {
+	declared := c.funcLabels()
+	for _, node := range list {
+		for {
+			labeled, ok := node.(*ast.LabeledStmt)
+			if !ok {
+				break
+			}
+			if c.Labels == nil {
+				c.Labels = make(map[string]*int)
+			}
+			label := labeled.Label.Name
+			if declared[label] {
+				c.Pos = labeled.Pos()
+				c.Errorf("label %s already defined", label)
+			}
+			declared[label] = true
+			if c.Labels[label] == nil {
+				ip := -1
+				c.Labels[label] = &ip
+			}
+			node = labeled.Stmt
+		}
+	}
+}
+
+// funcLabels returns the labels declared in the enclosing function.
+// Outside functions, returns a new empty map
+func (c *Comp) funcLabels() map[string]bool {
+	for o := c; o != nil; o = o.Outer {
+		if info := o.Func; info != nil {
+			if info.labels == nil {
+				info.labels = make(map[string]bool)
+			}
+			return info.labels
+		}
+	}
+	return make(map[string]bool)
+}
+
+// checkGotoBinds verifies that forward goto statements to label
+// do not jump over variable declarations
+func (c *Comp) checkGotoBinds(label string) {
+	nbind, ok := c.Gotos[label]
+	if !ok {
+		return
+	}
+	delete(c.Gotos, label)
+	if nbind != c.BindNum+c.IntBindNum {
+		c.Errorf("goto %s jumps over variable declaration", label)
+	}
+}
+
 // Defer compiles a "defer" statement
 func (c *Comp) Defer(node *ast.DeferStmt) {
 	call := c.prepareCall(node.Call, nil)
 	fun := call.Fun.AsX1()
 	argfuns := call.MakeArgfunsX1()
 	ellipsis := call.Ellipsis
+	// compiled functions are deferred directly if possible, so they can recover() panics
+	var direct r.Type
+	if !ellipsis {
+		direct = directDeferType(call.Fun.Type.ReflectType())
+	}
+	compiled := call.Fun.compiledPkg != ""
 	c.Append(func(env *Env) (Stmt, *Env) {
 		// Go specs: arguments of a defer call are evaluated immediately.
 		// the call itself is executed when the function containing defer returns,
@@ -303,7 +384,21 @@ func (c *Comp) Defer(node *ast.DeferStmt) {
 		}
 		env.IP++
 		run := env.Run
-		if ellipsis {
+		if direct != nil && (compiled || isCompiledFunc(f)) {
+			run.DirectDefer = f.ReflectValue().Convert(direct).Interface()
+			if len(args) == 1 {
+				if args[0].IsValid() {
+					run.DeferArg = args[0].Interface()
+				} else {
+					run.DeferArg = r.Zero(direct.In(0)).Interface()
+				}
+			}
+		}
+		// InstallDefer is also needed if DirectDefer has arguments:
+		// defers inside range-over-func loop bodies cannot be deferred directly
+		if g, ok := run.DirectDefer.(func()); ok {
+			run.InstallDefer = g
+		} else if ellipsis {
 			run.InstallDefer = func() {
 				f.CallSlice(args)
 			}
@@ -318,9 +413,54 @@ func (c *Comp) Defer(node *ast.DeferStmt) {
 	c.Code.WithDefers = true
 }
 
+// directDeferTypes are the types of compiled functions that can be deferred directly.
+// Go recover() only works if invoked directly by the deferred function,
+// thus reflect.Value.Call() cannot be used, and each type must be deferred explicitly
+var directDeferTypes = []r.Type{
+	r.TypeOf((*func())(nil)).Elem(),
+	r.TypeOf((*func(*error))(nil)).Elem(),
+	r.TypeOf((*func(string))(nil)).Elem(),
+	r.TypeOf((*func(interface{}))(nil)).Elem(),
+}
+
+// directDeferType returns the type among directDeferTypes that rtype can be converted to, or nil
+func directDeferType(rtype r.Type) r.Type {
+	if rtype.Kind() != r.Func {
+		return nil
+	}
+	for _, t := range directDeferTypes {
+		if rtype.ConvertibleTo(t) {
+			return t
+		}
+	}
+	return nil
+}
+
+// isCompiledFunc returns true if f is a compiled function,
+// i.e. it was not created by the interpreter nor by reflect.MakeFunc()
+func isCompiledFunc(f xr.Value) bool {
+	rf := f.ReflectValue()
+	if rf.Kind() != r.Func || rf.IsNil() {
+		return false
+	}
+	fun := runtime.FuncForPC(rf.Pointer())
+	if fun == nil {
+		return false
+	}
+	name := fun.Name()
+	return !strings.HasPrefix(name, fastPkgPrefix) && !strings.HasPrefix(name, "reflect.")
+}
+
+var fastPkgPrefix = r.TypeOf(Comp{}).PkgPath() + "."
+
 // jumpOut compiles a break or continue statement
 // ip is a pointer because the jump target may not be known yet... it will be filled later
 func (c *Comp) jumpOut(upn int, ip *int) {
+	if bind, rangeupn := c.rangeFuncOuter(); bind != nil && upn > rangeupn {
+		// jump out of a range-over-func loop body: the loop must stop the iterator first
+		c.append(rangeFuncJumpOut(rangeupn, bind.Desc.Index(), upn-rangeupn, ip))
+		return
+	}
 	var stmt Stmt
 	switch upn {
 	case 0:
@@ -467,11 +607,22 @@ func (c *Comp) Go(node *ast.GoStmt) {
 		}
 		// the call is executed in a new goroutine.
 		// make it easy and do not try to optimize this call.
+		tg.spendGoroutine()
+		tg2 := tg.new(0)
+		group := tg.group
+		if group != nil {
+			// add the goroutine to the group before starting it:
+			// the group must not complete in the meantime
+			group.add(tg2)
+		}
 		go func() {
-			tg2 := tg.new(gls.GoID())
+			tg2.goid = gls.GoID()
 			env2.Run = tg2
 			tg2.glsStore()
 			defer tg2.glsDel()
+			if group != nil {
+				defer group.exit(tg2)
+			}
 
 			funv.Call(argv)
 		}()
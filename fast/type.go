@@ -35,11 +35,9 @@ func (c *Comp) DeclType(spec ast.Spec) {
 	if !ok {
 		c.Errorf("unexpected type declaration, expecting *ast.TypeSpec, found: %v // %T", spec, spec)
 	}
-	if GENERICS_V1_CXX() || GENERICS_V2_CTI() {
-		if lit, _ := node.Type.(*ast.CompositeLit); lit != nil {
-			c.DeclGenericType(node)
-			return
-		}
+	if lit, _ := node.Type.(*ast.CompositeLit); lit != nil {
+		c.DeclGenericType(node)
+		return
 	}
 	name := node.Name.Name
 	// support type aliases
@@ -62,9 +60,18 @@ func (c *Comp) DeclType(spec ast.Spec) {
 		}
 	}()
 	t := c.DeclNamedType(name)
-	u := c.Type(node.Type)
+	var u xr.Type
+	if _, ok := node.Type.(*ast.InterfaceType); ok {
+		// named interfaces can contain type constraints
+		u = c.constraintType(node.Type)
+	} else {
+		u = c.Type(node.Type)
+	}
 	if t != nil { // t == nil means name == "_", discard the result of type declaration
 		c.SetUnderlyingType(t, u)
+		if iface, ok := node.Type.(*ast.InterfaceType); ok {
+			c.declConstraint(t, iface)
+		}
 	}
 	panicking = false
 }
@@ -217,11 +224,7 @@ func (c *Comp) compileType2(node ast.Expr, allowEllipsis bool) (t xr.Type, ellip
 	case *ast.Ident:
 		t = c.ResolveType(node.Name)
 	case *ast.IndexExpr:
-		if GENERICS_V1_CXX() || GENERICS_V2_CTI() {
-			t = c.GenericType(node)
-		} else {
-			c.Errorf("unimplemented type: %v <%v>", node, r.TypeOf(node))
-		}
+		t = c.GenericType(node)
 	case *ast.InterfaceType:
 		t = c.TypeInterface(node)
 	case *ast.MapType:
@@ -236,6 +239,7 @@ func (c *Comp) compileType2(node ast.Expr, allowEllipsis bool) (t xr.Type, ellip
 		// this could be Package.Type, or other non-type expressions: Type.Method, Value.Method, Struct.Field...
 		// check for Package.Type
 		name := ident.Name
+		c.autoImport(name)
 		var bind *Bind
 		for o := c; o != nil; o = o.Outer {
 			if bind = o.Binds[name]; bind != nil {
@@ -252,6 +256,7 @@ func (c *Comp) compileType2(node ast.Expr, allowEllipsis bool) (t xr.Type, ellip
 			c.Errorf("not a package: %q in %v <%v>", name, node, r.TypeOf(node))
 		}
 		name = node.Sel.Name
+		c.checkSymbol(imp, name)
 		t, ok = imp.Types[name]
 		if !ok || t == nil {
 			c.Errorf("not a type: %v <%v>", node, r.TypeOf(node))
@@ -276,6 +281,9 @@ func (c *Comp) compileType2(node ast.Expr, allowEllipsis bool) (t xr.Type, ellip
 		c.Errorf("unimplemented type: %v <%v>", node, r.TypeOf(node))
 	}
 	if t != nil {
+		if c.inConstraint == 0 && c.lookupConstraint(t) != nil {
+			c.Errorf("cannot use type %v outside a type constraint: interface contains type constraints", t)
+		}
 		for i := 0; i < stars; i++ {
 			t = universe.PtrTo(t)
 		}
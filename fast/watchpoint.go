@@ -0,0 +1,203 @@
+package fast
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	r "reflect"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/WilliamNHarvey/gomacro/base"
+	xr "github.com/WilliamNHarvey/gomacro/xreflect"
+)
+
+// Watchpoint stops execution at the statement that modified an interpreted variable,
+// created by Interp.SetWatchpoint()
+type Watchpoint struct {
+	ID      int
+	Name    string
+	Type    xr.Type
+	Enabled bool
+	Hits    int       // number of times the variable was modified
+	Ignore  int       // number of hits to ignore before stopping
+	Old     string    // previous value, formatted
+	Value   string    // current value, formatted
+	Pos     token.Pos // position of the statement that last modified the variable
+	g       *CompGlobals
+	env     *Env // the Env containing the variable
+	bind    Bind
+	mem     []byte // copy of the variable's memory
+}
+
+func (w *Watchpoint) String() string {
+	return "watch " + w.Name
+}
+
+// memory returns the memory of the watched variable
+func (w *Watchpoint) memory() []byte {
+	idx := w.bind.Desc.Index()
+	if w.bind.Desc.Class() == IntBind {
+		return (*[8]byte)(unsafe.Pointer(&w.env.Ints[idx]))[:]
+	}
+	v := w.env.Vals[idx].ReflectValue()
+	if !v.IsValid() {
+		return nil
+	} else if !v.CanAddr() {
+		// should not happen, variables are addressable. compare the formatted values
+		return []byte(w.value())
+	}
+	size := int(v.Type().Size())
+	if size == 0 {
+		return nil
+	}
+	mem := (*[1 << 30]byte)(unsafe.Pointer(v.UnsafeAddr()))[:size:size]
+	// also compare the contents of slices and maps, to detect s[i] = x and m[k] = x.
+	// since cap(mem) == len(mem), append() copies mem and never modifies the variable
+	switch v.Kind() {
+	case r.Slice:
+		if n := v.Len() * int(v.Type().Elem().Size()); n != 0 {
+			mem = append(mem, unsafe.Slice((*byte)(unsafe.Pointer(v.Pointer())), n)...)
+		}
+	case r.Map:
+		if v.Len() != 0 {
+			// map elements are not addressable. compare the formatted map, fmt sorts its keys
+			mem = append(mem, fmt.Sprintf("%v", v)...)
+		}
+	}
+	return mem
+}
+
+// value returns the current value of the watched variable, formatted
+func (w *Watchpoint) value() string {
+	v := w.bind.RuntimeValue(w.g, w.env)
+	if !v.IsValid() {
+		return "<nil>"
+	}
+	return fmt.Sprintf("%v", v.ReflectValue())
+}
+
+// update saves the current value of the watched variable.
+// returns true if it changed since the last update
+func (w *Watchpoint) update() bool {
+	mem := w.memory()
+	if bytes.Equal(mem, w.mem) {
+		return false
+	}
+	w.mem = append(w.mem[:0], mem...)
+	w.Old, w.Value = w.Value, w.value()
+	return true
+}
+
+func (b *breakpoints) addWatch(w *Watchpoint) *Watchpoint {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.lastID++
+	w.ID = b.lastID
+	w.Enabled = true
+	b.watches = append(b.watches, w)
+	atomic.StoreInt32(&b.nwatch, int32(len(b.watches)))
+	return w
+}
+
+// watching returns true if there are watchpoints
+func (b *breakpoints) watching() bool {
+	return atomic.LoadInt32(&b.nwatch) != 0
+}
+
+// changed returns the first enabled watchpoint whose variable changed and whose hit count is not ignored,
+// and updates all watchpoints. pos is the position of the statement just executed
+func (b *breakpoints) changed(pos token.Pos) *Watchpoint {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var ret *Watchpoint
+	for _, w := range b.watches {
+		if !w.update() || !w.Enabled {
+			continue
+		}
+		w.Hits++
+		w.Pos = pos
+		if w.Ignore > 0 {
+			w.Ignore--
+		} else if ret == nil {
+			ret = w
+		}
+	}
+	return ret
+}
+
+func (b *breakpoints) copyWatches() []Watchpoint {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	ret := make([]Watchpoint, len(b.watches))
+	for i, w := range b.watches {
+		ret[i] = *w
+		ret[i].mem = nil
+	}
+	return ret
+}
+
+// checkWatchpoints enters the debugger if a watched variable was modified
+// by the statement just executed, i.e. the statement at stmtenv.DebugPos[ip],
+// and returns the resulting debug signal
+func checkWatchpoints(stmtenv *Env, ip int, env *Env) base.Signal {
+	run := env.Run
+	var pos token.Pos
+	if ip < len(stmtenv.DebugPos) {
+		pos = stmtenv.DebugPos[ip]
+	}
+	w := run.breakpoints.changed(pos)
+	if w == nil || env.DebugComp == nil {
+		return run.Signals.Debug
+	}
+	run.Watch = w
+	defer func() {
+		run.Watch = nil
+	}()
+	ir := Interp{env.DebugComp, env}
+	return ir.debug(true)
+}
+
+// SetWatchpoint sets a watchpoint on the interpreted variable with given name,
+// visible in the current scope of ir: the debugger will stop
+// after each statement that modifies the variable.
+// For slices and maps, also modifying their elements is detected.
+// Other data reachable from the variable, as the values pointed to by pointers, is not watched.
+// While watchpoints exist, code is executed in single-step mode, which is much slower.
+// Requires debugger support, i.e. base.OptDebugger
+func (ir *Interp) SetWatchpoint(name string) (*Watchpoint, error) {
+	c := ir.Comp
+	sym := c.TryResolve(name)
+	if sym == nil {
+		return nil, fmt.Errorf("undefined identifier: %s", name)
+	}
+	class := sym.Desc.Class()
+	if class != VarBind && class != IntBind {
+		return nil, fmt.Errorf("cannot watch %s: not a variable", name)
+	}
+	env := ir.env
+	for i := 0; i < sym.Upn; i++ {
+		env = env.Outer
+	}
+	if env == nil {
+		return nil, fmt.Errorf("cannot watch %s: variable not found at runtime", name)
+	}
+	// the Env must not be reused after the function containing the variable returns
+	env.MarkUsedByClosure()
+
+	w := &Watchpoint{Name: name, Type: sym.Type, g: c.CompGlobals, env: env, bind: sym.Bind}
+	w.update()
+	w.Old = w.Value
+	c.breakpoints.addWatch(w)
+
+	// watchpoints are checked while single-stepping
+	run := ir.env.Run
+	run.Signals.Debug = base.SigDebug
+	run.ExecFlags.SetDebug(true)
+	return w, nil
+}
+
+// Watchpoints returns a copy of the current watchpoints, sorted by ID
+func (ir *Interp) Watchpoints() []Watchpoint {
+	return ir.Comp.breakpoints.copyWatches()
+}
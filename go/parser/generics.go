@@ -21,6 +21,7 @@ import (
 	"go/token"
 
 	etoken "github.com/WilliamNHarvey/gomacro/go/etoken"
+	"github.com/WilliamNHarvey/gomacro/go/scanner"
 )
 
 // enable C++-style generics?
@@ -171,3 +172,212 @@ func genericFuncDecl(params *ast.CompositeLit, decl *ast.FuncDecl) *ast.FuncDecl
 	recv.List = list
 	return decl
 }
+
+// ----------------------------------------------------------------------------
+// Go 1.18 standard syntax for type parameters:
+//    func Name[T1 C1, T2 C2...] (...)
+//    type Name[T1 C1, T2 C2...] ...
+//    Name[T1, T2...]
+// it is parsed using the same representation as GENERICS_V2_CTI, i.e.
+//    prefix#[T1:C1,T2:C2...]
+// thus it is accepted regardless of the value of etoken.GENERICS
+
+// return the next non-comment token after p.tok, without consuming it.
+// s must be a snapshot of p.scanner
+func peekToken(s *scanner.Scanner) token.Token {
+	for {
+		_, tok, _ := s.Scan()
+		if tok != token.COMMENT {
+			return tok
+		}
+	}
+}
+
+// return true if tok can start a type
+func canStartType(tok token.Token) bool {
+	switch tok {
+	case token.IDENT, token.LBRACK, token.MUL, token.LPAREN, token.FUNC, etoken.LAMBDA,
+		token.MAP, token.CHAN, token.STRUCT, token.INTERFACE, token.ARROW:
+		return true
+	}
+	return false
+}
+
+// called at '[' after a type name.
+// return true if '[' starts a list of type arguments, as in 'Pair[int, string]'
+// and false if it starts an array or slice type, as in the parameter 'name [N]T'
+func (p *parser) isTypeArgs() bool {
+	s := p.scanner.Snapshot()
+	switch peekToken(&s) {
+	case token.RBRACK, token.ELLIPSIS:
+		// name []T or name [...]T
+		return false
+	case token.LBRACK, token.LPAREN, token.LBRACE:
+		if !skipBrackets(&s, 2) {
+			return false
+		}
+	default:
+		if !skipBrackets(&s, 1) {
+			return false
+		}
+	}
+	// after Foo[...] there cannot be a type
+	return !canStartType(peekToken(&s))
+}
+
+// skip tokens until depth nested brackets, braces or parenthesis are closed.
+// return false on EOF
+func skipBrackets(s *scanner.Scanner, depth int) bool {
+	for depth > 0 {
+		switch peekToken(s) {
+		case token.LBRACK, token.LPAREN, token.LBRACE:
+			depth++
+		case token.RBRACK, token.RPAREN, token.RBRACE:
+			depth--
+		case token.EOF:
+			return false
+		}
+	}
+	return true
+}
+
+// called at '[' after the name in a type declaration.
+// return true if '[' starts a list of type parameters, as in 'type Set[T comparable] ...'
+// and false if it starts an array type, as in 'type Vector [N]float64'
+func (p *parser) isTypeParams() bool {
+	s := p.scanner.Snapshot()
+	if peekToken(&s) != token.IDENT {
+		return false
+	}
+	switch peekToken(&s) {
+	case token.IDENT, token.COMMA, token.TILDE, token.LBRACK,
+		token.INTERFACE, token.MAP, token.CHAN, token.FUNC, token.STRUCT:
+		return true
+	}
+	return false
+}
+
+// parse [T1 C1, T2 C2...] in a generic declaration.
+// consecutive parameters can share the same constraint, as in [K, V any]
+func (p *parser) parseTypeParams() *ast.CompositeLit {
+	if p.trace {
+		defer un(trace(p, "TypeParams"))
+	}
+	var list []ast.Expr
+	var names []*ast.Ident
+
+	lbrack := p.expect(token.LBRACK)
+	for p.tok != token.RBRACK && p.tok != token.EOF {
+		names = append(names, p.parseIdent())
+		if p.tok == token.COMMA {
+			p.next()
+			continue
+		}
+		constraint := p.parseTypeUnion(nil)
+		for _, name := range names {
+			list = append(list, &ast.KeyValueExpr{Key: name, Value: constraint})
+		}
+		names = nil
+		if p.tok != token.COMMA {
+			break
+		}
+		p.next()
+	}
+	if len(names) != 0 {
+		p.errorExpected(p.pos, "type constraint")
+	}
+	rbrack := p.expect(token.RBRACK)
+
+	return &ast.CompositeLit{
+		Lbrace: lbrack,
+		Elts:   list,
+		Rbrace: rbrack,
+	}
+}
+
+// parse Foo[T1,T2...] in a type context
+func (p *parser) parseTypeArgs(prefix ast.Expr) ast.Expr {
+	if p.trace {
+		defer un(trace(p, "TypeArgs"))
+	}
+	var list []ast.Expr
+
+	lbrack := p.expect(token.LBRACK)
+	p.exprLev++
+	for p.tok != token.RBRACK && p.tok != token.EOF {
+		list = append(list, p.parseRhsOrType())
+		if p.tok != token.COMMA {
+			break
+		}
+		p.next()
+	}
+	p.exprLev--
+	rbrack := p.expect(token.RBRACK)
+
+	return &ast.IndexExpr{
+		X:      prefix,
+		Lbrack: lbrack,
+		Index: &ast.CompositeLit{
+			Lbrace: lbrack,
+			Elts:   list,
+			Rbrace: rbrack,
+		},
+		Rbrack: rbrack,
+	}
+}
+
+// parse the union T1 | ~T2 | ... in a type constraint.
+// if x != nil, it is the already parsed first term
+//
+// T1 | T2 is represented as &ast.BinaryExpr{X: T1, Op: token.OR, Y: T2}
+// ~T is represented as &ast.UnaryExpr{Op: token.TILDE, X: T}
+func (p *parser) parseTypeUnion(x ast.Expr) ast.Expr {
+	if p.trace {
+		defer un(trace(p, "TypeUnion"))
+	}
+	if x == nil {
+		x = p.parseTypeTerm()
+	}
+	for p.tok == token.OR {
+		pos := p.pos
+		p.next()
+		x = &ast.BinaryExpr{X: x, OpPos: pos, Op: token.OR, Y: p.parseTypeTerm()}
+	}
+	return x
+}
+
+// parse T or ~T in a type constraint
+func (p *parser) parseTypeTerm() ast.Expr {
+	if p.tok == token.TILDE {
+		pos := p.pos
+		p.next()
+		return &ast.UnaryExpr{OpPos: pos, Op: token.TILDE, X: p.parseType()}
+	}
+	return p.parseType()
+}
+
+// return true if tok can start a type element inside an interface,
+// as ~int or []byte in interface { ~int | []byte }
+func isTypeElemStart(tok token.Token) bool {
+	switch tok {
+	case token.TILDE, token.LBRACK, token.MUL, token.LPAREN,
+		token.MAP, token.CHAN, token.STRUCT, token.INTERFACE, token.ARROW:
+		return true
+	case token.FUNC:
+		// with generics v2, 'func' inside interfaces starts a method with explicit receiver
+		return !GENERICS_V2_CTI()
+	}
+	return false
+}
+
+// parse a type element inside an interface, as ~int | []byte in interface { ~int | []byte }
+func (p *parser) parseTypeElemSpec() *ast.Field {
+	if p.trace {
+		defer un(trace(p, "TypeElemSpec"))
+	}
+	doc := p.leadComment
+	typ := p.parseTypeUnion(nil)
+	p.expectSemi() // call before accessing p.linecomment
+
+	return &ast.Field{Doc: doc, Type: typ, Comment: p.lineComment}
+}
@@ -1000,12 +1000,18 @@ func (p *parser) parseMethodSpec(scope *ast.Scope) *ast.Field {
 		// and must be followed by the function name
 		ident = p.parseIdent()
 	} else {
-		// either method or embedded interface
+		// either method, embedded interface or type element
 		typ = p.parseTypeName()
+		if p.tok == token.LBRACK && p.isTypeArgs() {
+			typ = p.parseTypeArgs(typ)
+		}
 		ident, _ = typ.(*ast.Ident)
-	}
-	if ident != nil {
-		idents = []*ast.Ident{ident}
+		if p.tok == token.OR {
+			// type element T1 | T2 ...
+			ident = nil
+			p.resolve(typ)
+			typ = p.parseTypeUnion(typ)
+		}
 	}
 	if GENERICS_V2_CTI() && p.tok == etoken.HASH {
 		genericParams = p.parseGenericParams()
@@ -1013,6 +1019,7 @@ func (p *parser) parseMethodSpec(scope *ast.Scope) *ast.Field {
 
 	if isMethod || (ident != nil && p.tok == token.LPAREN) {
 		// method
+		idents = []*ast.Ident{ident}
 		scope := ast.NewScope(nil) // method scope
 		params, results := p.parseSignature(scope)
 		typ = &ast.FuncType{Func: token.NoPos, Params: params, Results: results}
@@ -1048,8 +1055,14 @@ func (p *parser) parseInterfaceType() *ast.InterfaceType {
 	lbrace := p.expect(token.LBRACE)
 	scope := ast.NewScope(nil) // interface scope
 	var list []*ast.Field
-	for p.tok == token.IDENT || (GENERICS_V2_CTI() && p.tok == token.FUNC) {
-		list = append(list, p.parseMethodSpec(scope))
+	for {
+		if p.tok == token.IDENT || (GENERICS_V2_CTI() && p.tok == token.FUNC) {
+			list = append(list, p.parseMethodSpec(scope))
+		} else if isTypeElemStart(p.tok) {
+			list = append(list, p.parseTypeElemSpec())
+		} else {
+			break
+		}
 	}
 	rbrace := p.expect(token.RBRACE)
 
@@ -1110,6 +1123,9 @@ func (p *parser) tryIdentOrType() ast.Expr {
 		if _GENERICS_HASH() && p.tok == etoken.HASH {
 			// parse Foo#[T1,T2...]
 			return p.parseHash(ident)
+		} else if p.tok == token.LBRACK && p.isTypeArgs() {
+			// parse Foo[T1,T2...]
+			return p.parseTypeArgs(ident)
 		}
 		return ident
 	case token.LBRACK:
@@ -1318,7 +1334,7 @@ func (p *parser) parseIndexOrSlice(x ast.Expr) ast.Expr {
 	var index0 ast.Expr
 	if p.tok != token.COLON {
 		index0 = p.parseRhsOrType()
-		if _GENERICS_HASH() && p.tok == token.COMMA {
+		if p.tok == token.COMMA {
 			// parse [A, B...] used in generics
 			var list = []ast.Expr{index0}
 			for p.tok == token.COMMA {
@@ -1519,8 +1535,8 @@ func isTypeName(x ast.Expr) bool {
 	case *ast.BadExpr:
 	case *ast.Ident:
 	case *ast.IndexExpr:
-		// generic type, for example Pair#[T1,T2]
-		return _GENERICS_HASH()
+		// generic type, for example Pair#[T1,T2] or Pair[T1,T2]
+		return _GENERICS_HASH() || isTypeName(t.X)
 	case *ast.SelectorExpr:
 		_, isIdent := t.X.(*ast.Ident)
 		return isIdent
@@ -1536,8 +1552,8 @@ func isLiteralType(x ast.Expr) bool {
 	case *ast.BadExpr:
 	case *ast.Ident:
 	case *ast.IndexExpr:
-		// generic type, for example Pair#[T1,T2]
-		return _GENERICS_HASH()
+		// generic type, for example Pair#[T1,T2] or Pair[T1,T2]
+		return _GENERICS_HASH() || isTypeName(t.X)
 	case *ast.SelectorExpr:
 		_, isIdent := t.X.(*ast.Ident)
 		return isIdent
@@ -2495,6 +2511,9 @@ func (p *parser) parseTypeSpec(doc *ast.CommentGroup, _ token.Token, _ int) ast.
 	if GENERICS_V2_CTI() && p.tok == etoken.HASH {
 		p.next()
 		params = p.parseGenericParams()
+	} else if p.tok == token.LBRACK && p.isTypeParams() {
+		// Go 1.18 type parameters, i.e. `type Map[K comparable, V any] struct { ... }`
+		params = p.parseTypeParams()
 	}
 
 	if p.tok == token.ASSIGN {
@@ -2588,6 +2607,9 @@ func (p *parser) parseFuncOrMacroDecl(tok token.Token) *ast.FuncDecl {
 	if tok != etoken.MACRO && GENERICS_V2_CTI() && p.tok == etoken.HASH {
 		p.next()
 		c = p.parseGenericParams()
+	} else if tok != etoken.MACRO && p.tok == token.LBRACK {
+		// patch: Go 1.18 type params
+		c = p.parseTypeParams()
 	}
 	params, results := p.parseSignature(scope)
 
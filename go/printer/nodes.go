@@ -278,6 +278,25 @@ func (p *printer) genericInfix(c *ast.CompositeLit) {
 	p.print(token.RBRACK)
 }
 
+// print the Go 1.18 type parameters [T1 C1, T2 C2...]
+func (p *printer) typeParams(c *ast.CompositeLit) {
+	p.print(c.Lbrace, token.LBRACK)
+	params, _ := splitGenericArgs(c)
+	for i, param := range params {
+		if i != 0 {
+			p.print(token.COMMA, blank)
+		}
+		if kv, ok := param.(*ast.KeyValueExpr); ok {
+			p.expr(kv.Key)
+			p.print(blank)
+			p.expr(kv.Value)
+		} else {
+			p.expr(param)
+		}
+	}
+	p.print(c.Rbrace, token.RBRACK)
+}
+
 // print the prefix template[T1,T2...] for[Foo#[T1],Bar#[T2],...]
 func (p *printer) templatePrefix(c *ast.CompositeLit) {
 	p.print(etoken.TEMPLATE, token.LBRACK)
@@ -871,7 +890,11 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 		p.expr1(x.X, token.HighestPrec, 1)
 		if c, ok := x.Index.(*ast.CompositeLit); ok && c.Type == nil {
 			// Pair#[A,B] is parsed as &ast.IndexExpr{X: Pair, Index: &ast.CompositeLit{Elts: [A,B]}}
-			p.print(etoken.HASH, x.Lbrack, token.LBRACK)
+			// and Pair[A,B] too
+			if etoken.GENERICS.V1_CXX() || etoken.GENERICS.V2_CTI() {
+				p.print(etoken.HASH)
+			}
+			p.print(x.Lbrack, token.LBRACK)
 			p.exprList(c.Lbrace, c.Elts, depth+1, 0, c.Rbrace)
 			p.print(x.Rbrack, token.RBRACK)
 			break
@@ -1577,6 +1600,8 @@ func (p *printer) spec(spec ast.Spec, n int, doIndent bool) {
 		p.expr(s.Name)
 		if etoken.GENERICS.V2_CTI() && c != nil {
 			p.genericInfix(c)
+		} else if etoken.GENERICS == etoken.GENERICS_NONE && c != nil {
+			p.typeParams(c)
 		}
 		if n == 1 {
 			p.print(blank)
@@ -1792,6 +1817,9 @@ func (p *printer) funcDecl(d *ast.FuncDecl) {
 	if c != nil && etoken.GENERICS.V2_CTI() {
 		// generic function or generic method
 		p.genericInfix(c)
+	} else if c != nil && etoken.GENERICS == etoken.GENERICS_NONE {
+		// Go 1.18 generic function
+		p.typeParams(c)
 	}
 	p.signature(d.Type.Params, d.Type.Results)
 	p.funcBody(p.distanceFrom(d.Pos()), vtab, d.Body)
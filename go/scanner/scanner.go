@@ -148,6 +148,14 @@ func (s *Scanner) Init(file *etoken.File, src []byte, err ErrorHandler, mode Mod
 	}
 }
 
+// patch: Snapshot returns a copy of the scanner, useful for look-ahead.
+// Scanning with the copy does not affect s, and does not report errors.
+func (s *Scanner) Snapshot() Scanner {
+	snap := *s
+	snap.err = nil
+	return snap
+}
+
 func (s *Scanner) error(offs int, msg string) {
 	if s.err != nil {
 		s.err(s.file.Position(s.file.Pos(offs)), msg)
@@ -963,13 +971,22 @@ scanAgain:
 					tok = etoken.UNQUOTE
 				}
 			default:
+				ch, offset, rdOffset := s.ch, s.offset, s.rdOffset
 				lit = s.scanIdentifier()
 				tok = etoken.LookupSpecial(lit)
-				if tok == token.ILLEGAL {
+				if tok == token.ILLEGAL && s.macroChar == '~' {
+					// patch: not a macro-related keyword, must be ~T in a generic type constraint.
+					// rewind and return only the ~
+					s.ch, s.offset, s.rdOffset = ch, offset, rdOffset
+					tok, lit = token.TILDE, ""
+				} else if tok == token.ILLEGAL {
 					s.error(s.file.Offset(pos), fmt.Sprintf("expecting macro-related keyword after '%c', found '%c%s'", s.macroChar, s.macroChar, lit))
 					insertSemi = s.insertSemi // preserve insertSemi info
 				}
 			}
+		case '~':
+			// reached only if s.macroChar != '~'
+			tok = token.TILDE
 		default:
 			// next reports unexpected BOMs - don't repeat
 			if ch != bom {
@@ -37,6 +37,11 @@ type PackageUnderlying = struct { // unnamed
 	// Stored explicitly because reflect package cannot distinguish
 	// between explicit methods and wrapper methods for embedded fields
 	Wrappers map[string][]string
+	// Generics contains the source code of generic functions and types,
+	// and of the unexported declarations they depend on.
+	// Stored as source because they are instantiated on demand by the interpreter.
+	// The key "import" contains the imports needed by such source code
+	Generics map[string]string
 }
 
 type PackageName string // package default name, or package alias
@@ -122,6 +127,9 @@ func (pkg *Package) LazyInit(path string) {
 	if pkg.Wrappers == nil {
 		pkg.Wrappers = make(map[string][]string)
 	}
+	if pkg.Generics == nil {
+		pkg.Generics = make(map[string]string)
+	}
 }
 
 func (dst *Package) Merge(src PackageUnderlying) {
@@ -146,6 +154,9 @@ func (dst *Package) Merge(src PackageUnderlying) {
 	for k, v := range src.Wrappers {
 		dst.Wrappers[k] = v
 	}
+	for k, v := range src.Generics {
+		dst.Generics[k] = v
+	}
 }
 
 func (pkg *Package) Validate(path string) {
@@ -0,0 +1,219 @@
+package imports
+
+import (
+	"fmt"
+	"go/constant"
+	"go/token"
+	. "reflect"
+)
+
+// PackageBuilder declares the constants, functions, variables and types
+// of a package implemented by the application, and registers it in Packages
+// so that interpreted code can import it. Example:
+//
+//	err := imports.NewPackageBuilder("myapp/api").
+//		Func("Version", api.Version).
+//		Var("Config", &api.Config).
+//		Const("MaxUsers", api.MaxUsers).
+//		Type("User", reflect.TypeOf((*api.User)(nil)).Elem()).
+//		Register()
+//
+// Errors are reported by Build() and Register(): after the first one,
+// further declarations are ignored
+type PackageBuilder struct {
+	path string
+	pkg  Package
+	err  error
+}
+
+// NewPackageBuilder returns a PackageBuilder for the package with the given import path.
+// The package name defaults to the last component of the path
+func NewPackageBuilder(path string) *PackageBuilder {
+	b := &PackageBuilder{path: path}
+	if path == "" {
+		b.err = fmt.Errorf("invalid empty package path")
+	}
+	b.pkg.LazyInit(path)
+	return b
+}
+
+// Name sets the package name, used by interpreted code that imports the package without an alias
+func (b *PackageBuilder) Name(name string) *PackageBuilder {
+	if !token.IsIdentifier(name) {
+		return b.errorf("invalid package name %q", name)
+	} else if b.err == nil {
+		b.pkg.Name = name
+	}
+	return b
+}
+
+// Func declares a function. fun must be a non-nil func
+func (b *PackageBuilder) Func(name string, fun interface{}) *PackageBuilder {
+	v := ValueOf(fun)
+	if v.Kind() != Func || v.IsNil() {
+		return b.errorf("cannot declare func %s: expecting a non-nil function, found %v <%T>", name, fun, fun)
+	}
+	return b.bind(name, v)
+}
+
+// Var declares a variable. ptr must be a non-nil pointer to the variable:
+// interpreted code reads and writes the variable through it
+func (b *PackageBuilder) Var(name string, ptr interface{}) *PackageBuilder {
+	v := ValueOf(ptr)
+	if v.Kind() != Ptr || v.IsNil() {
+		return b.errorf("cannot declare var %s: expecting a non-nil pointer, found %v <%T>", name, ptr, ptr)
+	}
+	return b.bind(name, v.Elem())
+}
+
+// Const declares a typed constant. value must be a boolean, a number or a string
+func (b *PackageBuilder) Const(name string, value interface{}) *PackageBuilder {
+	v := ValueOf(value)
+	switch v.Kind() {
+	case Bool, Int, Int8, Int16, Int32, Int64, Uint, Uint8, Uint16, Uint32, Uint64, Uintptr,
+		Float32, Float64, Complex64, Complex128, String:
+		return b.bind(name, v)
+	}
+	return b.errorf("cannot declare const %s: expecting a boolean, number or string, found %v <%T>", name, value, value)
+}
+
+// UntypedConst declares an untyped constant, with arbitrary precision
+func (b *PackageBuilder) UntypedConst(name string, value constant.Value) *PackageBuilder {
+	var s string
+	var approx interface{} // Binds contain an approximation of untyped constants
+	switch value.Kind() {
+	case constant.Bool:
+		s, approx = fmt.Sprintf("bool:%v", constant.BoolVal(value)), constant.BoolVal(value)
+	case constant.Int:
+		s = "int:" + value.ExactString()
+		if i, exact := constant.Int64Val(value); exact {
+			approx = i
+		} else {
+			approx, _ = constant.Float64Val(value)
+		}
+	case constant.Float:
+		s = "float:" + value.ExactString()
+		approx, _ = constant.Float64Val(value)
+	case constant.Complex:
+		re, _ := constant.Float64Val(constant.Real(value))
+		im, _ := constant.Float64Val(constant.Imag(value))
+		s, approx = fmt.Sprintf("complex:%s:%s", constant.Real(value).ExactString(), constant.Imag(value).ExactString()), complex(re, im)
+	case constant.String:
+		s, approx = "string:"+constant.StringVal(value), constant.StringVal(value)
+	default:
+		return b.errorf("cannot declare const %s: invalid value %v", name, value)
+	}
+	if b.declare(name) {
+		b.pkg.Binds[name] = ValueOf(approx)
+		b.pkg.Untypeds[name] = s
+	}
+	return b
+}
+
+// Type declares a named type. If typ is an interface, interpreted types can implement it
+// only if it has a proxy: Type() uses the proxy of the same interface already registered
+// in Packages, if any. Otherwise call Proxy()
+func (b *PackageBuilder) Type(name string, typ Type) *PackageBuilder {
+	if typ == nil {
+		return b.errorf("cannot declare type %s: type is nil", name)
+	}
+	if b.declare(name) {
+		b.pkg.Types[name] = typ
+		if typ.Kind() == Interface {
+			if proxy := findProxy(typ); proxy != nil {
+				b.pkg.Proxies[name] = proxy
+			}
+		}
+	}
+	return b
+}
+
+// Proxy sets the proxy for the interface type name, which allows interpreted types
+// to implement it. A proxy cannot be created by reflection, because it needs methods:
+// it is a struct type with a field "Object interface{}" followed, for each method M
+// of the interface in order, by a field "M_" containing a func with an additional
+// first parameter "interface{}", and a method M on its pointer that calls M_.
+// Use "gomacro -g" to generate it, or see the P_* types in this package for examples
+func (b *PackageBuilder) Proxy(name string, proxy Type) *PackageBuilder {
+	if b.err != nil {
+		return b
+	}
+	typ := b.pkg.Types[name]
+	if typ == nil || typ.Kind() != Interface {
+		return b.errorf("cannot declare proxy for %s: not an interface type of the package", name)
+	} else if proxy == nil {
+		return b.errorf("cannot declare proxy for %s: proxy type is nil", name)
+	}
+	b.pkg.Proxies[name] = proxy
+	return b
+}
+
+// Build validates the declarations and returns the package, without registering it
+func (b *PackageBuilder) Build() (pkg Package, err error) {
+	if b.err != nil {
+		return Package{}, b.err
+	}
+	defer func() {
+		if rec := recover(); rec != nil {
+			if err, _ = rec.(error); err == nil {
+				err = fmt.Errorf("%v", rec)
+			}
+			pkg = Package{}
+		}
+	}()
+	b.pkg.Validate(b.path)
+	return b.pkg, nil
+}
+
+// Register validates the declarations and adds the package to Packages,
+// merging it with any package already registered with the same path.
+// Interpreted code can then import it
+func (b *PackageBuilder) Register() error {
+	pkg, err := b.Build()
+	if err == nil {
+		Packages.MergePackage(b.path, PackageUnderlying(pkg))
+	}
+	return err
+}
+
+func (b *PackageBuilder) bind(name string, v Value) *PackageBuilder {
+	if b.declare(name) {
+		b.pkg.Binds[name] = v
+	}
+	return b
+}
+
+// declare checks that name is exported and not yet declared
+func (b *PackageBuilder) declare(name string) bool {
+	if b.err != nil {
+		return false
+	}
+	if !token.IsIdentifier(name) || !token.IsExported(name) {
+		b.errorf("invalid name %q: expecting an exported identifier", name)
+		return false
+	}
+	if _, bind := b.pkg.Binds[name]; bind || b.pkg.Types[name] != nil {
+		b.errorf("%s redeclared", name)
+		return false
+	}
+	return true
+}
+
+func (b *PackageBuilder) errorf(format string, args ...interface{}) *PackageBuilder {
+	if b.err == nil {
+		b.err = fmt.Errorf("package %q: %s", b.path, fmt.Sprintf(format, args...))
+	}
+	return b
+}
+
+// findProxy returns the proxy of interface type typ registered in Packages, or nil if not found
+func findProxy(typ Type) Type {
+	for _, pkg := range Packages {
+		for name, proxy := range pkg.Proxies {
+			if pkg.Types[name] == typ {
+				return proxy
+			}
+		}
+	}
+	return nil
+}
@@ -32,6 +32,11 @@ type Package = struct { // unnamed
 	// Stored explicitly because reflect package cannot distinguish
 	// between explicit methods and wrapper methods for embedded fields
 	Wrappers map[string][]string
+	// Generics contains the source code of generic functions and types,
+	// and of the unexported declarations they depend on.
+	// Stored as source because they are instantiated on demand by the interpreter.
+	// The key "import" contains the imports needed by such source code
+	Generics map[string]string
 }
 
 var Packages = make(map[string]Package)
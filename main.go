@@ -25,12 +25,15 @@ import (
 func main() {
 	args := os.Args[1:]
 
-	cmd := cmd.New()
+	c := cmd.New()
 
-	err := cmd.Main(args)
+	err := c.Main(args)
 	if err != nil {
-		o := &cmd.Interp.Comp.Output
+		o := &c.Interp.Comp.Output
 		o.Fprintf(o.Stderr, "%s\n", err)
+		if e, ok := err.(*cmd.ExitError); ok {
+			os.Exit(e.Code)
+		}
 		os.Exit(1)
 	}
 }